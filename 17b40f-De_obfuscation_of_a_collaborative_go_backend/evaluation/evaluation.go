@@ -1,38 +1,118 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	metricspkg "github.com/khallihub/godoc/evaluation/pkg/metrics"
+	"github.com/khallihub/godoc/evaluation/sink"
+	"golang.org/x/sync/errgroup"
 )
 
+// defaultMaxRegressionPercent is the default --max-regression gate: an
+// after-side benchmark whose mean ns/op is worse than this, with
+// p < significancePValue, fails the run.
+const defaultMaxRegressionPercent = 5.0
+
+// Default per-stage timeouts for --test-timeout and --build-timeout: long
+// enough for a real test suite or build, short enough that a hung process
+// doesn't stall the whole evaluation run indefinitely.
+const (
+	defaultTestTimeout  = 5 * time.Minute
+	defaultBuildTimeout = 2 * time.Minute
+)
+
+const significancePValue = 0.05
+
 // Report structures following the standard schema
 type Environment struct {
 	GoVersion string `json:"go_version"`
 	Platform  string `json:"platform"`
 }
 
+// testEvent is one line of `go test -json` output, as documented by
+// cmd/test2json.
+type testEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"`
+	Output  string  `json:"Output"`
+}
+
+// TestCase is one test's outcome, aggregated from every event test2json
+// reported for it.
+type TestCase struct {
+	Package string  `json:"package"`
+	Name    string  `json:"name"`
+	Action  string  `json:"action"` // "pass", "fail", or "skip"
+	Elapsed float64 `json:"elapsed"`
+	Output  string  `json:"output,omitempty"`
+}
+
 type TestResult struct {
-	Passed     bool   `json:"passed"`
-	ReturnCode int    `json:"return_code"`
-	Output     string `json:"output"`
+	Passed     bool       `json:"passed"`
+	ReturnCode int        `json:"return_code"`
+	Output     string     `json:"output"`
+	Tests      []TestCase `json:"tests"`
 }
 
 type RepoResult struct {
-	Tests   TestResult         `json:"tests"`
-	Metrics map[string]float64 `json:"metrics"`
+	Tests           TestResult           `json:"tests"`
+	Metrics         map[string]float64   `json:"metrics"`
+	Benchmarks      map[string][]float64 `json:"benchmarks,omitempty"`
+	LintFindings    []LintFinding         `json:"lint_findings,omitempty"`
+	LintLinterNames []string              `json:"lint_linter_names,omitempty"`
+	// VulnCalledIDs and VulnImportedIDs are the distinct OSV IDs
+	// govulncheck reported as reachable via an actual call path, and merely
+	// imported-but-not-called, respectively. Kept on RepoResult (rather
+	// than only the rolled-up counts in Metrics) so runEvaluation can diff
+	// before against after and fail the gate on any newly called ID.
+	VulnCalledIDs   []string `json:"vuln_called_ids,omitempty"`
+	VulnImportedIDs []string `json:"vuln_imported_ids,omitempty"`
+}
+
+// LintFinding is one golangci-lint issue, kept for the top-N list surfaced
+// alongside the rolled-up lint_errors/lint_warnings counts in Metrics.
+type LintFinding struct {
+	Linter string `json:"linter"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+}
+
+// BenchmarkDelta is one benchmark's before/after comparison: the geometric
+// mean ns/op on each side, the percent change, and a Mann-Whitney U-test
+// p-value for whether that change is distinguishable from noise.
+type BenchmarkDelta struct {
+	Name         string  `json:"name"`
+	BeforeMean   float64 `json:"before_mean_ns_op"`
+	AfterMean    float64 `json:"after_mean_ns_op"`
+	DeltaPercent float64 `json:"delta_percent"`
+	PValue       float64 `json:"p_value"`
+	// Regressed is true when the after side is worse than maxRegressionPercent
+	// and PValue is below significancePValue -- i.e. this benchmark alone
+	// would fail the --max-regression gate.
+	Regressed bool `json:"regressed"`
 }
 
 type Comparison struct {
-	PassedGate          bool   `json:"passed_gate"`
-	ImprovementSummary string `json:"improvement_summary"`
+	PassedGate         bool             `json:"passed_gate"`
+	ImprovementSummary string           `json:"improvement_summary"`
+	Benchmarks         []BenchmarkDelta `json:"benchmarks,omitempty"`
 }
 
 type EvaluationReport struct {
@@ -55,62 +135,138 @@ func getEnvironmentInfo() Environment {
 	}
 }
 
-func runTests(repoPath string) TestResult {
+func runTests(ctx context.Context, repoPath string, timeout time.Duration) TestResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	// Determine test path based on repository
 	var cmd *exec.Cmd
-	
+
 	// Check if this is repository_after (which has tests in root)
 	if strings.Contains(repoPath, "repository_after") {
 		// For repository_after, test the main package
-		cmd = exec.Command("go", "test", ".", "-v")
+		cmd = exec.CommandContext(ctx, "go", "test", "-json", ".")
 	} else {
 		// For repository_before, test the tests subdirectory
-		cmd = exec.Command("go", "test", "./tests/...", "-v")
+		cmd = exec.CommandContext(ctx, "go", "test", "-json", "./tests/...")
 	}
-	
+
 	cmd.Dir = repoPath
-	
-	output, err := cmd.CombinedOutput()
-	outputStr := string(output)
-	
+
+	outputStr, err := runCapturingOutput(cmd)
+
+	tests := parseGoTestJSON(outputStr)
+
 	// Truncate output if too long
 	if len(outputStr) > 8000 {
 		outputStr = outputStr[:8000] + "... (truncated)"
 	}
-	
+
 	returnCode := 0
-	passed := true
-	
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			returnCode = exitError.ExitCode()
 		} else {
 			returnCode = 1
 		}
-		passed = false
 	}
-	
+
+	// Any fail action means the run failed, regardless of the process exit
+	// code -- a panicking test can still leave go test's own exit status at
+	// 0 in some toolchain versions.
+	passed := err == nil
+	for _, tc := range tests {
+		if tc.Action == "fail" {
+			passed = false
+			break
+		}
+	}
+
 	return TestResult{
 		Passed:     passed,
 		ReturnCode: returnCode,
 		Output:     outputStr,
+		Tests:      tests,
+	}
+}
+
+// parseGoTestJSON decodes `go test -json` output into one TestCase per test,
+// grouping "output" actions under their most recent "run" event for that
+// test and keeping the last pass/fail/skip action seen as the outcome.
+// Lines that aren't valid JSON (compiler diagnostics, a bare "FAIL" trailer
+// on build failure) are ignored here; runMetrics separately detects a build
+// failure from the process exit code.
+func parseGoTestJSON(rawOutput string) []TestCase {
+	cases := make(map[string]*TestCase)
+	var order []string
+
+	for _, line := range strings.Split(rawOutput, "\n") {
+		var event testEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		if event.Test == "" {
+			continue
+		}
+
+		key := event.Package + "/" + event.Test
+		tc, exists := cases[key]
+		if !exists {
+			tc = &TestCase{Package: event.Package, Name: event.Test}
+			cases[key] = tc
+			order = append(order, key)
+		}
+
+		switch event.Action {
+		case "output":
+			tc.Output += event.Output
+		case "pass", "fail", "skip":
+			tc.Action = event.Action
+			tc.Elapsed = event.Elapsed
+		}
+	}
+
+	result := make([]TestCase, 0, len(order))
+	for _, key := range order {
+		tc := cases[key]
+		if tc.Action == "" {
+			// Started but never reached a terminal action, e.g. the test
+			// panicked and took the process down with it.
+			tc.Action = "fail"
+		}
+		if tc.Action != "fail" {
+			tc.Output = ""
+		}
+		result = append(result, *tc)
 	}
+	return result
 }
 
-func runMetrics(repoPath string) map[string]float64 {
+func runMetrics(ctx context.Context, repoPath string, buildTimeout time.Duration) map[string]float64 {
 	metrics := make(map[string]float64)
-	
+
 	// Basic code quality metrics
-	metrics["lines_of_code"] = countLinesOfCode(repoPath)
-	metrics["go_files_count"] = countGoFiles(repoPath)
-	
+	complexity := metricspkg.Analyze(ctx, repoPath)
+	metrics["lines_of_code"] = complexity.SLOC
+	metrics["go_files_count"] = countGoFiles(ctx, repoPath)
+	metrics["cyclomatic_complexity"] = complexity.CyclomaticComplexity
+	metrics["cognitive_complexity"] = complexity.CognitiveComplexity
+	metrics["function_count"] = complexity.FunctionCount
+	metrics["avg_function_lines"] = complexity.AverageFunctionLines
+	metrics["exported_identifiers"] = complexity.ExportedIdentifiers
+	metrics["obfuscation_score"] = complexity.ObfuscationScore
+	metrics["identifier_entropy_bits"] = metricspkg.IdentifierEntropyBits(ctx, repoPath)
+
 	// Compilation time metric
+	buildCtx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
 	start := time.Now()
-	cmd := exec.Command("go", "build", "./...")
+	cmd := exec.CommandContext(buildCtx, "go", "build", "./...")
 	cmd.Dir = repoPath
 	err := cmd.Run()
 	buildTime := time.Since(start).Seconds() * 1000 // Convert to milliseconds
-	
+
 	if err != nil {
 		metrics["build_success"] = 0
 		metrics["build_time_ms"] = -1
@@ -118,51 +274,335 @@ func runMetrics(repoPath string) map[string]float64 {
 		metrics["build_success"] = 1
 		metrics["build_time_ms"] = buildTime
 	}
-	
+
 	return metrics
 }
 
-func countLinesOfCode(repoPath string) float64 {
-	var totalLines float64
-	
-	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+// benchmarkCount is how many samples `go test -bench` collects per
+// benchmark (its -count flag), matching the minimum benchstat itself
+// recommends for a usable Mann-Whitney comparison.
+const benchmarkCount = 6
+
+// benchmarkLineRe matches a `go test -bench -benchmem` result line, e.g.
+//
+//	BenchmarkPool-8    1000000    1234 ns/op    56 B/op    2 allocs/op
+//
+// The CPU-count suffix ("-8") and the iteration count are both ignored;
+// only the name and the ns/op measurement matter for the comparison.
+var benchmarkLineRe = regexp.MustCompile(`^(Benchmark\S+)\s+\d+\s+([\d.]+)\s+ns/op`)
+
+// runBenchmarks runs `go test -bench=. -benchmem -run=^$ -count=benchmarkCount ./...`
+// in repoPath and returns each benchmark's ns/op samples, one per -count
+// repetition. A repo with no benchmarks at all returns an empty, non-nil
+// map rather than an error, so callers can always diff two maps without a
+// nil check.
+func runBenchmarks(ctx context.Context, repoPath string, timeout time.Duration) map[string][]float64 {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "test", "-bench=.", "-benchmem", "-run=^$", fmt.Sprintf("-count=%d", benchmarkCount), "./...")
+	cmd.Dir = repoPath
+
+	output, _ := runCapturingOutput(cmd)
+	return parseBenchmarkOutput(output)
+}
+
+// parseBenchmarkOutput extracts ns/op samples from raw `go test -bench`
+// output, appending one sample per matching line in the order they were
+// printed (i.e. in -count repetition order).
+func parseBenchmarkOutput(output string) map[string][]float64 {
+	samples := make(map[string][]float64)
+	for _, line := range strings.Split(output, "\n") {
+		match := benchmarkLineRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		nsPerOp, err := strconv.ParseFloat(match[2], 64)
 		if err != nil {
-			return err
+			continue
 		}
-		
-		if strings.HasSuffix(path, ".go") && !strings.Contains(path, "vendor/") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			
-			lines := strings.Split(string(content), "\n")
-			for _, line := range lines {
-				trimmed := strings.TrimSpace(line)
-				if trimmed != "" && !strings.HasPrefix(trimmed, "//") {
-					totalLines++
-				}
+		samples[match[1]] = append(samples[match[1]], nsPerOp)
+	}
+	return samples
+}
+
+// geometricMean is the summary statistic benchstat itself uses for a set of
+// benchmark samples, since ns/op measurements are multiplicative (a 2x
+// slowdown and a 2x speedup should average back to baseline) rather than
+// additive.
+func geometricMean(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sumLogs := 0.0
+	for _, s := range samples {
+		sumLogs += math.Log(s)
+	}
+	return math.Exp(sumLogs / float64(len(samples)))
+}
+
+// mannWhitneyPValue runs a two-sided, two-sample Mann-Whitney U test and
+// returns its p-value via the normal approximation, which is accurate
+// enough once each side has the handful of samples -count typically
+// collects. Tied ranks are averaged, matching the standard rank-sum
+// procedure.
+func mannWhitneyPValue(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type labeled struct {
+		value float64
+		fromA bool
+	}
+	combined := make([]labeled, 0, n1+n2)
+	for _, v := range a {
+		combined = append(combined, labeled{v, true})
+	}
+	for _, v := range b {
+		combined = append(combined, labeled{v, false})
+	}
+	sort.Slice(combined, func(i, j int) bool { return combined[i].value < combined[j].value })
+
+	ranks := make([]float64, len(combined))
+	i := 0
+	for i < len(combined) {
+		j := i
+		for j < len(combined) && combined[j].value == combined[i].value {
+			j++
+		}
+		averageRank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			ranks[k] = averageRank
+		}
+		i = j
+	}
+
+	rankSumA := 0.0
+	for i, c := range combined {
+		if c.fromA {
+			rankSumA += ranks[i]
+		}
+	}
+
+	u1 := rankSumA - float64(n1*(n1+1))/2
+	uMean := float64(n1*n2) / 2
+	uVariance := float64(n1*n2*(n1+n2+1)) / 12
+	if uVariance == 0 {
+		return 1
+	}
+
+	z := (u1 - uMean) / math.Sqrt(uVariance)
+	return 2 * (1 - standardNormalCDF(math.Abs(z)))
+}
+
+// standardNormalCDF is the CDF of the standard normal distribution, used to
+// turn mannWhitneyPValue's z-score into a p-value.
+func standardNormalCDF(z float64) float64 {
+	return 0.5 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// compareBenchmarks diffs before and after benchmark samples by name,
+// skipping any benchmark that doesn't appear on both sides (added,
+// removed, or renamed alongside the de-obfuscation). maxRegressionPercent
+// is the --max-regression gate threshold.
+func compareBenchmarks(before, after map[string][]float64, maxRegressionPercent float64) []BenchmarkDelta {
+	names := make([]string, 0, len(before))
+	for name := range before {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var deltas []BenchmarkDelta
+	for _, name := range names {
+		afterSamples, ok := after[name]
+		if !ok {
+			continue
+		}
+		beforeSamples := before[name]
+
+		beforeMean := geometricMean(beforeSamples)
+		afterMean := geometricMean(afterSamples)
+		deltaPercent := 0.0
+		if beforeMean != 0 {
+			deltaPercent = (afterMean - beforeMean) / beforeMean * 100
+		}
+		pValue := mannWhitneyPValue(beforeSamples, afterSamples)
+
+		deltas = append(deltas, BenchmarkDelta{
+			Name:         name,
+			BeforeMean:   beforeMean,
+			AfterMean:    afterMean,
+			DeltaPercent: deltaPercent,
+			PValue:       pValue,
+			Regressed:    deltaPercent > maxRegressionPercent && pValue < significancePValue,
+		})
+	}
+	return deltas
+}
+
+// lintTopN bounds how many issues runLint keeps in RepoResult.LintFindings;
+// the rolled-up counts in Metrics still reflect every issue golangci-lint
+// reported.
+const lintTopN = 10
+
+// golangciLintIssue is one entry of golangci-lint's `--out-format=json`
+// Issues array.
+type golangciLintIssue struct {
+	FromLinter string `json:"FromLinter"`
+	Text       string `json:"Text"`
+	Severity   string `json:"Severity"`
+	Pos        struct {
+		Filename string `json:"Filename"`
+		Line     int    `json:"Line"`
+	} `json:"Pos"`
+}
+
+type golangciLintReport struct {
+	Issues []golangciLintIssue `json:"Issues"`
+}
+
+// runLint invokes golangci-lint and rolls its issues up into metrics'
+// lint_errors/lint_warnings counts, plus up to lintTopN issues kept for
+// RepoResult.LintFindings and every distinct linter name that fired (for
+// the gate's new-lint-category check, which needs the full set even though
+// the findings list itself is capped). golangci-lint is optional: if the
+// binary isn't on PATH, both metrics are recorded as -1 and both return
+// values stay empty.
+func runLint(ctx context.Context, repoPath string, metrics map[string]float64) (topFindings []LintFinding, linterNames []string) {
+	if _, err := exec.LookPath("golangci-lint"); err != nil {
+		metrics["lint_errors"] = -1
+		metrics["lint_warnings"] = -1
+		return nil, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "golangci-lint", "run", "--out-format=json", "./...")
+	cmd.Dir = repoPath
+	output, _ := runCapturingOutput(cmd)
+
+	var report golangciLintReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		metrics["lint_errors"] = -1
+		metrics["lint_warnings"] = -1
+		return nil, nil
+	}
+
+	var errors, warnings float64
+	seenLinters := make(map[string]bool)
+	findings := make([]LintFinding, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		// golangci-lint leaves Severity empty unless a linter sets one
+		// explicitly; an unset severity means the issue still fails the
+		// default build, so it's counted as an error.
+		if issue.Severity == "warning" {
+			warnings++
+		} else {
+			errors++
+		}
+		if !seenLinters[issue.FromLinter] {
+			seenLinters[issue.FromLinter] = true
+			linterNames = append(linterNames, issue.FromLinter)
+		}
+		findings = append(findings, LintFinding{
+			Linter: issue.FromLinter,
+			File:   issue.Pos.Filename,
+			Line:   issue.Pos.Line,
+			Text:   issue.Text,
+		})
+	}
+	metrics["lint_errors"] = errors
+	metrics["lint_warnings"] = warnings
+
+	if len(findings) > lintTopN {
+		findings = findings[:lintTopN]
+	}
+	return findings, linterNames
+}
+
+// govulncheckEvent is one line of govulncheck's `-json` output stream: each
+// line carries exactly one of the fields set, per the tool's documented
+// (OSVEvent | FindingEvent | ProgressEvent) union.
+type govulncheckEvent struct {
+	OSV *struct {
+		ID string `json:"id"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV   string `json:"osv"`
+		Trace []struct {
+			Function string `json:"function"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// runVulnCheck invokes govulncheck and splits the distinct OSV IDs it
+// reports into "called" (reachable via an actual call path, per Trace
+// having a frame with a Function set) and merely "imported". govulncheck is
+// optional: if the binary isn't on PATH, both metrics are recorded as -1.
+func runVulnCheck(ctx context.Context, repoPath string, metrics map[string]float64) (calledIDs, importedIDs []string) {
+	if _, err := exec.LookPath("govulncheck"); err != nil {
+		metrics["vuln_called"] = -1
+		metrics["vuln_imported"] = -1
+		return nil, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "govulncheck", "-json", "./...")
+	cmd.Dir = repoPath
+	output, _ := runCapturingOutput(cmd)
+
+	called := make(map[string]bool)
+	imported := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		var event govulncheckEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		if event.Finding == nil || event.Finding.OSV == "" {
+			continue
+		}
+
+		isCalled := false
+		for _, frame := range event.Finding.Trace {
+			if frame.Function != "" {
+				isCalled = true
+				break
 			}
 		}
-		
-		return nil
-	})
-	
-	if err != nil {
-		return 0
+		if isCalled {
+			called[event.Finding.OSV] = true
+		} else {
+			imported[event.Finding.OSV] = true
+		}
 	}
-	
-	return totalLines
+
+	for id := range called {
+		calledIDs = append(calledIDs, id)
+	}
+	for id := range imported {
+		if called[id] {
+			continue
+		}
+		importedIDs = append(importedIDs, id)
+	}
+	sort.Strings(calledIDs)
+	sort.Strings(importedIDs)
+
+	metrics["vuln_called"] = float64(len(calledIDs))
+	metrics["vuln_imported"] = float64(len(importedIDs))
+	return calledIDs, importedIDs
 }
 
-func countGoFiles(repoPath string) float64 {
+func countGoFiles(ctx context.Context, repoPath string) float64 {
 	var count float64
-	
+
 	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
 			return err
 		}
-		
+
 		if strings.HasSuffix(path, ".go") && !strings.Contains(path, "vendor/") {
 			count++
 		}
@@ -177,10 +617,18 @@ func countGoFiles(repoPath string) float64 {
 	return count
 }
 
-func evaluate(repoName string) RepoResult {
+// stageTimeouts bounds how long each of evaluate's exec.Command stages may
+// run before its context is cancelled, configured from main via
+// --test-timeout and --build-timeout.
+type stageTimeouts struct {
+	test  time.Duration
+	build time.Duration
+}
+
+func evaluate(ctx context.Context, repoName string, timeouts stageTimeouts) RepoResult {
 	// Use absolute path from /app directory
 	repoPath := filepath.Join("/app", repoName)
-	
+
 	// Check if repository exists
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		return RepoResult{
@@ -192,34 +640,95 @@ func evaluate(repoName string) RepoResult {
 			Metrics: make(map[string]float64),
 		}
 	}
-	
-	tests := runTests(repoPath)
-	metrics := runMetrics(repoPath)
-	
+
+	tests := runTests(ctx, repoPath, timeouts.test)
+	metrics := runMetrics(ctx, repoPath, timeouts.build)
+	addTestCountMetrics(metrics, tests.Tests)
+	benchmarks := runBenchmarks(ctx, repoPath, timeouts.test)
+	lintFindings, lintLinterNames := runLint(ctx, repoPath, metrics)
+	vulnCalledIDs, vulnImportedIDs := runVulnCheck(ctx, repoPath, metrics)
+
 	return RepoResult{
-		Tests:   tests,
-		Metrics: metrics,
+		Tests:           tests,
+		Metrics:         metrics,
+		Benchmarks:      benchmarks,
+		LintFindings:    lintFindings,
+		LintLinterNames: lintLinterNames,
+		VulnCalledIDs:   vulnCalledIDs,
+		VulnImportedIDs: vulnImportedIDs,
+	}
+}
+
+// addTestCountMetrics rolls per-test outcomes up into metrics' total,
+// passed, failed, and skipped counts, so a caller diffing before.Metrics
+// against after.Metrics sees exactly what changed instead of only the
+// single pass/fail TestResult.Passed boolean.
+func addTestCountMetrics(metrics map[string]float64, tests []TestCase) {
+	var total, passed, failed, skipped float64
+	for _, tc := range tests {
+		total++
+		switch tc.Action {
+		case "pass":
+			passed++
+		case "skip":
+			skipped++
+		default:
+			failed++
+		}
 	}
+	metrics["tests_total"] = total
+	metrics["tests_passed"] = passed
+	metrics["tests_failed"] = failed
+	metrics["tests_skipped"] = skipped
 }
 
-func runEvaluation() EvaluationReport {
+func runEvaluation(ctx context.Context, maxRegressionPercent float64, timeouts stageTimeouts) EvaluationReport {
 	runID := uuid.New().String()
 	start := time.Now()
-	
-	before := evaluate("repository_before")
-	after := evaluate("repository_after")
-	
-	// Determine if the gate passed
+
+	// repository_before and repository_after are independent: neither
+	// exec.Command run touches the other's working directory, so there's
+	// no reason to make the slower one block the faster one.
+	var before, after RepoResult
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		before = evaluate(gCtx, "repository_before", timeouts)
+		return nil
+	})
+	g.Go(func() error {
+		after = evaluate(gCtx, "repository_after", timeouts)
+		return nil
+	})
+	_ = g.Wait() // evaluate never returns an error; it records failures in RepoResult instead
+
+	benchmarkDeltas := compareBenchmarks(before.Benchmarks, after.Benchmarks, maxRegressionPercent)
+	newLintCategories := newEntries(before.LintLinterNames, after.LintLinterNames)
+	newCalledVulns := newEntries(before.VulnCalledIDs, after.VulnCalledIDs)
+
+	// Determine if the gate passed: tests must pass, no benchmark may have
+	// regressed beyond the configured --max-regression threshold, and the
+	// de-obfuscation must not have introduced a new lint category or a
+	// newly reachable vulnerability -- either means "after" is worse even
+	// though its tests still pass.
 	passedGate := after.Tests.Passed
-	
+	for _, delta := range benchmarkDeltas {
+		if delta.Regressed {
+			passedGate = false
+		}
+	}
+	if len(newLintCategories) > 0 || len(newCalledVulns) > 0 {
+		passedGate = false
+	}
+
 	// Generate improvement summary
 	improvementSummary := generateImprovementSummary(before, after)
-	
+
 	comparison := Comparison{
 		PassedGate:          passedGate,
-		ImprovementSummary: improvementSummary,
+		ImprovementSummary:  improvementSummary,
+		Benchmarks:          benchmarkDeltas,
 	}
-	
+
 	end := time.Now()
 	duration := end.Sub(start).Seconds()
 	
@@ -238,18 +747,132 @@ func runEvaluation() EvaluationReport {
 }
 
 func generateImprovementSummary(before, after RepoResult) string {
-	if !before.Tests.Passed && after.Tests.Passed {
-		return "De-obfuscation successful: tests now pass after code cleanup"
-	} else if before.Tests.Passed && after.Tests.Passed {
-		return "Code successfully de-obfuscated while maintaining functionality"
-	} else if !before.Tests.Passed && !after.Tests.Passed {
-		return "Both versions have test failures"
-	} else {
-		return "De-obfuscation introduced test failures"
+	var verdict string
+	switch {
+	case !before.Tests.Passed && after.Tests.Passed:
+		verdict = "De-obfuscation successful: tests now pass after code cleanup"
+	case before.Tests.Passed && after.Tests.Passed:
+		verdict = "Code successfully de-obfuscated while maintaining functionality"
+	case !before.Tests.Passed && !after.Tests.Passed:
+		verdict = "Both versions have test failures"
+	default:
+		verdict = "De-obfuscation introduced test failures"
+	}
+
+	detail := complexityDeltaSummary(before.Metrics, after.Metrics)
+	if detail == "" {
+		return verdict
+	}
+	return verdict + " (" + detail + ")"
+}
+
+// complexityDeltaSummary turns the before/after cyclomatic_complexity and
+// identifier_entropy_bits metrics into a human-readable sentence fragment,
+// e.g. "cyclomatic complexity dropped 42%, identifier entropy dropped from
+// 4.9 to 2.1 bits". Returns "" if either side is missing a metric, which
+// happens whenever runMetrics couldn't parse any .go files.
+func complexityDeltaSummary(before, after map[string]float64) string {
+	var parts []string
+
+	beforeComplexity, haveBeforeComplexity := before["cyclomatic_complexity"]
+	afterComplexity, haveAfterComplexity := after["cyclomatic_complexity"]
+	if haveBeforeComplexity && haveAfterComplexity && beforeComplexity > 0 {
+		deltaPercent := (beforeComplexity - afterComplexity) / beforeComplexity * 100
+		if deltaPercent >= 0 {
+			parts = append(parts, fmt.Sprintf("cyclomatic complexity dropped %.0f%%", deltaPercent))
+		} else {
+			parts = append(parts, fmt.Sprintf("cyclomatic complexity rose %.0f%%", -deltaPercent))
+		}
+	}
+
+	beforeEntropy, haveBeforeEntropy := before["identifier_entropy_bits"]
+	afterEntropy, haveAfterEntropy := after["identifier_entropy_bits"]
+	if haveBeforeEntropy && haveAfterEntropy {
+		direction := "dropped"
+		if afterEntropy > beforeEntropy {
+			direction = "rose"
+		}
+		parts = append(parts, fmt.Sprintf("identifier entropy %s from %.1f to %.1f bits", direction, beforeEntropy, afterEntropy))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// newEntries returns the entries present in after but not in before.
+func newEntries(before, after []string) []string {
+	beforeSet := make(map[string]bool, len(before))
+	for _, b := range before {
+		beforeSet[b] = true
+	}
+
+	var added []string
+	for _, a := range after {
+		if !beforeSet[a] {
+			added = append(added, a)
+		}
+	}
+	return added
+}
+
+// publishHistory builds a sink.Row from report and publishes it to whichever
+// sinks sinkSelection ("csv", "sheets", or "both") names. Sheets publishing
+// is configured via GOOGLE_APPLICATION_CREDENTIALS and SHEETS_ID; a missing
+// env var is treated as a misconfiguration and returns an error rather than
+// silently skipping the sink the caller asked for.
+func publishHistory(sinkSelection string, report EvaluationReport) error {
+	var reporters []sink.Reporter
+
+	if sinkSelection == "csv" || sinkSelection == "both" {
+		reporters = append(reporters, sink.NewCSVReporter(filepath.Join("evaluation", "reports", "history.csv")))
+	}
+
+	if sinkSelection == "sheets" || sinkSelection == "both" {
+		credentialsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		spreadsheetID := os.Getenv("SHEETS_ID")
+		if credentialsPath == "" || spreadsheetID == "" {
+			return fmt.Errorf("publishHistory: --sink=%s requires GOOGLE_APPLICATION_CREDENTIALS and SHEETS_ID", sinkSelection)
+		}
+		sheetsReporter, err := sink.NewSheetsReporter(context.Background(), spreadsheetID, credentialsPath)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, sheetsReporter)
+	}
+
+	if len(reporters) == 0 {
+		return fmt.Errorf("publishHistory: unknown --sink value %q (want csv, sheets, or both)", sinkSelection)
+	}
+
+	multi := &sink.MultiReporter{Reporters: reporters}
+	return multi.Publish(context.Background(), reportToRow(report))
+}
+
+// reportToRow reduces a full EvaluationReport down to the handful of
+// columns tracked in the longitudinal history sink.
+func reportToRow(report EvaluationReport) sink.Row {
+	return sink.Row{
+		RunID:            report.RunID,
+		Timestamp:        report.FinishedAt,
+		BeforePass:       report.Before.Tests.Passed,
+		AfterPass:        report.After.Tests.Passed,
+		DeltaLOC:         report.After.Metrics["lines_of_code"] - report.Before.Metrics["lines_of_code"],
+		DeltaComplexity:  report.After.Metrics["cyclomatic_complexity"] - report.Before.Metrics["cyclomatic_complexity"],
+		BuildTimeDeltaMS: report.After.Metrics["build_time_ms"] - report.Before.Metrics["build_time_ms"],
+		Gate:             report.Comparison.PassedGate,
 	}
 }
 
 func main() {
+	maxRegressionPercent := flag.Float64("max-regression", defaultMaxRegressionPercent,
+		"fail the gate if any benchmark's after-side mean ns/op regresses by more than this many percent, with p < 0.05")
+	sinkFlag := flag.String("sink", "csv",
+		"where to publish the run's history row: csv, sheets, or both")
+	testTimeout := flag.Duration("test-timeout", defaultTestTimeout,
+		"kill a repo's go test/go test -bench invocation if it runs longer than this")
+	buildTimeout := flag.Duration("build-timeout", defaultBuildTimeout,
+		"kill a repo's go build invocation if it runs longer than this")
+	flag.Parse()
+
 	// Create reports directory
 	reportsDir := "evaluation/reports"
 	err := os.MkdirAll(reportsDir, 0755)
@@ -257,10 +880,13 @@ func main() {
 		fmt.Printf("Error creating reports directory: %v\n", err)
 		os.Exit(1)
 	}
-	
+
 	// Run evaluation
-	report := runEvaluation()
-	
+	report := runEvaluation(context.Background(), *maxRegressionPercent, stageTimeouts{
+		test:  *testTimeout,
+		build: *buildTimeout,
+	})
+
 	// Handle any errors that occurred during evaluation
 	if report.Error != nil {
 		fmt.Printf("Evaluation error: %s\n", *report.Error)
@@ -301,7 +927,13 @@ func main() {
 	}
 	
 	fmt.Printf("Report written to %s\n", latestPath)
-	
+
+	// Publish a history row so the run can be graphed alongside every other
+	// dataset entry, not just compared against its own before/after.
+	if err := publishHistory(*sinkFlag, report); err != nil {
+		fmt.Printf("Error publishing history row: %v\n", err)
+	}
+
 	// Print summary
 	fmt.Printf("Evaluation Summary:\n")
 	fmt.Printf("  Before tests passed: %t\n", report.Before.Tests.Passed)
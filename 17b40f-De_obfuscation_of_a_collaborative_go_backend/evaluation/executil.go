@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// maxCapturedOutputBytes bounds how much of a subprocess's combined
+// stdout+stderr is held in memory at once. A runaway test or build that
+// emits gigabytes of output (an infinite retry loop, a binary dump) would
+// otherwise grow cmd.CombinedOutput's internal buffer without limit and OOM
+// the evaluator; capping collection as it streams in is cheaper than
+// buffering everything and truncating afterward.
+const maxCapturedOutputBytes = 10 * 1024 * 1024 // 10MB
+
+// boundedBuffer is an io.Writer that keeps the first limit bytes written to
+// it and silently discards the rest. It keeps the head of the stream rather
+// than the tail: go test -json's event stream must be parsed from the first
+// line forward, so losing the tail of a run to the cap just means
+// parseGoTestJSON sees fewer trailing events, while losing the head would
+// make the whole stream unparseable.
+type boundedBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func newBoundedBuffer(limit int) *boundedBuffer {
+	return &boundedBuffer{limit: limit}
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.buf) < b.limit {
+		remaining := b.limit - len(b.buf)
+		if remaining > len(p) {
+			remaining = len(p)
+		}
+		b.buf = append(b.buf, p[:remaining]...)
+	}
+	return len(p), nil
+}
+
+func (b *boundedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// runCapturingOutput starts cmd (which should already carry a context via
+// exec.CommandContext) and streams its stdout and stderr incrementally into
+// a shared boundedBuffer via StdoutPipe/StderrPipe, rather than buffering
+// the whole run in memory the way cmd.CombinedOutput does. It returns the
+// captured output, interleaved in whatever order the two pipes delivered
+// it, alongside cmd.Wait's error.
+func runCapturingOutput(cmd *exec.Cmd) (string, error) {
+	out := newBoundedBuffer(maxCapturedOutputBytes)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(out, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(out, stderr)
+	}()
+	wg.Wait()
+
+	err = cmd.Wait()
+	return out.String(), err
+}
@@ -0,0 +1,264 @@
+// Package metrics walks a repository's Go source with go/parser and go/ast
+// to compute complexity and obfuscation metrics, replacing the old
+// strings.Split line counter, which miscounted block comments, string
+// literals, and generated files.
+package metrics
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Report aggregates complexity metrics across every .go file in a repository.
+type Report struct {
+	SLOC                 float64
+	CyclomaticComplexity float64
+	CognitiveComplexity  float64
+	FunctionCount        float64
+	AverageFunctionLines float64
+	ExportedIdentifiers  float64
+	ObfuscationScore     float64
+}
+
+// Analyze walks repoPath and computes a Report across every .go file found,
+// skipping vendor directories. Files that fail to parse are skipped rather
+// than failing the whole walk, since a single malformed snapshot file
+// shouldn't block evaluation of the rest of the repo. ctx lets a caller
+// abandon the walk early -- e.g. when the per-repo evaluation timeout set
+// by runEvaluation's caller has already expired.
+func Analyze(ctx context.Context, repoPath string) Report {
+	fset := token.NewFileSet()
+
+	var (
+		sloc, cyclomatic, cognitive, funcCount, funcLines float64
+		totalIdents, shortIdents, exportedIdents          float64
+		discards, deadBranches                            float64
+	)
+
+	_ = filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.Contains(path, "vendor/") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil
+		}
+
+		sloc += countSLOC(fset, file)
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.FuncDecl:
+				if node.Body == nil {
+					return true
+				}
+				funcCount++
+				start := fset.Position(node.Body.Lbrace).Line
+				end := fset.Position(node.Body.Rbrace).Line
+				funcLines += float64(end - start)
+				cyclomatic += 1 + cyclomaticComplexity(node.Body)
+				cognitive += cognitiveComplexity(node.Body, 0)
+
+			case *ast.Ident:
+				totalIdents++
+				if len(node.Name) == 1 && node.Name != "_" {
+					shortIdents++
+				}
+				if node.IsExported() {
+					exportedIdents++
+				}
+
+			case *ast.AssignStmt:
+				if node.Tok == token.ASSIGN {
+					for _, lhs := range node.Lhs {
+						if id, ok := lhs.(*ast.Ident); ok && id.Name == "_" {
+							discards++
+						}
+					}
+				}
+
+			case *ast.IfStmt:
+				if lit, ok := node.Cond.(*ast.Ident); ok && lit.Name == "false" {
+					deadBranches++
+				}
+			}
+			return true
+		})
+
+		return nil
+	})
+
+	var obfuscationScore float64
+	if totalIdents > 0 {
+		obfuscationScore = shortIdents/totalIdents + 0.1*discards + 0.25*deadBranches
+	}
+
+	var avgFuncLines float64
+	if funcCount > 0 {
+		avgFuncLines = funcLines / funcCount
+	}
+
+	return Report{
+		SLOC:                 sloc,
+		CyclomaticComplexity: cyclomatic,
+		CognitiveComplexity:  cognitive,
+		FunctionCount:        funcCount,
+		AverageFunctionLines: avgFuncLines,
+		ExportedIdentifiers:  exportedIdents,
+		ObfuscationScore:     obfuscationScore,
+	}
+}
+
+// countSLOC counts non-blank, non-comment-only source lines by walking the
+// file's line offsets and skipping any line fully covered by a comment.
+func countSLOC(fset *token.FileSet, file *ast.File) float64 {
+	tokenFile := fset.File(file.Package)
+	lineCount := tokenFile.LineCount()
+
+	commentLines := make(map[int]bool)
+	for _, group := range file.Comments {
+		startLine := fset.Position(group.Pos()).Line
+		endLine := fset.Position(group.End()).Line
+		for l := startLine; l <= endLine; l++ {
+			commentLines[l] = true
+		}
+	}
+
+	src, err := os.ReadFile(tokenFile.Name())
+	if err != nil {
+		return 0
+	}
+	lines := strings.Split(string(src), "\n")
+
+	var sloc float64
+	for i := 1; i <= lineCount && i <= len(lines); i++ {
+		if commentLines[i] {
+			continue
+		}
+		if strings.TrimSpace(lines[i-1]) == "" {
+			continue
+		}
+		sloc++
+	}
+	return sloc
+}
+
+// cyclomaticComplexity implements the McCabe metric: each if, for, case, and
+// short-circuit && / || adds one decision point on top of the function's
+// base path.
+func cyclomaticComplexity(n ast.Node) float64 {
+	var complexity float64
+	ast.Inspect(n, func(node ast.Node) bool {
+		switch stmt := node.(type) {
+		case *ast.IfStmt:
+			complexity++
+		case *ast.ForStmt:
+			complexity++
+		case *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if len(stmt.List) > 0 {
+				complexity++
+			}
+		case *ast.CommClause:
+			complexity++
+		case *ast.BinaryExpr:
+			if stmt.Op == token.LAND || stmt.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
+
+// cognitiveComplexity follows the SonarSource model: structures that
+// interrupt the linear flow add 1 plus the current nesting level, so deeply
+// nested conditionals score higher than the same number of conditionals in
+// sequence.
+func cognitiveComplexity(n ast.Node, nesting float64) float64 {
+	var complexity float64
+	switch stmt := n.(type) {
+	case *ast.IfStmt:
+		complexity += 1 + nesting
+		complexity += cognitiveComplexity(stmt.Body, nesting+1)
+		if stmt.Else != nil {
+			complexity += cognitiveComplexity(stmt.Else, nesting)
+		}
+		return complexity
+	case *ast.ForStmt:
+		complexity += 1 + nesting
+		return complexity + cognitiveComplexity(stmt.Body, nesting+1)
+	case *ast.RangeStmt:
+		complexity += 1 + nesting
+		return complexity + cognitiveComplexity(stmt.Body, nesting+1)
+	case *ast.SwitchStmt:
+		complexity += 1 + nesting
+		return complexity + cognitiveComplexity(stmt.Body, nesting+1)
+	case *ast.BlockStmt:
+		for _, s := range stmt.List {
+			complexity += cognitiveComplexity(s, nesting)
+		}
+		return complexity
+	default:
+		return complexity
+	}
+}
+
+// IdentifierEntropyBits returns the Shannon entropy, in bits, of the
+// distribution of identifier-name lengths across a report's source --
+// de-obfuscated code tends to favor a handful of descriptive lengths, while
+// obfuscated code skews toward a narrow cluster of 1-2 character names.
+func IdentifierEntropyBits(ctx context.Context, repoPath string) float64 {
+	fset := token.NewFileSet()
+	lengthCounts := make(map[int]int)
+	var total int
+
+	_ = filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") || strings.Contains(path, "vendor/") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name != "_" {
+				lengthCounts[len(id.Name)]++
+				total++
+			}
+			return true
+		})
+		return nil
+	})
+
+	if total == 0 {
+		return 0
+	}
+
+	var entropy float64
+	for _, count := range lengthCounts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// SheetsReporter appends one row per run to a Google Sheet via a
+// service-account key, so history can be graphed without shipping the CSV
+// file around.
+type SheetsReporter struct {
+	SpreadsheetID string
+	// Range is the append target, e.g. "Sheet1!A:H" to match len(header).
+	Range string
+
+	svc *sheets.Service
+}
+
+// NewSheetsReporter builds a SheetsReporter authenticated with the
+// service-account JSON key at credentialsPath (normally the file
+// GOOGLE_APPLICATION_CREDENTIALS points at).
+func NewSheetsReporter(ctx context.Context, spreadsheetID, credentialsPath string) (*SheetsReporter, error) {
+	svc, err := sheets.NewService(ctx, option.WithCredentialsFile(credentialsPath))
+	if err != nil {
+		return nil, fmt.Errorf("sink: build sheets client: %w", err)
+	}
+	return &SheetsReporter{
+		SpreadsheetID: spreadsheetID,
+		Range:         "Sheet1!A:H",
+		svc:           svc,
+	}, nil
+}
+
+func (r *SheetsReporter) Publish(ctx context.Context, row Row) error {
+	record := toRecord(row)
+	values := make([]interface{}, len(record))
+	for i, v := range record {
+		values[i] = v
+	}
+
+	call := r.svc.Spreadsheets.Values.Append(r.SpreadsheetID, r.Range, &sheets.ValueRange{
+		Values: [][]interface{}{values},
+	})
+	call = call.ValueInputOption("RAW").InsertDataOption("INSERT_ROWS")
+
+	if _, err := call.Context(ctx).Do(); err != nil {
+		return fmt.Errorf("sink: append row to spreadsheet %s: %w", r.SpreadsheetID, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package sink publishes evaluation runs to a longitudinal store so the
+// one-shot latest.json/report.json snapshots can be graphed across the
+// full set of dataset entries instead of only compared pairwise.
+package sink
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// Row is one evaluation run, reduced to the handful of fields worth
+// tracking across history. It's deliberately smaller than EvaluationReport:
+// a CSV row (or spreadsheet row) isn't a good shape for the full nested
+// before/after metrics map, and history.csv is meant for graphing trends,
+// not replacing latest.json as the source of truth for a single run.
+type Row struct {
+	RunID            string
+	Timestamp        string
+	BeforePass       bool
+	AfterPass        bool
+	DeltaLOC         float64
+	DeltaComplexity  float64
+	BuildTimeDeltaMS float64
+	Gate             bool
+}
+
+// Reporter publishes a Row to a history sink. Publish must be safe to call
+// once per evaluation run; implementations append rather than overwrite.
+type Reporter interface {
+	Publish(ctx context.Context, row Row) error
+}
+
+// header lists the Row fields in column order, shared by every Reporter so
+// CSVReporter and SheetsReporter stay in lockstep.
+var header = []string{
+	"run_id", "timestamp", "before_pass", "after_pass",
+	"delta_loc", "delta_complexity", "build_time_delta_ms", "gate",
+}
+
+func toRecord(row Row) []string {
+	return []string{
+		row.RunID,
+		row.Timestamp,
+		fmt.Sprintf("%t", row.BeforePass),
+		fmt.Sprintf("%t", row.AfterPass),
+		fmt.Sprintf("%g", row.DeltaLOC),
+		fmt.Sprintf("%g", row.DeltaComplexity),
+		fmt.Sprintf("%g", row.BuildTimeDeltaMS),
+		fmt.Sprintf("%t", row.Gate),
+	}
+}
+
+// CSVReporter appends one row per run to a local CSV file, writing the
+// header only if the file doesn't already exist.
+type CSVReporter struct {
+	Path string
+}
+
+// NewCSVReporter returns a Reporter that appends to the CSV file at path,
+// creating it (and its parent directory) with a header row if needed.
+func NewCSVReporter(path string) *CSVReporter {
+	return &CSVReporter{Path: path}
+}
+
+func (r *CSVReporter) Publish(ctx context.Context, row Row) error {
+	_, err := os.Stat(r.Path)
+	needsHeader := os.IsNotExist(err)
+
+	f, err := os.OpenFile(r.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("sink: open %s: %w", r.Path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if needsHeader {
+		if err := w.Write(header); err != nil {
+			return fmt.Errorf("sink: write csv header: %w", err)
+		}
+	}
+	if err := w.Write(toRecord(row)); err != nil {
+		return fmt.Errorf("sink: write csv row: %w", err)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// MultiReporter fans a single Publish out to every configured Reporter,
+// returning the first error encountered but still attempting the rest so
+// one sink's outage (e.g. Sheets being unreachable) doesn't swallow a
+// successful local CSV append.
+type MultiReporter struct {
+	Reporters []Reporter
+}
+
+func (m *MultiReporter) Publish(ctx context.Context, row Row) error {
+	var firstErr error
+	for _, r := range m.Reporters {
+		if err := r.Publish(ctx, row); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -18,6 +29,13 @@ import (
 	"github.com/khallihub/godoc/dto"
 	"github.com/khallihub/godoc/middlewares"
 	"github.com/khallihub/godoc/service"
+	"github.com/khallihub/godoc/service/broker"
+	"github.com/khallihub/godoc/service/cache"
+	"github.com/khallihub/godoc/service/collab"
+	"github.com/khallihub/godoc/service/crdt"
+	"github.com/khallihub/godoc/service/replication"
+	"github.com/khallihub/godoc/service/wal"
+	"github.com/khallihub/godoc/service/watcher"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -27,17 +45,764 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// wsConfig bounds the read/write deadlines and ping/pong heartbeat cadence
+// handleWebSocket applies to every connection. See service/collab.
+var wsConfig = collab.DefaultWebSocketConfig()
+
+// armConnectionHeartbeat bounds how long a half-open connection can pin
+// its goroutine, cache entry, and slot in documentWS.Connections: without
+// a deadline, a peer that vanished without a TCP reset (frozen laptop,
+// dropped wifi) is indistinguishable from one that's just idle, since the
+// only other detection path is a failed write. cfg.PongWait bounds the
+// read deadline; every pong received pushes it back out. It starts a
+// goroutine that pings conn every cfg.PingInterval until either a ping
+// write fails or done is closed; the caller is expected to close done
+// when the connection's main loop exits. A peer that stops responding
+// lets the read deadline lapse, failing the next ReadMessage and running
+// the same cleanup path as any other closed socket.
+func armConnectionHeartbeat(conn *websocket.Conn, cfg collab.WebSocketConfig, done <-chan struct{}) {
+	conn.SetReadLimit(cfg.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	})
+
+	go func() {
+		ticker := time.NewTicker(cfg.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// authenticatedUserIDKey is the gin context key middlewares.AuthorizeJWT
+// sets to the caller's user ID once it validates their token. handleWebSocket
+// reads it to check ReadAccess/WriteAccess membership for the document
+// being opened.
+const authenticatedUserIDKey = "user_id"
+
+// containsUser reports whether userID appears in access, the ReadAccess or
+// WriteAccess list on a dto.Document.
+func containsUser(access []string, userID string) bool {
+	for _, candidate := range access {
+		if candidate == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigins returns the WebSocket Origin allowlist from the
+// comma-separated ALLOWED_ORIGINS environment variable.
+func allowedOrigins() []string {
+	raw := os.Getenv("ALLOWED_ORIGINS")
+	if raw == "" {
+		return nil
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(raw, ",") {
+		if trimmed := strings.TrimSpace(origin); trimmed != "" {
+			origins = append(origins, trimmed)
+		}
+	}
+	return origins
+}
+
+// checkOrigin replaces the previous "allow every origin" upgrader.CheckOrigin
+// default. With ALLOWED_ORIGINS unset, it falls back to same-origin requests
+// only, rather than staying wide open; setting ALLOWED_ORIGINS restricts it
+// to that explicit list ("*" allows any origin).
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Non-browser WebSocket clients don't send an Origin header at
+		// all; Origin is a browser-enforced protection, so there's
+		// nothing to check here.
+		return true
+	}
+
+	allowed := allowedOrigins()
+	if len(allowed) == 0 {
+		originURL, err := url.Parse(origin)
+		return err == nil && originURL.Host == r.Host
+	}
+
+	for _, candidate := range allowed {
+		if candidate == "*" || candidate == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// wsTicketTTL bounds how long a ticket minted by /documents/ws-ticket
+// stays valid -- long enough for the client to turn around and open the
+// WebSocket, short enough that a leaked ticket (e.g. in a proxy access
+// log) is worthless soon after.
+const wsTicketTTL = 30 * time.Second
+
+// wsTicketSecret is the HMAC key wsTicket{Mint,Verify} sign with, from the
+// WS_TICKET_SECRET environment variable. Unset means WebSocket upgrades
+// can never be authenticated -- see webSocketRequesterID, which fails
+// closed rather than accepting an unsigned ticket.
+func wsTicketSecret() []byte {
+	return []byte(os.Getenv("WS_TICKET_SECRET"))
+}
+
+// mintWebSocketTicket returns a ticket scoped to userID and documentID,
+// valid for wsTicketTTL, for the client to present on its next WebSocket
+// upgrade request (see webSocketRequesterID). The ticket is
+// base64(userID|documentID|expiry), HMAC-SHA256 signed with
+// wsTicketSecret -- a lighter-weight, purpose-built stand-in for a real
+// JWT here, since the actual JWT issuing/verification lives in
+// middlewares/service, outside this package.
+func mintWebSocketTicket(userID, documentID string) (string, error) {
+	secret := wsTicketSecret()
+	if len(secret) == 0 {
+		return "", fmt.Errorf("WS_TICKET_SECRET is not configured")
+	}
+
+	payload := fmt.Sprintf("%s|%s|%d", userID, documentID, time.Now().Add(wsTicketTTL).Unix())
+	encodedPayload := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+
+	return encodedPayload + "." + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyWebSocketTicket validates a ticket minted by mintWebSocketTicket
+// against documentID, returning the userID it was scoped to. It rejects a
+// malformed ticket, a bad signature, an expired one, or one minted for a
+// different document.
+func verifyWebSocketTicket(ticket, documentID string) (string, bool) {
+	secret := wsTicketSecret()
+	if len(secret) == 0 {
+		return "", false
+	}
+
+	parts := strings.SplitN(ticket, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	encodedPayload, signature := parts[0], parts[1]
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", false
+	}
+
+	fields := strings.SplitN(string(payload), "|", 3)
+	if len(fields) != 3 {
+		return "", false
+	}
+	userID, ticketDocumentID, expiryRaw := fields[0], fields[1], fields[2]
+	if ticketDocumentID != documentID {
+		return "", false
+	}
+
+	expiry, err := strconv.ParseInt(expiryRaw, 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", false
+	}
+
+	return userID, true
+}
+
+// webSocketRequesterID extracts and verifies the caller's identity for a
+// WebSocket upgrade request, from a ticket minted by /documents/ws-ticket.
+// It's carried either as a "ticket" query parameter, or as a
+// "ticket.<token>" entry in Sec-WebSocket-Protocol -- the only two places
+// a browser's WebSocket API lets a client attach anything beyond the bare
+// URL to the handshake.
+func webSocketRequesterID(ctx *gin.Context, documentID string) (string, bool) {
+	ticket := ctx.Query("ticket")
+	if ticket == "" {
+		for _, protocol := range websocket.Subprotocols(ctx.Request) {
+			if trimmed := strings.TrimPrefix(protocol, "ticket."); trimmed != protocol {
+				ticket = trimmed
+				break
+			}
+		}
+	}
+	if ticket == "" {
+		return "", false
+	}
+
+	return verifyWebSocketTicket(ticket, documentID)
+}
+
+// connMeta tags one upgraded connection with the identity and
+// write-permission established for it. canWrite starts as a snapshot
+// taken at upgrade time, then stays current with the live WriteAccess
+// recheck handleWebSocket's read loop already does on every edit frame,
+// so a collaborator demoted mid-session is reflected here too.
+type connMeta struct {
+	userID   string
+	canWrite bool
+}
+
+// unauthorizedWriteFrame is sent to a connection whose edit was rejected
+// for lacking WriteAccess, instead of dropping the connection -- a
+// read-only collaborator should keep receiving broadcasts, just not be
+// able to make edits stick.
+type unauthorizedWriteFrame struct {
+	Origin  string `json:"origin"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
 type DocumentWebSocket struct {
 	Connections map[*websocket.Conn]bool
 	Mutex       sync.Mutex
+
+	// StopBrokerSubscriber cancels the goroutine relaying this document's
+	// broker.Subscribe feed into Connections. It's set once, when the
+	// first local connection for a document is opened, and called when
+	// the last one closes -- see handleWebSocket.
+	StopBrokerSubscriber context.CancelFunc
+
+	// Presences holds the latest presence update from each connection
+	// that has sent one, keyed by the same *websocket.Conn as
+	// Connections. It's intentionally never persisted: a restart or a
+	// dropped connection simply loses it, which is correct for ephemeral
+	// state like a cursor position.
+	Presences map[*websocket.Conn]presenceState
 }
 
+// documentWebSockets is read and written from three independent goroutine
+// sources: the HTTP handler (handleWebSocket, on connect/disconnect), the
+// Raft FSM's OnApply callback (applyReplicatedRecord), and the MongoDB
+// change-stream watcher (applyWatcherEvent). Each *DocumentWebSocket's own
+// Mutex only guards that struct's fields, not the map itself, so the map
+// needs its own lock.
 var documentWebSockets = make(map[string]*DocumentWebSocket)
-var documentCache sync.Map
+var documentWebSocketsMutex sync.RWMutex
+
+// documentCache is assigned in main once documentController exists; every
+// package-level function that touches it only runs after the server starts
+// handling requests, so it's never read while nil. Its concrete type is
+// selected by CACHE_BACKEND (see initCacheStore): the default in-process
+// cache.DocumentCache, or cache.RedisStore so multiple instances behind a
+// load balancer share the same cached content instead of each holding its
+// own, independently evictable copy.
+var documentCache cache.Store
+
+// replicationCluster is nil unless RAFT_ENABLED=true. When set, document
+// mutations are submitted to it as Raft log entries instead of touching
+// documentCache directly; applyReplicatedRecord mirrors each committed
+// entry back into documentCache/documentCRDTs/documentWebSockets on every
+// node, leader and followers alike. See initReplication.
+var replicationCluster *replication.Cluster
+
+// documentBroker fans local document changes out to every other server
+// instance watching the same document (and relays theirs back in), so
+// replicas can run behind the load balancer without sticky sessions. It
+// defaults to a NoopBroker -- see initBroker -- so handleWebSocket never
+// needs a nil check.
+var documentBroker broker.Broker = broker.NewNoopBroker()
+
+// documentWAL is nil unless WAL_ENABLED=true. When set, handleWebSocket
+// appends each inbound change to it before broadcasting, and
+// syncDatabaseWithCache compacts it once a document's content is durably
+// flushed to Mongo -- see initWAL.
+var documentWAL *wal.WAL
+
+// documentCRDTs holds the per-document sequence CRDT that handleWebSocket
+// merges inbound ops into. documentCache still holds the *dto.Document used
+// by the REST handlers; its Data.Content is kept in sync with the CRDT's
+// materialized text so GetOneDocument etc. keep working unchanged.
+var documentCRDTs sync.Map
+
+// siteID identifies this server instance's own edits in CRDT operation
+// identifiers. It only needs to be unique among concurrently running
+// instances, not stable across restarts.
+var siteID = fmt.Sprintf("server-%d", os.Getpid())
 
 // Database and collection names
 var databaseName, usersCollection, documentsCollection = "godoc", "users", "documents"
 
+// syncHandshake is the first frame a client sends after the WebSocket
+// upgrade: its state vector of ops already applied locally. syncFrame is
+// used both for the server's handshake reply (the ops the client is
+// missing) and for every subsequent op exchange in the main loop.
+type syncHandshake struct {
+	Vector map[string]uint64 `json:"vector"`
+}
+
+type syncFrame struct {
+	Ops []crdt.Op `json:"ops"`
+}
+
+// inboundFrameEnvelope is peeked at first for every inbound message so the
+// main loop can tell a presence update apart from an edit, without forcing
+// every existing client to start tagging its edit frames with a type: a
+// missing or empty Type is treated as "edit" for backward compatibility
+// with the plain {"ops": [...]} frames clients already send.
+type inboundFrameEnvelope struct {
+	Type string `json:"type,omitempty"`
+}
+
+// presenceSelection is a caret position (From == To) or a selection range
+// within the document, in the same coordinate space the client's editor
+// uses -- the server never interprets these offsets, only relays them.
+type presenceSelection struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// presenceState is one connection's ephemeral collaboration state --
+// caret/selection, display name and color -- broadcast to every other
+// peer on the same document but never written to documentCache or Mongo.
+type presenceState struct {
+	UserID    string            `json:"userId"`
+	Name      string            `json:"name"`
+	Color     string            `json:"color"`
+	Selection presenceSelection `json:"selection"`
+}
+
+// presenceFrame carries a presence update over the wire in either
+// direction: a client sends one with Type "presence" to report its own
+// state, and the server rebroadcasts it verbatim (Type unchanged) to
+// every other connection on the document. Type "presence_leave" is
+// synthesized by the server, never sent by a client, when a connection
+// with known presence disconnects.
+type presenceFrame struct {
+	Type     string        `json:"type"`
+	Presence presenceState `json:"presence"`
+}
+
+// presenceSnapshotFrame is sent once, right after upgrade, so a newly
+// joined client immediately knows about every peer already present
+// instead of waiting for each of them to happen to move their cursor.
+type presenceSnapshotFrame struct {
+	Type      string          `json:"type"`
+	Presences []presenceState `json:"presences"`
+}
+
+// watcherFrame is pushed to a document's WebSocket connections when
+// DocumentWatcher reports a change made outside this process's normal
+// write path (an admin fix-up, another service, or a replica writing
+// straight to Mongo). Origin is always "server" -- it's what tells the
+// client this is a full refresh/eviction, not an incremental CRDT op.
+type watcherFrame struct {
+	Origin     string `json:"origin"`
+	Type       string `json:"type"`
+	DocumentID string `json:"documentId"`
+	Content    string `json:"content,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+func getOrCreateDocumentCRDT(documentID string) *crdt.Document {
+	existing, loaded := documentCRDTs.LoadOrStore(documentID, crdt.NewDocument(siteID))
+	if !loaded {
+		if cached, exists := documentCache.Load(documentID); exists {
+			seedCRDTFromContent(existing.(*crdt.Document), cached.Data.Content)
+		}
+	}
+	return existing.(*crdt.Document)
+}
+
+// seedCRDTFromContent gives a freshly created CRDT a starting sequence that
+// materializes to content, so a document loaded from Mongo before any
+// client connects still converges correctly once live edits start arriving.
+func seedCRDTFromContent(document *crdt.Document, content string) {
+	previous := crdt.Identifier{}
+	for _, ch := range content {
+		op := document.NextInsert(previous, string(ch))
+		document.Apply(op)
+		previous = op.ID
+	}
+}
+
+// initReplication builds the Raft cluster this node participates in from
+// environment variables. RAFT_NODE_ID and RAFT_BIND_ADDR are required;
+// RAFT_BOOTSTRAP=true marks the single node that forms a brand-new cluster,
+// and every other node joins it later through POST /admin/cluster/join.
+func initReplication() (*replication.Cluster, error) {
+	nodeID := os.Getenv("RAFT_NODE_ID")
+	bindAddr := os.Getenv("RAFT_BIND_ADDR")
+	if nodeID == "" || bindAddr == "" {
+		return nil, fmt.Errorf("RAFT_NODE_ID and RAFT_BIND_ADDR are required when RAFT_ENABLED=true")
+	}
+
+	dataDir := os.Getenv("RAFT_DATA_DIR")
+	if dataDir == "" {
+		dataDir = filepath.Join("raft-data", nodeID)
+	}
+
+	config := replication.Config{
+		NodeID:    nodeID,
+		BindAddr:  bindAddr,
+		DataDir:   dataDir,
+		Bootstrap: os.Getenv("RAFT_BOOTSTRAP") == "true",
+		HTTPAddr:  os.Getenv("RAFT_HTTP_ADDR"),
+	}
+
+	if raw := os.Getenv("RAFT_SNAPSHOT_THRESHOLD"); raw != "" {
+		if parsed, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			config.SnapshotThreshold = parsed
+		}
+	}
+	if raw := os.Getenv("RAFT_SNAPSHOT_INTERVAL_MINUTES"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			config.SnapshotInterval = time.Duration(parsed) * time.Minute
+		}
+	}
+
+	return replication.NewCluster(config)
+}
+
+// initBroker builds the Redis-backed Broker this node publishes document
+// changes through when REDIS_ENABLED=true. REDIS_ADDR defaults to
+// localhost:6379; REDIS_PASSWORD and REDIS_DB are optional. Deployments
+// that don't set REDIS_ENABLED keep the default NoopBroker, so a single
+// standalone instance never needs Redis at all.
+func initBroker() (broker.Broker, error) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	db := 0
+	if raw := os.Getenv("REDIS_DB"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			db = parsed
+		}
+	}
+
+	return broker.NewRedisBroker(addr, os.Getenv("REDIS_PASSWORD"), db)
+}
+
+// subscribeToBrokerChanges relays every change documentBroker delivers for
+// documentID into documentWS's local connections, until ctx is cancelled
+// (see DocumentWebSocket.StopBrokerSubscriber). Messages this instance
+// published itself come back through the same subscription, so they're
+// dropped by comparing OriginID against siteID -- otherwise every local
+// edit would echo back and get rebroadcast a second time.
+func subscribeToBrokerChanges(ctx context.Context, documentID string, documentWS *DocumentWebSocket) {
+	messages, err := documentBroker.Subscribe(ctx, documentID)
+	if err != nil {
+		log.Println("Error subscribing to broker for document:", documentID, err)
+		return
+	}
+
+	for message := range messages {
+		if message.OriginID == siteID || len(message.Ops) == 0 {
+			continue
+		}
+
+		for _, op := range message.Ops {
+			getOrCreateDocumentCRDT(documentID).Apply(op)
+		}
+		if document, exists := documentCache.Load(documentID); exists {
+			document.Data = dto.DocumentData{Content: getOrCreateDocumentCRDT(documentID).Materialize()}
+			documentCache.Store(documentID, document)
+		}
+
+		documentWS.Mutex.Lock()
+		for clientConn := range documentWS.Connections {
+			if clientConn.WriteJSON(syncFrame{Ops: message.Ops}) != nil {
+				log.Println("Error writing broker-relayed op to peer connection")
+				clientConn.Close()
+				delete(documentWS.Connections, clientConn)
+			}
+		}
+		documentWS.Mutex.Unlock()
+	}
+}
+
+// initCacheStore builds the documentCache backend selected by CACHE_BACKEND:
+// "redis" dials REDIS_ADDR/REDIS_PASSWORD/REDIS_DB (the same settings
+// initBroker uses for the pub/sub broker) and returns a cache.RedisStore so
+// every instance behind the load balancer shares the same cached content;
+// anything else, including unset, keeps the single-node cache.DocumentCache
+// bounded by maxBytes. The Redis broker already fans CRDT ops out across
+// replicas for live WebSocket clients -- CACHE_BACKEND=redis additionally
+// shares the materialized document content itself, which matters for a
+// replica that opens a document it hasn't seen any ops for yet.
+func initCacheStore(maxBytes int, flusher cache.Flusher) (cache.Store, error) {
+	if os.Getenv("CACHE_BACKEND") != "redis" {
+		return cache.New(maxBytes, flusher), nil
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	db := 0
+	if raw := os.Getenv("REDIS_DB"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			db = parsed
+		}
+	}
+
+	return cache.NewRedisStore(addr, os.Getenv("REDIS_PASSWORD"), db, flusher)
+}
+
+// initWAL opens the write-ahead log from WAL_* environment variables.
+// WAL_DATA_DIR defaults to "wal-data"; WAL_SEGMENT_SIZE_BYTES and
+// WAL_FSYNC_POLICY ("always"/"interval"/"os", default "os") bound how much
+// an unflushed segment can grow and how aggressively it's synced.
+// WAL_FSYNC_INTERVAL_MS only applies when the policy is "interval".
+func initWAL() (*wal.WAL, error) {
+	dataDir := os.Getenv("WAL_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "wal-data"
+	}
+
+	options := wal.Options{DataDir: dataDir, Fsync: wal.FsyncPolicy(os.Getenv("WAL_FSYNC_POLICY"))}
+
+	if raw := os.Getenv("WAL_SEGMENT_SIZE_BYTES"); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			options.SegmentSize = parsed
+		}
+	}
+	if raw := os.Getenv("WAL_FSYNC_INTERVAL_MS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			options.FsyncInterval = time.Duration(parsed) * time.Millisecond
+		}
+	}
+
+	return wal.Open(options)
+}
+
+// recoverFromWAL flushes every document's WAL tail straight to Mongo via
+// documentController.UpdateDocument, then compacts it -- so edits
+// acknowledged to a client just before a crash aren't lost even though
+// documentCache itself is rebuilt lazily (see initializeDocumentCache) and
+// never needs to know about the WAL directly.
+func recoverFromWAL(documentWAL *wal.WAL, documentController controller.DocumentController) {
+	recovered, err := documentWAL.Replay()
+	if err != nil {
+		fmt.Println("Error replaying WAL:", err)
+		return
+	}
+
+	for documentID, content := range recovered {
+		if err := documentController.UpdateDocument(documentID, dto.DocumentData{Content: content}); err != nil {
+			fmt.Println("Error recovering document from WAL:", documentID, err)
+			continue
+		}
+		if offset, exists := documentWAL.LatestOffset(documentID); exists {
+			if err := documentWAL.Compact(documentID, offset); err != nil {
+				fmt.Println("Error compacting WAL after recovery:", documentID, err)
+			}
+		}
+	}
+}
+
+// flushInterval controls how often updateDatabaseWithCache flushes
+// documentCache to Mongo. FLUSH_INTERVAL_SECONDS defaults to 30.
+func flushInterval() time.Duration {
+	if raw := os.Getenv("FLUSH_INTERVAL_SECONDS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			return time.Duration(parsed) * time.Second
+		}
+	}
+	return 30 * time.Second
+}
+
+// shutdownTimeout bounds how long graceful shutdown waits on
+// httpServer.Shutdown and the final drainForShutdown call, each
+// independently, before main gives up and exits anyway.
+// SHUTDOWN_TIMEOUT_SECONDS defaults to 10.
+func shutdownTimeout() time.Duration {
+	if raw := os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			return time.Duration(parsed) * time.Second
+		}
+	}
+	return 10 * time.Second
+}
+
+// initDocumentWatcher builds a DocumentWatcher over the documents
+// collection. CHANGE_STREAM_RESUME_TOKEN_PATH defaults to
+// "changestream-resume-token.json" in the working directory; it only
+// matters across restarts, so a fresh path just means the watcher starts
+// from the current moment instead of replaying missed events.
+func initDocumentWatcher(mongoClient *mongo.Client) *watcher.DocumentWatcher {
+	resumeTokenPath := os.Getenv("CHANGE_STREAM_RESUME_TOKEN_PATH")
+	if resumeTokenPath == "" {
+		resumeTokenPath = "changestream-resume-token.json"
+	}
+
+	collection := mongoClient.Database(databaseName).Collection(documentsCollection)
+	documentWatcher := watcher.New(collection, resumeTokenPath)
+	documentWatcher.IsWatched = func(documentID string) bool {
+		_, exists := documentCache.Load(documentID)
+		return exists
+	}
+	documentWatcher.OnEvent = applyWatcherEvent
+	return documentWatcher
+}
+
+// applyWatcherEvent refreshes or evicts documentCache for an out-of-band
+// change DocumentWatcher observed, and pushes a watcherFrame to any local
+// WebSocket connections for that document so open clients don't keep
+// showing stale content until the connection is torn down. It deliberately
+// does not touch documentCRDTs: the next op a client sends re-seeds from
+// the refreshed cache content via getOrCreateDocumentCRDT's existing path
+// once the document's CRDT is next recreated.
+func applyWatcherEvent(event watcher.Event) {
+	switch event.Type {
+	case watcher.EventUpdate, watcher.EventReplace:
+		document, exists := documentCache.Load(event.DocumentID)
+		if !exists {
+			return
+		}
+		document.Data = dto.DocumentData{Content: event.Content}
+		document.Title = event.Title
+		documentCache.Store(event.DocumentID, document)
+		documentCRDTs.Delete(event.DocumentID)
+	case watcher.EventDelete:
+		documentCache.Delete(event.DocumentID)
+		documentCRDTs.Delete(event.DocumentID)
+	}
+
+	documentWebSocketsMutex.RLock()
+	documentWS, exists := documentWebSockets[event.DocumentID]
+	documentWebSocketsMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	frame := watcherFrame{
+		Origin:     "server",
+		Type:       string(event.Type),
+		DocumentID: event.DocumentID,
+		Content:    event.Content,
+		Title:      event.Title,
+	}
+
+	documentWS.Mutex.Lock()
+	defer documentWS.Mutex.Unlock()
+	for clientConn := range documentWS.Connections {
+		if clientConn.WriteJSON(frame) != nil {
+			log.Println("Error writing watcher frame to peer connection")
+			clientConn.Close()
+			delete(documentWS.Connections, clientConn)
+		}
+	}
+}
+
+// registerSelfOnceLeader republishes this node's HTTP address every time it
+// becomes the Raft leader, so LeaderHTTPAddress resolves correctly on every
+// other node even across leadership changes (not just for the node that
+// bootstrapped the cluster, which never goes through Join).
+func registerSelfOnceLeader(cluster *replication.Cluster, httpAddr string) {
+	if httpAddr == "" {
+		return
+	}
+
+	wasLeader := false
+	for range time.Tick(2 * time.Second) {
+		isLeader := cluster.IsLeader()
+		if isLeader && !wasLeader {
+			if err := cluster.RegisterSelf(httpAddr); err != nil {
+				fmt.Println("Error registering self with cluster:", err)
+			}
+		}
+		wasLeader = isLeader
+	}
+}
+
+// applyReplicatedRecord mirrors a Raft-committed document record into this
+// node's documentCache and, for CRDT ops, into its local CRDT and active
+// WebSocket connections. It runs on every node -- leader and followers --
+// which is what lets a follower keep serving reads and broadcasting live
+// edits for a document it never received a direct write for. On the node
+// that originated a CRDT op this duplicates the broadcast handleWebSocket
+// already did locally; that's an accepted trade-off for having one
+// mirroring path instead of two.
+func applyReplicatedRecord(documentID string, record replication.DocumentRecord) {
+	document, exists := documentCache.Load(documentID)
+	if !exists {
+		document = &dto.Document{}
+	}
+	document.Data = dto.DocumentData{Content: record.Content}
+	document.Title = record.Title
+	document.ReadAccess = record.ReadAccess
+	document.WriteAccess = record.WriteAccess
+	documentCache.Store(documentID, document)
+	// Every node applies the same committed record (see the doc comment
+	// above), so every node also marks it dirty here -- otherwise, with
+	// Raft enabled, syncDatabaseWithCache's dirty-only flush would never
+	// see a reason to persist it to Mongo at all.
+	documentCache.MarkDirty(documentID)
+
+	if len(record.OpLogTail) == 0 {
+		return
+	}
+
+	newestOp := record.OpLogTail[len(record.OpLogTail)-1]
+	getOrCreateDocumentCRDT(documentID).Apply(newestOp)
+
+	documentWebSocketsMutex.RLock()
+	documentWS, exists := documentWebSockets[documentID]
+	documentWebSocketsMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	documentWS.Mutex.Lock()
+	defer documentWS.Mutex.Unlock()
+	for clientConn := range documentWS.Connections {
+		if clientConn.WriteJSON(syncFrame{Ops: []crdt.Op{newestOp}}) != nil {
+			log.Println("Error writing replicated op to peer connection")
+			clientConn.Close()
+			delete(documentWS.Connections, clientConn)
+		}
+	}
+}
+
+// leaderForwardMiddleware makes every node in the Raft cluster accept
+// /documents/* writes: a follower reverse-proxies the request to the
+// current leader instead of rejecting it, so clients don't need to track
+// which node is currently leading.
+func leaderForwardMiddleware(cluster *replication.Cluster) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if cluster == nil || cluster.IsLeader() {
+			ctx.Next()
+			return
+		}
+
+		leaderHTTPAddr, exists := cluster.LeaderHTTPAddress()
+		if !exists {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"message": "no raft leader elected"})
+			ctx.Abort()
+			return
+		}
+
+		target, err := url.Parse("http://" + leaderHTTPAddr)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "invalid leader address"})
+			ctx.Abort()
+			return
+		}
+
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(ctx.Writer, ctx.Request)
+		ctx.Abort()
+	}
+}
+
 func main() {
 	// Load environment variables
 	err := godotenv.Load()
@@ -118,13 +883,195 @@ func main() {
 	documentService := service.NewDocumentService(mongoClient, databaseName, documentsCollection)
 	documentController := controller.NewDocumentController(documentService)
 
+	// Document cache. DOCUMENT_CACHE_MAX_BYTES defaults to 64MiB and only
+	// bounds the default in-process backend (see initCacheStore): a burst
+	// of unique document opens beyond that evicts the least-recently-used
+	// entry, flushing it to Mongo first so nothing is lost. CACHE_BACKEND=
+	// redis switches to cache.RedisStore instead, which has no such budget
+	// -- Redis bounds its own memory via its configured eviction policy.
+	cacheMaxBytes := int64(64 << 20)
+	if raw := os.Getenv("DOCUMENT_CACHE_MAX_BYTES"); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed > 0 {
+			cacheMaxBytes = parsed
+		}
+	}
+	cacheStore, err := initCacheStore(int(cacheMaxBytes), documentController)
+	if err != nil {
+		fmt.Println("Error initializing document cache:", err)
+		return
+	}
+	documentCache = cacheStore
+
+	// Write-ahead log (optional). When enabled, handleWebSocket appends
+	// every inbound change before broadcasting it, closing the up-to-30s
+	// data-loss window a crash between flush ticks would otherwise leave.
+	// See initWAL, recoverFromWAL and syncDatabaseWithCache.
+	if os.Getenv("WAL_ENABLED") == "true" {
+		openedWAL, err := initWAL()
+		if err != nil {
+			fmt.Println("Error opening WAL:", err)
+			return
+		}
+		documentWAL = openedWAL
+		recoverFromWAL(documentWAL, documentController)
+		fmt.Println("Write-ahead log enabled")
+	}
+
+	// Raft replication (optional). When enabled, document mutations are
+	// committed through replicationCluster instead of writing documentCache
+	// directly; applyReplicatedRecord mirrors each commit back into the
+	// cache/CRDT/WebSocket state on every node. See initReplication.
+	if os.Getenv("RAFT_ENABLED") == "true" {
+		cluster, err := initReplication()
+		if err != nil {
+			fmt.Println("Error starting replication cluster:", err)
+			return
+		}
+		replicationCluster = cluster
+		replicationCluster.OnApply(applyReplicatedRecord)
+		go registerSelfOnceLeader(replicationCluster, os.Getenv("RAFT_HTTP_ADDR"))
+		fmt.Println("Raft replication enabled, node id:", os.Getenv("RAFT_NODE_ID"))
+	}
+
+	// Redis broker (optional). When enabled, local document edits are
+	// published to Redis and a per-document subscriber goroutine relays
+	// other instances' edits into this instance's local WebSocket
+	// connections -- see initBroker and subscribeToBrokerChanges.
+	if os.Getenv("REDIS_ENABLED") == "true" {
+		redisBroker, err := initBroker()
+		if err != nil {
+			fmt.Println("Error connecting to broker:", err)
+			return
+		}
+		documentBroker = redisBroker
+		fmt.Println("Redis broker enabled")
+	}
+
+	// MongoDB change-stream watcher (optional). Keeps documentCache from
+	// going stale between syncDatabaseWithCache ticks when something other
+	// than this process's normal write path changes a cached document.
+	// Requires a replica-set-backed MongoDB, so it stays off by default.
+	if os.Getenv("CHANGE_STREAM_ENABLED") == "true" {
+		documentWatcher := initDocumentWatcher(mongoClient)
+		go func() {
+			if err := documentWatcher.Run(context.Background()); err != nil {
+				fmt.Println("Error running document watcher:", err)
+			}
+		}()
+		fmt.Println("MongoDB change-stream watcher enabled")
+	}
+
+	// WAL lag metric: only meaningful when WAL_ENABLED=true, so operators
+	// can detect a stalled flusher before a crash turns the lag into lost
+	// edits.
+	router.GET("/admin/wal/lag", func(ctx *gin.Context) {
+		if documentWAL == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "WAL is not enabled on this node"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"lag": documentWAL.LagByDocument()})
+	})
+
+	// Cluster admin routes: only meaningful when RAFT_ENABLED=true, but
+	// registered unconditionally so a misconfigured node returns a clear
+	// 404 instead of nothing.
+	adminRoutes := router.Group("/admin/cluster")
+	{
+		adminRoutes.POST("/join", func(ctx *gin.Context) {
+			if replicationCluster == nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"message": "replication is not enabled on this node"})
+				return
+			}
+
+			var request struct {
+				NodeID   string `json:"node_id"`
+				RaftAddr string `json:"raft_addr"`
+				HTTPAddr string `json:"http_addr"`
+			}
+			if ctx.BindJSON(&request) != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+				return
+			}
+
+			if err := replicationCluster.Join(request.NodeID, request.RaftAddr, request.HTTPAddr); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{"message": "joined"})
+		})
+
+		adminRoutes.POST("/leave", func(ctx *gin.Context) {
+			if replicationCluster == nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"message": "replication is not enabled on this node"})
+				return
+			}
+
+			var request struct {
+				NodeID string `json:"node_id"`
+			}
+			if ctx.BindJSON(&request) != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+				return
+			}
+
+			if err := replicationCluster.Leave(request.NodeID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{"message": "left"})
+		})
+	}
+
+	// The WebSocket upgrade can't sit behind middlewares.AuthorizeJWT() like
+	// the rest of /documents: a browser has no way to set an Authorization
+	// header on a WebSocket handshake request. It authenticates itself
+	// instead with a ticket minted by /documents/ws-ticket (below, which is
+	// a normal header-authenticated REST call) and presented on this
+	// request -- see webSocketRequesterID and handleWebSocket.
+	router.GET("/documents/handler", func(ctx *gin.Context) {
+		documentID := ctx.Query("document_id")
+		handleWebSocket(ctx, documentID, documentController)
+	})
+
 	// Document routes (protected)
 	documentRoutes := router.Group("/documents")
 	documentRoutes.Use(middlewares.AuthorizeJWT())
 	{
-		documentRoutes.GET("/handler", func(ctx *gin.Context) {
+		// Mints a short-lived ticket authorizing its caller to open a
+		// WebSocket for document_id, since the upgrade request itself
+		// can't carry the normal Authorization header. Requires ReadAccess
+		// up front so a ticket is never minted for a document the caller
+		// couldn't open anyway; handleWebSocket still re-resolves and
+		// re-checks ReadAccess itself rather than trusting the ticket
+		// alone.
+		documentRoutes.POST("/ws-ticket", func(ctx *gin.Context) {
 			documentID := ctx.Query("document_id")
-			handleWebSocket(ctx, documentID, documentController)
+			if documentID == "" {
+				ctx.JSON(http.StatusBadRequest, gin.H{"message": "document_id is required"})
+				return
+			}
+
+			userID, _ := ctx.Get(authenticatedUserIDKey)
+			requesterID, _ := userID.(string)
+
+			documentRecord, err := fetchDocumentCoalesced(documentID, func() (*dto.Document, error) {
+				return documentController.GetOneDocument(ctx)
+			})
+			if err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"message": "document not found"})
+				return
+			}
+			if !containsUser(documentRecord.ReadAccess, requesterID) {
+				ctx.JSON(http.StatusForbidden, gin.H{"message": "not authorized to read this document"})
+				return
+			}
+
+			ticket, err := mintWebSocketTicket(requesterID, documentID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{"ticket": ticket})
 		})
 
 		documentRoutes.POST("/getall", func(ctx *gin.Context) {
@@ -144,10 +1091,6 @@ func main() {
 			ctx.JSON(http.StatusOK, gin.H{"documents": documents})
 		})
 
-		documentRoutes.POST("/createnew", func(ctx *gin.Context) {
-			documentController.CreateNewDocument(ctx)
-		})
-
 		documentRoutes.POST("/getone/:id", func(ctx *gin.Context) {
 			document, err := initializeDocumentCache(ctx, documentController)
 			if err != nil {
@@ -157,28 +1100,117 @@ func main() {
 			ctx.JSON(http.StatusOK, document)
 		})
 
-		documentRoutes.POST("/updatetitle", func(ctx *gin.Context) {
-			title, documentID := documentController.UpdateTitle(ctx)
-			updateDocumentTitleCacheAttribute(documentID, title)
-		})
+		// Lets a late-joining client catch up on missed ops over plain
+		// REST instead of opening a WebSocket just to run the handshake
+		// handleWebSocket already does inline -- e.g. a client that polls
+		// while reconnecting, or one resuming after its socket dropped.
+		// "since" is the client's state vector (the same shape
+		// syncHandshake.Vector uses), JSON-encoded; an empty/missing value
+		// is treated as "nothing seen yet" and returns the full op log.
+		documentRoutes.GET("/ops", func(ctx *gin.Context) {
+			documentID := ctx.Query("document_id")
+			if documentID == "" {
+				ctx.JSON(http.StatusBadRequest, gin.H{"message": "document_id is required"})
+				return
+			}
 
-		documentRoutes.POST("/updatecollaborators", func(ctx *gin.Context) {
-			document := documentController.UpdateCollaborators(ctx)
-			access := &dto.Access{
-				ID:          document.ID,
-				ReadAccess:  document.ReadAccess,
-				WriteAccess: document.WriteAccess,
+			var since map[string]uint64
+			if raw := ctx.Query("since"); raw != "" {
+				if json.Unmarshal([]byte(raw), &since) != nil {
+					ctx.JSON(http.StatusBadRequest, gin.H{"message": "since must be a JSON-encoded state vector"})
+					return
+				}
 			}
-			updateDocumentCacheAttribute(document.ID, documentController, *access)
+
+			document := getOrCreateDocumentCRDT(documentID)
+			ctx.JSON(http.StatusOK, gin.H{
+				"ops":    document.OpsSince(since),
+				"vector": document.StateVector(),
+			})
 		})
 
-		documentRoutes.DELETE("/delete/:id", func(ctx *gin.Context) {
-			documentController.DeleteDocument(ctx)
+		// Debugging aid: inspect who's currently present on a document
+		// and where their cursor is, without needing to open a WebSocket
+		// and watch frames go by.
+		documentRoutes.GET("/presence", func(ctx *gin.Context) {
+			documentID := ctx.Query("document_id")
+			if documentID == "" {
+				ctx.JSON(http.StatusBadRequest, gin.H{"message": "document_id is required"})
+				return
+			}
+
+			documentWebSocketsMutex.RLock()
+			documentWS, exists := documentWebSockets[documentID]
+			documentWebSocketsMutex.RUnlock()
+			if !exists {
+				ctx.JSON(http.StatusOK, gin.H{"presences": []presenceState{}})
+				return
+			}
+
+			documentWS.Mutex.Lock()
+			presences := make([]presenceState, 0, len(documentWS.Presences))
+			for _, presence := range documentWS.Presences {
+				presences = append(presences, presence)
+			}
+			documentWS.Mutex.Unlock()
+
+			ctx.JSON(http.StatusOK, gin.H{"presences": presences})
 		})
+
+		// Mutating routes only: a follower forwards these to the current
+		// Raft leader instead of handling them locally, so any node can
+		// accept a /documents/* write.
+		documentWriteRoutes := documentRoutes.Group("")
+		documentWriteRoutes.Use(leaderForwardMiddleware(replicationCluster))
+		{
+			documentWriteRoutes.POST("/createnew", func(ctx *gin.Context) {
+				documentController.CreateNewDocument(ctx)
+			})
+
+			documentWriteRoutes.POST("/updatetitle", func(ctx *gin.Context) {
+				title, documentID := documentController.UpdateTitle(ctx)
+				if replicationCluster != nil {
+					command := replication.Command{Type: replication.CommandUpdateTitle, DocumentID: documentID, Title: title}
+					if err := replicationCluster.Apply(command, 5*time.Second); err != nil {
+						fmt.Println("Error replicating title update:", err)
+					}
+					return
+				}
+				updateDocumentTitleCacheAttribute(documentID, title)
+			})
+
+			documentWriteRoutes.POST("/updatecollaborators", func(ctx *gin.Context) {
+				document := documentController.UpdateCollaborators(ctx)
+				access := &dto.Access{
+					ID:          document.ID,
+					ReadAccess:  document.ReadAccess,
+					WriteAccess: document.WriteAccess,
+				}
+				if replicationCluster != nil {
+					command := replication.Command{
+						Type:        replication.CommandUpdateCollaborators,
+						DocumentID:  access.ID,
+						ReadAccess:  access.ReadAccess,
+						WriteAccess: access.WriteAccess,
+					}
+					if err := replicationCluster.Apply(command, 5*time.Second); err != nil {
+						fmt.Println("Error replicating collaborators update:", err)
+					}
+					return
+				}
+				updateDocumentCacheAttribute(document.ID, documentController, *access)
+			})
+
+			documentWriteRoutes.DELETE("/delete/:id", func(ctx *gin.Context) {
+				documentController.DeleteDocument(ctx)
+			})
+		}
 	}
 
-	// Start background database sync
-	updateDatabaseWithCache(documentController)
+	// Start background database sync. flushTickerDone is closed on shutdown
+	// (see below) so the ticker's goroutine doesn't outlive the server.
+	flushTickerDone := make(chan struct{})
+	flushTicker := updateDatabaseWithCache(documentController, flushTickerDone)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -186,19 +1218,102 @@ func main() {
 		port = "8080"
 	}
 
-	// Start server
-	router.Run("0.0.0.0:" + port)
+	// Run behind an *http.Server rather than router.Run so SIGTERM can
+	// trigger a graceful shutdown: stop accepting new connections, push
+	// every live WebSocket a close frame, flush every dirty document
+	// cached since the last sync tick, and stop the sync ticker -- in that
+	// order -- before the process exits, so a rolling deploy doesn't lose
+	// up to flushInterval() worth of edits or leak the ticker's goroutine.
+	// SHUTDOWN_TIMEOUT_SECONDS bounds the HTTP shutdown and the final
+	// flush independently, defaulting to 10s each (see shutdownTimeout).
+	httpServer := &http.Server{Addr: "0.0.0.0:" + port, Handler: router}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// idleConnsClosed is closed once the shutdown goroutine below has
+	// finished every step, so main blocks on it before returning --
+	// otherwise the deferred mongoClient.Disconnect above could run while
+	// the final flush is still writing to Mongo, since ListenAndServe
+	// returns as soon as Shutdown closes the listener, not once shutdown
+	// is entirely done.
+	idleConnsClosed := make(chan struct{})
+	go func() {
+		<-signalChan
+		fmt.Println("Shutdown signal received, draining connections and flushing cache...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			fmt.Println("Error shutting down HTTP server:", err)
+		}
+
+		broadcastShutdownClose()
+
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancelFlush()
+		if err := drainForShutdown(flushCtx, documentController); err != nil {
+			fmt.Println("Error flushing document cache on shutdown:", err)
+		}
+
+		close(flushTickerDone)
+		flushTicker.Stop()
+
+		close(idleConnsClosed)
+	}()
+
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Println("Error running HTTP server:", err)
+	}
+	<-idleConnsClosed
 }
 
 func handleWebSocket(ctx *gin.Context, documentID string, documentController controller.DocumentController) {
 	fmt.Println("Handling WebSocket connection for document:", documentID)
 	fmt.Println("Connection handled by server running on port:", os.Getenv("PORT"))
 
-	// Configure WebSocket upgrader
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
+	// A WebSocket connection is long-lived, so unlike the REST writes it
+	// isn't worth reverse-proxying frame by frame -- redirect the client to
+	// the leader's HTTP address up front instead, before the upgrade.
+	if replicationCluster != nil && !replicationCluster.IsLeader() {
+		leaderHTTPAddr, exists := replicationCluster.LeaderHTTPAddress()
+		if !exists {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"message": "no raft leader elected"})
+			return
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, "http://"+leaderHTTPAddr+ctx.Request.URL.RequestURI())
+		return
 	}
 
+	// This route sits outside middlewares.AuthorizeJWT() (see main) since a
+	// browser can't set an Authorization header on a WebSocket handshake;
+	// the caller instead proves its identity with a ticket minted by
+	// /documents/ws-ticket.
+	requesterID, authenticated := webSocketRequesterID(ctx, documentID)
+	if !authenticated {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "missing or invalid websocket ticket"})
+		return
+	}
+
+	// Reject a document this caller can't even read before upgrading at
+	// all, rather than opening the socket and only then discovering they
+	// don't belong.
+	documentRecord, err := fetchDocumentCoalesced(documentID, func() (*dto.Document, error) {
+		return documentController.GetOneDocument(ctx)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "document not found"})
+		return
+	}
+	if !containsUser(documentRecord.ReadAccess, requesterID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "not authorized to read this document"})
+		return
+	}
+	meta := connMeta{userID: requesterID, canWrite: containsUser(documentRecord.WriteAccess, requesterID)}
+
+	// Configure WebSocket upgrader
+	upgrader.CheckOrigin = checkOrigin
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
@@ -207,40 +1322,118 @@ func handleWebSocket(ctx *gin.Context, documentID string, documentController con
 	}
 	defer conn.Close()
 
-	// Get or create document WebSocket handler
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	armConnectionHeartbeat(conn, wsConfig, pingDone)
+
+	// Get or create document WebSocket handler. The whole check-then-create
+	// runs under a single write lock so two connections racing to be the
+	// first for a document can't each create (and silently clobber) their
+	// own DocumentWebSocket.
+	documentWebSocketsMutex.Lock()
 	documentWS, exists := documentWebSockets[documentID]
 	if !exists {
 		documentWS = &DocumentWebSocket{
 			Connections: make(map[*websocket.Conn]bool),
+			Presences:   make(map[*websocket.Conn]presenceState),
 		}
 		documentWebSockets[documentID] = documentWS
+
+		// First local connection for this document -- start relaying the
+		// other instances' changes in until the last one disconnects.
+		subscriberCtx, stopSubscriber := context.WithCancel(context.Background())
+		documentWS.StopBrokerSubscriber = stopSubscriber
+		go subscribeToBrokerChanges(subscriberCtx, documentID, documentWS)
 	}
+	documentWebSocketsMutex.Unlock()
 
-	fmt.Println("Number of active connections:", len(documentWebSockets[documentID].Connections)+1)
+	fmt.Println("Number of active connections:", len(documentWS.Connections)+1)
 
 	// Add connection to document WebSocket handler
 	documentWS.Mutex.Lock()
 	documentWS.Connections[conn] = true
 	documentWS.Mutex.Unlock()
 
-	// Create cleanup channel
-	disconnectChan := make(chan *websocket.Conn, 1)
+	document := getOrCreateDocumentCRDT(documentID)
+
+	// State-vector handshake: the client announces what it's already seen,
+	// and we reply with only the ops it's missing, so a late joiner
+	// converges without pulling a full document snapshot.
+	_, handshakeBytes, err := conn.ReadMessage()
+	if err != nil {
+		log.Println("Error reading sync handshake:", err)
+		return
+	}
+
+	var handshake syncHandshake
+	if json.Unmarshal(handshakeBytes, &handshake) != nil {
+		log.Println("Error unmarshalling sync handshake:", err)
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+	if err := conn.WriteJSON(syncFrame{Ops: document.OpsSince(handshake.Vector)}); err != nil {
+		log.Println("Error sending sync frame:", err)
+		return
+	}
+
+	// Let the new client know about every peer already present, so it
+	// doesn't have to wait for each of them to happen to move their
+	// cursor before seeing them.
+	documentWS.Mutex.Lock()
+	snapshot := make([]presenceState, 0, len(documentWS.Presences))
+	for _, presence := range documentWS.Presences {
+		snapshot = append(snapshot, presence)
+	}
+	documentWS.Mutex.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+	if err := conn.WriteJSON(presenceSnapshotFrame{Type: "presence_snapshot", Presences: snapshot}); err != nil {
+		log.Println("Error sending presence snapshot:", err)
+		return
+	}
+
+	// Create cleanup channel. handleWebSocket sends its own sourceConn here
+	// once its read loop ends, and the broadcast loop below sends a peer
+	// connection here whenever a write to it fails -- so this goroutine
+	// must clean up whichever conn it actually receives, one at a time,
+	// for as long as the channel stays open.
+	disconnectChan := make(chan *websocket.Conn, 8)
 	sourceConn := conn
 
 	// Handle connection cleanup in goroutine
-	go func(dws *DocumentWebSocket, dc chan *websocket.Conn, src *websocket.Conn, did string) {
-		select {
-		case <-dc:
+	go func(dws *DocumentWebSocket, dc chan *websocket.Conn, did string) {
+		for disconnected := range dc {
 			dws.Mutex.Lock()
-			delete(dws.Connections, src)
+			delete(dws.Connections, disconnected)
+			leftPresence, hadPresence := dws.Presences[disconnected]
+			delete(dws.Presences, disconnected)
+			remaining := make([]*websocket.Conn, 0, len(dws.Connections))
+			for remainingConn := range dws.Connections {
+				remaining = append(remaining, remainingConn)
+			}
 			if len(dws.Connections) == 0 {
 				fmt.Println("No more connections. Cleaning up resources for document:", did)
+				dws.StopBrokerSubscriber()
 				documentCache.Delete(did)
+				documentCRDTs.Delete(did)
+				documentWebSocketsMutex.Lock()
 				delete(documentWebSockets, did)
+				documentWebSocketsMutex.Unlock()
 			}
 			dws.Mutex.Unlock()
+
+			// Only a connection that ever reported presence has one worth
+			// announcing as gone; a viewer who never moved their cursor
+			// leaves silently, same as before this feature existed.
+			if hadPresence {
+				leaveFrame := presenceFrame{Type: "presence_leave", Presence: leftPresence}
+				for _, remainingConn := range remaining {
+					remainingConn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+					remainingConn.WriteJSON(leaveFrame)
+				}
+			}
 		}
-	}(documentWS, disconnectChan, sourceConn, documentID)
+	}(documentWS, disconnectChan, documentID)
 
 	// Main message handling loop
 	for {
@@ -253,34 +1446,116 @@ func handleWebSocket(ctx *gin.Context, documentID string, documentController con
 			break
 		}
 
-		// Parse incoming message
-		var message dto.Message
-		if json.Unmarshal(messageBytes, &message) != nil {
-			log.Println("Error unmarshalling document:", json.Unmarshal(messageBytes, &message))
+		// A presence update (cursor/selection/color) takes a separate path
+		// that never touches documentCache, the WAL, the broker, or
+		// Mongo -- it's ephemeral state, fanned out to this document's
+		// local peers only. Everything else is an edit frame, including
+		// one with no "type" at all, for backward compatibility with
+		// clients that predate this distinction.
+		var envelope inboundFrameEnvelope
+		json.Unmarshal(messageBytes, &envelope)
+		if envelope.Type == "presence" {
+			var presence presenceFrame
+			if json.Unmarshal(messageBytes, &presence) != nil {
+				log.Println("Error unmarshalling presence frame:", err)
+				continue
+			}
+
+			documentWS.Mutex.Lock()
+			documentWS.Presences[sourceConn] = presence.Presence
+			for clientConn := range documentWS.Connections {
+				if clientConn == sourceConn {
+					continue
+				}
+				clientConn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+				if clientConn.WriteJSON(presence) != nil {
+					log.Println("Error writing presence update to peer connection")
+				}
+			}
+			documentWS.Mutex.Unlock()
+			continue
+		}
+
+		// Parse the incoming operation vector (insert/delete ops with
+		// <lamport, siteID> identifiers), not a full document snapshot.
+		var frame syncFrame
+		if json.Unmarshal(messageBytes, &frame) != nil {
+			log.Println("Error unmarshalling document:", json.Unmarshal(messageBytes, &frame))
 			continue
 		}
 
-		// Update document cache
-		if updateDocumentCache(documentID, documentController, message.Data) != nil {
-			log.Println("Error updating document cache:", updateDocumentCache(documentID, documentController, message.Data))
+		// Re-check WriteAccess against the live cached document, not the
+		// connect-time snapshot, so a collaborator demoted to read-only
+		// mid-session has their edits rejected from this point on instead
+		// of being dropped from the connection entirely -- they keep
+		// receiving broadcasts, they just can't push further changes. This
+		// also keeps meta.canWrite current for anything else that inspects
+		// this connection's tagged state.
+		liveDocument, exists := documentCache.Load(documentID)
+		if !exists {
+			liveDocument = documentRecord
+		}
+		meta.canWrite = containsUser(liveDocument.WriteAccess, requesterID)
+		if !meta.canWrite {
+			sourceConn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+			if err := sourceConn.WriteJSON(unauthorizedWriteFrame{
+				Origin:  documentID,
+				Type:    "unauthorized_write",
+				Message: "you do not have write access to this document",
+			}); err != nil {
+				log.Println("Error writing unauthorized-write frame:", err)
+			}
 			continue
 		}
 
-		// Broadcast changes to other connections
+		// Merge the ops into the CRDT and mirror the materialized text
+		// into documentCache so the REST handlers keep seeing live content.
+		// When replication is enabled, also submit each op as a Raft log
+		// entry so every follower's cache and local connections converge
+		// on the same edit, not just this node's.
+		for _, op := range frame.Ops {
+			document.Apply(op)
+			if replicationCluster != nil {
+				opCopy := op
+				command := replication.Command{Type: replication.CommandCRDTOp, DocumentID: documentID, Op: &opCopy}
+				if err := replicationCluster.Apply(command, 5*time.Second); err != nil {
+					log.Println("Error replicating CRDT op:", err)
+				}
+			}
+		}
+
+		materializedContent := document.Materialize()
+
+		// Append before acknowledging or broadcasting, so a crash right
+		// after this point still has the edit durably on disk to recover
+		// on restart (see recoverFromWAL).
+		if documentWAL != nil {
+			if _, err := documentWAL.Append(documentID, materializedContent); err != nil {
+				log.Println("Error appending to WAL:", err)
+			}
+		}
+
+		if updateDocumentCache(documentID, documentController, dto.DocumentData{Content: materializedContent}) != nil {
+			log.Println("Error updating document cache:", updateDocumentCache(documentID, documentController, dto.DocumentData{Content: materializedContent}))
+			continue
+		}
+
+		// Let every other instance watching this document know, so their
+		// local connections converge on the same edit too.
+		if err := documentBroker.Publish(documentID, broker.Message{OriginID: siteID, Ops: frame.Ops}); err != nil {
+			log.Println("Error publishing document change to broker:", err)
+		}
+
+		// Rebroadcast only the delta ops, not the whole document.
 		documentWS.Mutex.Lock()
 		for clientConn := range documentWS.Connections {
 			if clientConn == sourceConn {
 				continue
 			}
 
-			changeData, err := json.Marshal(message.Change)
-			if err != nil {
-				log.Println("Error marshalling message:", err)
-				continue
-			}
-
-			if clientConn.WriteMessage(websocket.TextMessage, changeData) != nil {
-				log.Println("Error writing message:", clientConn.WriteMessage(websocket.TextMessage, changeData))
+			clientConn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+			if clientConn.WriteJSON(frame) != nil {
+				log.Println("Error writing message to peer connection")
 				clientConn.Close()
 				disconnectChan <- clientConn
 				delete(documentWS.Connections, clientConn)
@@ -289,43 +1564,84 @@ func handleWebSocket(ctx *gin.Context, documentID string, documentController con
 		documentWS.Mutex.Unlock()
 	}
 
+	// sourceConn's own read loop just ended -- queue its cleanup like any
+	// other disconnect, then close the channel so the cleanup goroutine
+	// exits once it's drained everything already queued.
+	disconnectChan <- sourceConn
 	close(disconnectChan)
 }
 
+// inflightFetch is a single in-progress fetchDocumentCoalesced call: every
+// caller for the same document ID waits on done, then reads document/err,
+// rather than each racing documentController.GetOneDocument independently.
+type inflightFetch struct {
+	done     chan struct{}
+	document *dto.Document
+	err      error
+}
+
+var documentFetchInflight sync.Map // documentID -> *inflightFetch
+
+// fetchDocumentCoalesced calls fetch at most once per documentID among
+// concurrently arriving callers: the first caller runs fetch and shares its
+// result with every other caller that arrived while it was in flight. This
+// keeps a burst of simultaneous opens of the same (not-yet-cached) document
+// from each issuing their own GetOneDocument round-trip to Mongo.
+func fetchDocumentCoalesced(documentID string, fetch func() (*dto.Document, error)) (*dto.Document, error) {
+	entry := &inflightFetch{done: make(chan struct{})}
+	actual, loaded := documentFetchInflight.LoadOrStore(documentID, entry)
+	if loaded {
+		entry = actual.(*inflightFetch)
+		<-entry.done
+		return entry.document, entry.err
+	}
+
+	entry.document, entry.err = fetch()
+	documentFetchInflight.Delete(documentID)
+	close(entry.done)
+	return entry.document, entry.err
+}
+
 func initializeDocumentCache(ctx *gin.Context, documentController controller.DocumentController) (*dto.Document, error) {
 	documentID := ctx.Param("id")
-	var document *dto.Document
 
-	if cached, exists := documentCache.Load(documentID); !exists {
-		var err error
-		document, err = documentController.GetOneDocument(ctx)
-		if err != nil {
-			fmt.Println("Error getting document:", err)
-			return nil, err
-		}
-		documentCache.Store(documentID, document)
-		ctx.JSON(http.StatusOK, document)
-	} else {
-		document = cached.(*dto.Document)
+	if cached, exists := documentCache.Load(documentID); exists {
+		return cached, nil
 	}
 
+	document, err := fetchDocumentCoalesced(documentID, func() (*dto.Document, error) {
+		return documentController.GetOneDocument(ctx)
+	})
+	if err != nil {
+		fmt.Println("Error getting document:", err)
+		return nil, err
+	}
+
+	documentCache.Store(documentID, document)
+	ctx.JSON(http.StatusOK, document)
 	return document, nil
 }
 
 func updateDocumentCache(documentID string, documentController controller.DocumentController, newData dto.DocumentData) error {
-	cached, exists := documentCache.Load(documentID)
+	document, exists := documentCache.Load(documentID)
 	if !exists {
 		return fmt.Errorf("document not found in cache")
 	}
 
-	document := cached.(*dto.Document)
 	document.Data = newData
 	documentCache.Store(documentID, document)
+	documentCache.MarkDirty(documentID)
 	return nil
 }
 
-func updateDatabaseWithCache(documentController controller.DocumentController) {
-	ticker := time.NewTicker(30 * time.Second)
+// updateDatabaseWithCache starts the periodic flush and returns its ticker
+// so the caller can Stop it on shutdown (see main). done lets the
+// underlying goroutine exit once the caller closes it -- Stop alone only
+// stops the ticker from firing again, it doesn't close t.C, so without
+// done the goroutine (and its reference to documentController) would leak
+// for the life of the process even after shutdown.
+func updateDatabaseWithCache(documentController controller.DocumentController, done <-chan struct{}) *time.Ticker {
+	ticker := time.NewTicker(flushInterval())
 	go func(t *time.Ticker, dc controller.DocumentController) {
 		for {
 			select {
@@ -333,46 +1649,146 @@ func updateDatabaseWithCache(documentController controller.DocumentController) {
 				if err := syncDatabaseWithCache(dc); err != nil {
 					fmt.Println("Error updating database with cache:", err)
 				}
+			case <-done:
+				return
 			}
 		}
 	}(ticker, documentController)
+	return ticker
 }
 
+// syncDatabaseWithCache flushes every entry documentCache considers dirty
+// (modified since its last successful flush) to Mongo every tick -- an
+// unmodified entry already matches Mongo, so it's skipped rather than
+// re-written. Each entry's Data.Content is the CRDT's materialized
+// (tombstones stripped) text, kept current by handleWebSocket as ops
+// arrive -- so this persists the compacted document state, never the raw
+// per-document op log. When the WAL is enabled, a document that's still
+// dirty after the flush (the flush failed, or it was modified again while
+// the flush was in flight) keeps its WAL entries uncompacted so they
+// remain the durable copy until a later tick succeeds; everything else
+// gets its log compacted up to the offset it held right before this
+// flush started. It also sweeps documentCache for entries over its soft
+// byte cap, since a cache that's crept over cap between Store calls
+// otherwise only gets trimmed on its next write.
 func syncDatabaseWithCache(documentController controller.DocumentController) error {
-	documentCache.Range(func(key, value interface{}) bool {
-		documentID := key.(string)
-		document := value.(*dto.Document)
-		if err := documentController.UpdateDocument(documentID, document.Data); err != nil {
-			fmt.Printf("Error updating database for document %s: %v\n", documentID, err)
+	type pendingCompaction struct {
+		documentID string
+		offset     uint64
+	}
+	var compactions []pendingCompaction
+
+	if documentWAL != nil {
+		documentCache.Range(func(documentID string, document *dto.Document) bool {
+			if !documentCache.IsDirty(documentID) {
+				return true
+			}
+			if offset, exists := documentWAL.LatestOffset(documentID); exists {
+				compactions = append(compactions, pendingCompaction{documentID: documentID, offset: offset})
+			}
+			return true
+		})
+	}
+
+	flushErr := documentCache.FlushDirty()
+	if flushErr != nil {
+		fmt.Println("Error flushing dirty documents to database:", flushErr)
+	}
+
+	for _, pending := range compactions {
+		if documentCache.IsDirty(pending.documentID) {
+			continue
 		}
-		return true
-	})
-	return nil
+		if err := documentWAL.Compact(pending.documentID, pending.offset); err != nil {
+			fmt.Printf("Error compacting WAL for document %s: %v\n", pending.documentID, err)
+		}
+	}
+
+	documentCache.Sweep()
+	return flushErr
+}
+
+// FlushNow synchronously drains every dirty document out of documentCache,
+// for use during graceful shutdown so a SIGTERM doesn't lose the up-to-
+// flushInterval() tail of edits the next scheduled sync tick would
+// otherwise have caught.
+func FlushNow(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- documentCache.FlushDirty() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainForShutdown runs syncDatabaseWithCache to completion or until ctx
+// expires, whichever comes first. main's shutdown sequence uses this
+// instead of FlushNow because syncDatabaseWithCache also compacts the WAL
+// for everything it flushes, so a clean shutdown doesn't leave
+// recoverFromWAL replaying entries on the next start that already made it
+// to Mongo.
+func drainForShutdown(ctx context.Context, documentController controller.DocumentController) error {
+	done := make(chan error, 1)
+	go func() { done <- syncDatabaseWithCache(documentController) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// broadcastShutdownClose sends a CloseServiceRestart control frame to
+// every live WebSocket connection across every open document, so a
+// well-behaved client reconnects instead of just seeing its socket vanish
+// mid-edit.
+func broadcastShutdownClose() {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down")
+
+	documentWebSocketsMutex.RLock()
+	allDocumentWS := make([]*DocumentWebSocket, 0, len(documentWebSockets))
+	for _, documentWS := range documentWebSockets {
+		allDocumentWS = append(allDocumentWS, documentWS)
+	}
+	documentWebSocketsMutex.RUnlock()
+
+	for _, documentWS := range allDocumentWS {
+		documentWS.Mutex.Lock()
+		for conn := range documentWS.Connections {
+			conn.SetWriteDeadline(time.Now().Add(wsConfig.WriteWait))
+			conn.WriteMessage(websocket.CloseMessage, closeMessage)
+		}
+		documentWS.Mutex.Unlock()
+	}
 }
 
 func updateDocumentCacheAttribute(documentID string, documentController controller.DocumentController, newData dto.Access) error {
 	fmt.Print("Updating document cache attribute\n")
-	cached, exists := documentCache.Load(documentID)
+	document, exists := documentCache.Load(documentID)
 	if !exists {
 		return fmt.Errorf("document not found in cache")
 	}
 
-	document := cached.(*dto.Document)
 	document.ReadAccess = newData.ReadAccess
 	document.WriteAccess = newData.WriteAccess
 	documentCache.Store(documentID, document)
+	documentCache.MarkDirty(documentID)
 	return nil
 }
 
 func updateDocumentTitleCacheAttribute(documentID string, newTitle string) error {
 	fmt.Print("Updating document title cache attribute\n", documentID, newTitle)
-	cached, exists := documentCache.Load(documentID)
+	document, exists := documentCache.Load(documentID)
 	if !exists {
 		return fmt.Errorf("document not found in cache")
 	}
 
-	document := cached.(*dto.Document)
 	document.Title = newTitle
 	documentCache.Store(documentID, document)
+	documentCache.MarkDirty(documentID)
 	return nil
 }
\ No newline at end of file
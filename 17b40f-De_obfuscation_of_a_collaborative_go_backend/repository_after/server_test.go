@@ -1,14 +1,38 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service/cache"
+	"github.com/khallihub/godoc/service/collab"
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeCacheFlusher satisfies cache.Flusher for tests that need to drive
+// documentCache.FlushDirty/FlushNow without a real Mongo-backed controller.
+type fakeCacheFlusher struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (f *fakeCacheFlusher) UpdateDocument(documentID string, data dto.DocumentData) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls = append(f.calls, documentID)
+	return nil
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -33,4 +57,294 @@ func TestDatabaseConstants(t *testing.T) {
 func TestWebSocketUpgraderConfiguration(t *testing.T) {
 	assert.Equal(t, 1024, upgrader.ReadBufferSize)
 	assert.Equal(t, 1024, upgrader.WriteBufferSize)
-}
\ No newline at end of file
+}
+
+func TestFetchDocumentCoalesced_OneCallRegardlessOfConcurrentCallers(t *testing.T) {
+	documentID := "doc-coalesce-test"
+	unblock := make(chan struct{})
+	var callCount int32
+
+	fetch := func() (*dto.Document, error) {
+		atomic.AddInt32(&callCount, 1)
+		<-unblock
+		return &dto.Document{ID: documentID}, nil
+	}
+
+	const callers = 20
+	results := make([]*dto.Document, callers)
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			document, err := fetchDocumentCoalesced(documentID, fetch)
+			assert.NoError(t, err)
+			results[i] = document
+		}(i)
+	}
+
+	close(unblock)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&callCount))
+	for _, document := range results {
+		assert.Equal(t, documentID, document.ID)
+	}
+}
+
+func TestContainsUser(t *testing.T) {
+	access := []string{"alice", "bob"}
+	assert.True(t, containsUser(access, "alice"))
+	assert.False(t, containsUser(access, "carol"))
+	assert.False(t, containsUser(access, ""))
+}
+
+func TestCheckOrigin_NoOriginHeaderAllowed(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	assert.True(t, checkOrigin(req))
+}
+
+func TestCheckOrigin_DefaultsToSameOriginWhenUnset(t *testing.T) {
+	os.Unsetenv("ALLOWED_ORIGINS")
+
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	req.Host = "example.com"
+	req.Header.Set("Origin", "https://example.com")
+	assert.True(t, checkOrigin(req))
+
+	req.Header.Set("Origin", "https://evil.com")
+	assert.False(t, checkOrigin(req))
+}
+
+func TestCheckOrigin_RespectsAllowedOriginsList(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGINS", "https://allowed.example.com, https://other.example.com")
+	defer os.Unsetenv("ALLOWED_ORIGINS")
+
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	req.Host = "example.com"
+
+	req.Header.Set("Origin", "https://allowed.example.com")
+	assert.True(t, checkOrigin(req))
+
+	req.Header.Set("Origin", "https://not-listed.example.com")
+	assert.False(t, checkOrigin(req))
+}
+
+func TestWebSocketTicket_RoundTrips(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	ticket, err := mintWebSocketTicket("alice", "doc-1")
+	assert.NoError(t, err)
+
+	userID, ok := verifyWebSocketTicket(ticket, "doc-1")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", userID)
+}
+
+func TestWebSocketTicket_RejectsWrongDocument(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	ticket, err := mintWebSocketTicket("alice", "doc-1")
+	assert.NoError(t, err)
+
+	_, ok := verifyWebSocketTicket(ticket, "doc-2")
+	assert.False(t, ok)
+}
+
+func TestWebSocketTicket_RejectsTamperedSignature(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	ticket, err := mintWebSocketTicket("alice", "doc-1")
+	assert.NoError(t, err)
+
+	_, ok := verifyWebSocketTicket(ticket+"tampered", "doc-1")
+	assert.False(t, ok)
+}
+
+func TestWebSocketTicket_RejectsWhenSecretUnset(t *testing.T) {
+	os.Unsetenv("WS_TICKET_SECRET")
+
+	_, err := mintWebSocketTicket("alice", "doc-1")
+	assert.Error(t, err)
+}
+
+func TestWebSocketRequesterID_FromQueryParam(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	ticket, err := mintWebSocketTicket("alice", "doc-1")
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	req, _ := http.NewRequest("GET", "/documents/handler?document_id=doc-1&ticket="+ticket, nil)
+	ctx := &gin.Context{Request: req}
+
+	userID, ok := webSocketRequesterID(ctx, "doc-1")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", userID)
+}
+
+func TestWebSocketRequesterID_FromSecWebSocketProtocol(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	ticket, err := mintWebSocketTicket("alice", "doc-1")
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	req, _ := http.NewRequest("GET", "/documents/handler?document_id=doc-1", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "ticket."+ticket)
+	ctx := &gin.Context{Request: req}
+
+	userID, ok := webSocketRequesterID(ctx, "doc-1")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", userID)
+}
+
+func TestWebSocketRequesterID_MissingTicketRejected(t *testing.T) {
+	os.Setenv("WS_TICKET_SECRET", "test-secret")
+	defer os.Unsetenv("WS_TICKET_SECRET")
+
+	gin.SetMode(gin.TestMode)
+	req, _ := http.NewRequest("GET", "/documents/handler?document_id=doc-1", nil)
+	ctx := &gin.Context{Request: req}
+
+	_, ok := webSocketRequesterID(ctx, "doc-1")
+	assert.False(t, ok)
+}
+
+func TestArmConnectionHeartbeat_FrozenPeerReadDeadlineExpiresWithinBudget(t *testing.T) {
+	cfg := collab.WebSocketConfig{
+		PingInterval:   20 * time.Millisecond,
+		PongWait:       80 * time.Millisecond,
+		WriteWait:      20 * time.Millisecond,
+		MaxMessageSize: 1 << 20,
+	}
+
+	readReturned := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+		armConnectionHeartbeat(conn, cfg, done)
+
+		_, _, err = conn.ReadMessage()
+		readReturned <- err
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	clientConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.NoError(t, err)
+	defer clientConn.Close()
+
+	// Simulate a frozen peer: never reply to the server's pings. gorilla's
+	// default ping handler replies with a pong automatically, so replace
+	// it with a no-op.
+	clientConn.SetPingHandler(func(string) error { return nil })
+	go func() {
+		for {
+			if _, _, err := clientConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-readReturned:
+		assert.Error(t, err, "expected the frozen peer's read deadline to expire")
+	case <-time.After(2 * time.Second):
+		t.Fatal("server's ReadMessage did not return within the expected deadline budget")
+	}
+}
+
+func TestFlushNow_DrainsDirtyDocumentsSynchronously(t *testing.T) {
+	flusher := &fakeCacheFlusher{}
+	previousCache := documentCache
+	documentCache = cache.New(1<<20, flusher)
+	defer func() { documentCache = previousCache }()
+
+	documentCache.Store("doc-flush-now", &dto.Document{ID: "doc-flush-now"})
+	documentCache.MarkDirty("doc-flush-now")
+
+	assert.NoError(t, FlushNow(context.Background()))
+
+	flusher.mutex.Lock()
+	defer flusher.mutex.Unlock()
+	assert.Equal(t, []string{"doc-flush-now"}, flusher.calls)
+	assert.False(t, documentCache.IsDirty("doc-flush-now"))
+}
+
+func TestUpdateDatabaseWithCache_FlushesOnTickAndStopsAfterDoneClosed(t *testing.T) {
+	os.Setenv("FLUSH_INTERVAL_SECONDS", "1")
+	defer os.Unsetenv("FLUSH_INTERVAL_SECONDS")
+
+	flusher := &fakeCacheFlusher{}
+	previousCache := documentCache
+	documentCache = cache.New(1<<20, flusher)
+	defer func() { documentCache = previousCache }()
+
+	documentCache.Store("doc-ticker", &dto.Document{ID: "doc-ticker"})
+	documentCache.MarkDirty("doc-ticker")
+
+	done := make(chan struct{})
+	ticker := updateDatabaseWithCache(nil, done)
+	defer ticker.Stop()
+
+	time.Sleep(1200 * time.Millisecond)
+	close(done)
+
+	flusher.mutex.Lock()
+	defer flusher.mutex.Unlock()
+	assert.Equal(t, []string{"doc-ticker"}, flusher.calls)
+}
+
+func TestBroadcastShutdownClose_SendsCloseServiceRestartToLiveConnections(t *testing.T) {
+	closeCode := make(chan int, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		previous := documentWebSockets
+		documentWebSockets = map[string]*DocumentWebSocket{
+			"doc-shutdown-test": {Connections: map[*websocket.Conn]bool{conn: true}},
+		}
+		defer func() { documentWebSockets = previous }()
+
+		broadcastShutdownClose()
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	clientConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.NoError(t, err)
+	defer clientConn.Close()
+
+	go func() {
+		_, _, err := clientConn.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			closeCode <- closeErr.Code
+		} else {
+			closeCode <- 0
+		}
+	}()
+
+	select {
+	case code := <-closeCode:
+		assert.Equal(t, websocket.CloseServiceRestart, code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("did not receive a close frame in time")
+	}
+}
@@ -0,0 +1,32 @@
+// Package broker fans document changes out across server instances that
+// sit behind the load balancer without a sticky session, so a client
+// connected to one instance sees edits made through another.
+package broker
+
+import (
+	"context"
+
+	"github.com/khallihub/godoc/service/crdt"
+)
+
+// Message is one document change broadcast through the broker. OriginID
+// identifies the instance that published it, so a subscriber can ignore
+// echoes of changes it made itself instead of rebroadcasting them back to
+// the connections it just relayed them to.
+type Message struct {
+	OriginID string    `json:"originId"`
+	Ops      []crdt.Op `json:"ops"`
+}
+
+// Broker publishes document changes to, and delivers them from, every other
+// server instance watching the same document.
+type Broker interface {
+	// Publish announces a change to documentID to every other subscriber.
+	Publish(documentID string, message Message) error
+
+	// Subscribe returns a channel of changes to documentID from every
+	// instance (including messages this instance published itself -- the
+	// caller is responsible for filtering those out via Message.OriginID).
+	// The channel is closed once ctx is done.
+	Subscribe(ctx context.Context, documentID string) (<-chan Message, error)
+}
@@ -0,0 +1,25 @@
+package broker
+
+import "context"
+
+// NoopBroker discards every published message and never delivers anything
+// to subscribers. It's the fallback for single-node deployments, so
+// handleWebSocket can always call Publish/Subscribe without a nil check.
+type NoopBroker struct{}
+
+func NewNoopBroker() *NoopBroker {
+	return &NoopBroker{}
+}
+
+func (b *NoopBroker) Publish(documentID string, message Message) error {
+	return nil
+}
+
+func (b *NoopBroker) Subscribe(ctx context.Context, documentID string) (<-chan Message, error) {
+	messages := make(chan Message)
+	go func() {
+		<-ctx.Done()
+		close(messages)
+	}()
+	return messages, nil
+}
@@ -0,0 +1,35 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNoopBroker_PublishIsANoop(t *testing.T) {
+	b := NewNoopBroker()
+	if err := b.Publish("doc1", Message{OriginID: "server-1"}); err != nil {
+		t.Fatalf("expected Publish to never fail, got: %v", err)
+	}
+}
+
+func TestNoopBroker_SubscribeClosesOnContextCancel(t *testing.T) {
+	b := NewNoopBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := b.Subscribe(ctx, "doc1")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	cancel()
+
+	select {
+	case _, open := <-messages:
+		if open {
+			t.Fatal("expected channel to be closed, got a message instead")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for channel to close")
+	}
+}
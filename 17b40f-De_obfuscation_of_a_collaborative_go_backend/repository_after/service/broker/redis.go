@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// channelPrefix namespaces every document's pub/sub channel so the godoc
+// broker doesn't collide with other consumers of the same Redis instance.
+const channelPrefix = "godoc:doc:"
+
+// RedisBroker fans document changes out through Redis PUBLISH/SUBSCRIBE, so
+// any number of godoc instances behind the load balancer converge on the
+// same live edits without needing sticky sessions.
+type RedisBroker struct {
+	client *redis.Client
+}
+
+// NewRedisBroker dials addr (host:port) and returns a Broker backed by it.
+func NewRedisBroker(addr, password string, db int) (*RedisBroker, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("broker: connecting to redis: %w", err)
+	}
+
+	return &RedisBroker{client: client}, nil
+}
+
+func channelName(documentID string) string {
+	return channelPrefix + documentID
+}
+
+func (b *RedisBroker) Publish(documentID string, message Message) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("broker: encoding message: %w", err)
+	}
+
+	return b.client.Publish(context.Background(), channelName(documentID), encoded).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, documentID string) (<-chan Message, error) {
+	pubsub := b.client.Subscribe(ctx, channelName(documentID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("broker: subscribing to %s: %w", documentID, err)
+	}
+
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		redisMessages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case redisMessage, open := <-redisMessages:
+				if !open {
+					return
+				}
+				var message Message
+				if err := json.Unmarshal([]byte(redisMessage.Payload), &message); err != nil {
+					continue
+				}
+				select {
+				case messages <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// Close releases the underlying Redis client. Call it once on shutdown, not
+// per-document -- subscriptions are torn down individually via their ctx.
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
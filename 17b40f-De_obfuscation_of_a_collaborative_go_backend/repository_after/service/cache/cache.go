@@ -0,0 +1,371 @@
+// Package cache provides a size-bounded, LRU-evicting replacement for the
+// server's plain sync.Map documentCache. A burst of unique document opens
+// against the unbounded map could grow it without limit; this caps memory
+// use by evicting the least-recently-used document once a soft byte budget
+// is exceeded, flushing any entry to Mongo via the document controller
+// before it's dropped so an evicted-then-reopened document never loses an
+// edit.
+package cache
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+// Flusher is the subset of controller.DocumentController eviction needs:
+// persisting a document's content to Mongo before it's dropped from the
+// cache. Accepting this narrower interface rather than the full controller
+// keeps the cache package testable without a real Mongo-backed controller.
+type Flusher interface {
+	UpdateDocument(documentID string, data dto.DocumentData) error
+}
+
+// DocumentPatch is one dirty document's flush payload, passed to a
+// BulkFlusher so it can persist many documents in a single round-trip
+// instead of one UpdateDocument call per document.
+type DocumentPatch struct {
+	DocumentID string
+	Data       dto.DocumentData
+}
+
+// BulkFlusher is an optional capability of Flusher: a controller able to
+// persist many dirty documents in one round-trip. FlushDirty uses it when
+// the configured Flusher implements it, and otherwise falls back to one
+// UpdateDocument call per dirty entry. controller.DocumentController in
+// this tree doesn't implement it yet, so FlushDirty takes the per-document
+// path until a bulk method is added there.
+type BulkFlusher interface {
+	BulkUpdateDocuments(patches []DocumentPatch) error
+}
+
+// Store is the subset of DocumentCache's behavior server.go depends on, so
+// a different backend can stand in for the single-node in-process cache
+// without changing any call site. DocumentCache is the default, single-node
+// implementation; RedisStore (see redis.go) backs it with Redis instead so
+// multiple instances behind a load balancer share the same cached content.
+type Store interface {
+	Load(id string) (*dto.Document, bool)
+	Store(id string, document *dto.Document)
+	Delete(id string)
+	Range(fn func(id string, document *dto.Document) bool)
+	MarkDirty(id string)
+	IsDirty(id string) bool
+	FlushDirty() error
+	Sweep()
+}
+
+var _ Store = (*DocumentCache)(nil)
+
+// entry is one node in the LRU list, doubling as the map value. modifiedRev
+// and syncedRev track whether the entry has changed since it was last
+// persisted: an entry is dirty when modifiedRev > syncedRev. Comparing two
+// revision counters, rather than a single dirty bool, means a document
+// modified again while FlushDirty's earlier snapshot is still in flight
+// correctly stays dirty instead of being marked clean out from under that
+// write.
+type entry struct {
+	id       string
+	document *dto.Document
+	bytes    int
+
+	modifiedRev uint64
+	syncedRev   uint64
+
+	prev, next *entry
+}
+
+func sizeOf(document *dto.Document) int {
+	return len(document.Data.Content) + len(document.Title)
+}
+
+// DocumentCache is a bounded, LRU-evicting cache of *dto.Document, used in
+// place of a plain sync.Map so a burst of unique document opens can't grow
+// memory use without limit. MaxBytes is a soft cap: Store and Sweep only
+// evict once it's exceeded, not on every call.
+type DocumentCache struct {
+	maxBytes int
+	flusher  Flusher
+
+	mutex      sync.Mutex
+	index      map[string]*entry
+	head       *entry // most recently used
+	tail       *entry // least recently used
+	usedBytes  int
+	revCounter uint64
+}
+
+// New returns an empty DocumentCache that evicts the least-recently-used
+// entry once usedBytes exceeds maxBytes. flusher is used to persist an
+// entry's content to Mongo before it's evicted.
+func New(maxBytes int, flusher Flusher) *DocumentCache {
+	return &DocumentCache{
+		maxBytes: maxBytes,
+		flusher:  flusher,
+		index:    make(map[string]*entry),
+	}
+}
+
+// unlinkLocked removes e from the LRU list. Callers must hold c.mutex.
+func (c *DocumentCache) unlinkLocked(e *entry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		c.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		c.tail = e.prev
+	}
+	e.prev, e.next = nil, nil
+}
+
+// pushFrontLocked marks e as the most recently used entry. Callers must
+// hold c.mutex.
+func (c *DocumentCache) pushFrontLocked(e *entry) {
+	e.prev = nil
+	e.next = c.head
+	if c.head != nil {
+		c.head.prev = e
+	}
+	c.head = e
+	if c.tail == nil {
+		c.tail = e
+	}
+}
+
+func (c *DocumentCache) touchLocked(e *entry) {
+	if c.head == e {
+		return
+	}
+	c.unlinkLocked(e)
+	c.pushFrontLocked(e)
+}
+
+// Load returns the cached document for id, if present, marking it most
+// recently used.
+func (c *DocumentCache) Load(id string) (*dto.Document, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, exists := c.index[id]
+	if !exists {
+		return nil, false
+	}
+	c.touchLocked(e)
+	return e.document, true
+}
+
+// MarkDirty flags id as modified since its last successful flush, so
+// FlushDirty and the eviction path persist it instead of skipping it.
+// Store alone doesn't mark an entry dirty, since it's also used to seed
+// the cache with a document freshly loaded from Mongo (already in sync);
+// callers that mutate a cached document's content call Store then
+// MarkDirty (see updateDocumentCache and friends in server.go).
+func (c *DocumentCache) MarkDirty(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, exists := c.index[id]; exists {
+		c.revCounter++
+		e.modifiedRev = c.revCounter
+	}
+}
+
+// Store inserts or replaces the cached document for id, marking it most
+// recently used, then evicts least-recently-used entries -- flushing each
+// dirty one to Mongo first -- until usedBytes is back under maxBytes.
+func (c *DocumentCache) Store(id string, document *dto.Document) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bytes := sizeOf(document)
+	if e, exists := c.index[id]; exists {
+		c.usedBytes += bytes - e.bytes
+		e.document = document
+		e.bytes = bytes
+		c.touchLocked(e)
+	} else {
+		e := &entry{id: id, document: document, bytes: bytes}
+		c.index[id] = e
+		c.pushFrontLocked(e)
+		c.usedBytes += bytes
+	}
+
+	c.evictOverCapLocked()
+}
+
+// Delete removes id from the cache without flushing it -- callers that
+// need the content durable first (e.g. handleWebSocket's last-connection
+// cleanup, which already flushed via syncDatabaseWithCache) are expected to
+// have done so already.
+func (c *DocumentCache) Delete(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, exists := c.index[id]
+	if !exists {
+		return
+	}
+	c.unlinkLocked(e)
+	delete(c.index, id)
+	c.usedBytes -= e.bytes
+}
+
+// Range calls fn for every cached document, most recently used first,
+// stopping early if fn returns false. fn must not call back into the
+// DocumentCache.
+func (c *DocumentCache) Range(fn func(id string, document *dto.Document) bool) {
+	c.mutex.Lock()
+	entries := make([]*entry, 0, len(c.index))
+	for e := c.head; e != nil; e = e.next {
+		entries = append(entries, e)
+	}
+	c.mutex.Unlock()
+
+	for _, e := range entries {
+		if !fn(e.id, e.document) {
+			return
+		}
+	}
+}
+
+// Sweep evicts least-recently-used entries -- flushing each to Mongo first
+// -- until usedBytes is back under maxBytes. Call it alongside the
+// existing 30-second sync ticker (see updateDatabaseWithCache) so a cache
+// that's crept over its soft cap between Store calls still gets trimmed.
+func (c *DocumentCache) Sweep() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.evictOverCapLocked()
+}
+
+// evictOverCapLocked evicts from the tail of the LRU list until usedBytes
+// is at or under maxBytes, flushing each dirty entry to Mongo first (a
+// clean entry already matches Mongo, so it's evicted without a flush
+// call). A flush failure stops eviction for that entry (it stays in the
+// cache, most recently used again, to retry on the next tick) without
+// blocking eviction of anything else already over cap. Callers must hold
+// c.mutex.
+func (c *DocumentCache) evictOverCapLocked() {
+	for c.usedBytes > c.maxBytes && c.tail != nil {
+		e := c.tail
+		if c.flusher != nil && e.modifiedRev > e.syncedRev {
+			rev := e.modifiedRev
+			if err := c.flusher.UpdateDocument(e.id, e.document.Data); err != nil {
+				fmt.Printf("cache: flush before evicting document %s failed, keeping cached: %v\n", e.id, err)
+				c.touchLocked(e)
+				return
+			}
+			e.syncedRev = rev
+		}
+
+		c.unlinkLocked(e)
+		delete(c.index, e.id)
+		c.usedBytes -= e.bytes
+	}
+}
+
+// IsDirty reports whether id has been modified since its last successful
+// flush. Returns false for an id that isn't cached at all.
+func (c *DocumentCache) IsDirty(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, exists := c.index[id]
+	return exists && e.modifiedRev > e.syncedRev
+}
+
+// FlushDirty persists every entry modified since its last successful flush
+// through the configured Flusher -- via a single BulkUpdateDocuments call
+// if it implements BulkFlusher, otherwise one UpdateDocument call per dirty
+// entry -- and clears the dirty state of each one that flushed
+// successfully. An entry modified again while this call was in flight
+// stays dirty for the next call, since its modifiedRev will have moved
+// past the revision this call flushed. On a partial failure (individual
+// path only; BulkUpdateDocuments is all-or-nothing), every entry that did
+// flush is still marked clean and the first error encountered is returned.
+func (c *DocumentCache) FlushDirty() error {
+	type pending struct {
+		patch DocumentPatch
+		rev   uint64
+	}
+
+	c.mutex.Lock()
+	var dirty []pending
+	for e := c.head; e != nil; e = e.next {
+		if e.modifiedRev > e.syncedRev {
+			dirty = append(dirty, pending{DocumentPatch{DocumentID: e.id, Data: e.document.Data}, e.modifiedRev})
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	markSynced := func(flushed []pending) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for _, p := range flushed {
+			if e, exists := c.index[p.patch.DocumentID]; exists && p.rev > e.syncedRev {
+				e.syncedRev = p.rev
+			}
+		}
+	}
+
+	if bulk, ok := c.flusher.(BulkFlusher); ok {
+		patches := make([]DocumentPatch, len(dirty))
+		for i, p := range dirty {
+			patches[i] = p.patch
+		}
+		if err := bulk.BulkUpdateDocuments(patches); err != nil {
+			return err
+		}
+		markSynced(dirty)
+		return nil
+	}
+
+	var firstErr error
+	var flushed []pending
+	for _, p := range dirty {
+		if err := c.flusher.UpdateDocument(p.patch.DocumentID, p.patch.Data); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		flushed = append(flushed, p)
+	}
+	markSynced(flushed)
+	return firstErr
+}
+
+// assertUsedIsCorrect recomputes usedBytes from the live entries and
+// returns an error if it disagrees with the tracked value -- an invariant
+// check for tests, not used on any production path.
+func (c *DocumentCache) assertUsedIsCorrect() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var recomputed int
+	count := 0
+	for e := c.head; e != nil; e = e.next {
+		recomputed += e.bytes
+		count++
+	}
+	if count != len(c.index) {
+		return fmt.Errorf("cache: LRU list has %d entries, index has %d", count, len(c.index))
+	}
+	if recomputed != c.usedBytes {
+		return fmt.Errorf("cache: usedBytes is %d, recomputed %d", c.usedBytes, recomputed)
+	}
+	return nil
+}
+
+// Len returns the number of documents currently cached.
+func (c *DocumentCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.index)
+}
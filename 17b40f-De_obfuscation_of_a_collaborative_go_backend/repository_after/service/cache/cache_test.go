@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+type fakeFlusher struct {
+	mutex sync.Mutex
+	calls []string
+	fail  map[string]bool
+}
+
+func (f *fakeFlusher) UpdateDocument(documentID string, data dto.DocumentData) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fail[documentID] {
+		return fmt.Errorf("simulated flush failure for %s", documentID)
+	}
+	f.calls = append(f.calls, documentID)
+	return nil
+}
+
+func (f *fakeFlusher) callCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.calls)
+}
+
+// blockingFlusher signals started once UpdateDocument is called, then
+// waits on release before returning -- used to exercise the window where
+// a document can be re-dirtied while a flush is still in flight. started
+// and release must both be initialized by the caller before use.
+type blockingFlusher struct {
+	started    chan struct{}
+	release    chan struct{}
+	signalOnce sync.Once
+}
+
+func (f *blockingFlusher) UpdateDocument(documentID string, data dto.DocumentData) error {
+	f.signalOnce.Do(func() { close(f.started) })
+	<-f.release
+	return nil
+}
+
+// bulkFlusher records each BulkUpdateDocuments call's patch batch, to
+// verify FlushDirty prefers it over per-document UpdateDocument calls.
+type bulkFlusher struct {
+	mutex   sync.Mutex
+	batches [][]DocumentPatch
+}
+
+func (f *bulkFlusher) BulkUpdateDocuments(patches []DocumentPatch) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.batches = append(f.batches, patches)
+	return nil
+}
+
+func doc(content string) *dto.Document {
+	return &dto.Document{Data: dto.DocumentData{Content: content}}
+}
+
+func TestDocumentCache_StoreBeyondCapEvictsLeastRecentlyUsed(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(10, flusher)
+
+	c.Store("a", doc("12345")) // 5 bytes
+	c.MarkDirty("a")
+	c.Store("b", doc("12345")) // 10 bytes total, still at cap
+	c.MarkDirty("b")
+	if _, exists := c.Load("a"); !exists {
+		t.Fatal("expected a to still be cached")
+	}
+
+	// Storing c pushes usage to 15 bytes; a is now least recently used
+	// (b and then a were touched by the Load above, so b is now LRU... no,
+	// Load("a") makes a most recent, so b is least recently used).
+	c.Store("c", doc("12345"))
+
+	if _, exists := c.Load("b"); exists {
+		t.Fatal("expected b to have been evicted as least recently used")
+	}
+	if _, exists := c.Load("a"); !exists {
+		t.Fatal("expected a to survive eviction")
+	}
+	if _, exists := c.Load("c"); !exists {
+		t.Fatal("expected c to survive eviction")
+	}
+	if flusher.callCount() != 1 {
+		t.Fatalf("expected exactly one flush on eviction, got %d", flusher.callCount())
+	}
+
+	if err := c.assertUsedIsCorrect(); err != nil {
+		t.Fatalf("invariant check failed: %v", err)
+	}
+}
+
+func TestDocumentCache_EvictionFlushesDirtyContentFirst(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(5, flusher)
+
+	c.Store("a", doc("12345"))
+	c.MarkDirty("a")
+	c.Store("b", doc("12345")) // evicts a, flushing it first
+
+	if flusher.callCount() != 1 || flusher.calls[0] != "a" {
+		t.Fatalf("expected a to be flushed before eviction, got calls: %v", flusher.calls)
+	}
+}
+
+func TestDocumentCache_EvictionSkipsFlushForCleanEntries(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(5, flusher)
+
+	c.Store("a", doc("12345")) // never marked dirty -- already matches Mongo
+	c.Store("b", doc("12345")) // evicts a without needing to flush it
+
+	if flusher.callCount() != 0 {
+		t.Fatalf("expected no flush for an unmodified entry, got calls: %v", flusher.calls)
+	}
+	if _, exists := c.Load("a"); exists {
+		t.Fatal("expected a to have been evicted")
+	}
+}
+
+func TestDocumentCache_FailedFlushKeepsEntryCached(t *testing.T) {
+	flusher := &fakeFlusher{fail: map[string]bool{"a": true}}
+	c := New(5, flusher)
+
+	c.Store("a", doc("12345"))
+	c.MarkDirty("a")
+	c.Store("b", doc("12345")) // a's flush fails, so a should stay cached
+
+	if _, exists := c.Load("a"); !exists {
+		t.Fatal("expected a to remain cached after a failed flush")
+	}
+	if err := c.assertUsedIsCorrect(); err != nil {
+		t.Fatalf("invariant check failed: %v", err)
+	}
+}
+
+func TestDocumentCache_ConcurrentLoadOnEvictedKeyDoesNotLoseWrites(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(1<<20, flusher)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("doc-%d", i%5)
+			c.Store(id, doc(fmt.Sprintf("content-%d", i)))
+			c.Load(id)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := c.assertUsedIsCorrect(); err != nil {
+		t.Fatalf("invariant check failed after concurrent access: %v", err)
+	}
+	if c.Len() != 5 {
+		t.Fatalf("expected 5 distinct documents cached, got %d", c.Len())
+	}
+}
+
+func TestDocumentCache_DeleteRemovesWithoutFlushing(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(1<<20, flusher)
+
+	c.Store("a", doc("hello"))
+	c.Delete("a")
+
+	if _, exists := c.Load("a"); exists {
+		t.Fatal("expected a to be gone after Delete")
+	}
+	if flusher.callCount() != 0 {
+		t.Fatal("expected Delete to not flush")
+	}
+	if err := c.assertUsedIsCorrect(); err != nil {
+		t.Fatalf("invariant check failed: %v", err)
+	}
+}
+
+func TestDocumentCache_FlushDirty_SkipsUnmodifiedEntries(t *testing.T) {
+	flusher := &fakeFlusher{}
+	c := New(1<<20, flusher)
+
+	c.Store("a", doc("12345"))
+	c.Store("b", doc("67890"))
+	c.MarkDirty("b")
+
+	if err := c.FlushDirty(); err != nil {
+		t.Fatalf("FlushDirty: %v", err)
+	}
+
+	if flusher.callCount() != 1 || flusher.calls[0] != "b" {
+		t.Fatalf("expected only the dirty entry to be flushed, got calls: %v", flusher.calls)
+	}
+	if c.IsDirty("b") {
+		t.Fatal("expected b to be clean after a successful flush")
+	}
+}
+
+func TestDocumentCache_FlushDirty_ModificationDuringFlushStaysDirty(t *testing.T) {
+	flusher := &blockingFlusher{started: make(chan struct{}), release: make(chan struct{})}
+	c := New(1<<20, flusher)
+
+	c.Store("a", doc("12345"))
+	c.MarkDirty("a")
+
+	flushDone := make(chan error, 1)
+	go func() { flushDone <- c.FlushDirty() }()
+
+	<-flusher.started
+	c.MarkDirty("a") // modified again while the in-flight flush is running
+	close(flusher.release)
+
+	if err := <-flushDone; err != nil {
+		t.Fatalf("FlushDirty: %v", err)
+	}
+
+	if !c.IsDirty("a") {
+		t.Fatal("expected a to still be dirty after being modified mid-flush")
+	}
+}
+
+func TestDocumentCache_FlushDirty_BulkFlusherUsedWhenAvailable(t *testing.T) {
+	flusher := &bulkFlusher{}
+	c := New(1<<20, flusher)
+
+	c.Store("a", doc("12345"))
+	c.MarkDirty("a")
+	c.Store("b", doc("67890"))
+	c.MarkDirty("b")
+
+	if err := c.FlushDirty(); err != nil {
+		t.Fatalf("FlushDirty: %v", err)
+	}
+
+	if len(flusher.batches) != 1 || len(flusher.batches[0]) != 2 {
+		t.Fatalf("expected a single batch of 2 patches, got: %v", flusher.batches)
+	}
+	if c.IsDirty("a") || c.IsDirty("b") {
+		t.Fatal("expected both entries to be clean after a successful bulk flush")
+	}
+}
+
+func TestDocumentCache_RangeVisitsEveryEntry(t *testing.T) {
+	c := New(1<<20, &fakeFlusher{})
+	c.Store("a", doc("1"))
+	c.Store("b", doc("2"))
+
+	seen := make(map[string]bool)
+	c.Range(func(id string, document *dto.Document) bool {
+		seen[id] = true
+		return true
+	})
+
+	if !seen["a"] || !seen["b"] {
+		t.Fatalf("expected Range to visit both entries, saw: %v", seen)
+	}
+}
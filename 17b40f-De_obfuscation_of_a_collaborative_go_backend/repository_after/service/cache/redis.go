@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces a document's hash key so RedisStore doesn't
+// collide with other consumers (e.g. broker.RedisBroker's pub/sub
+// channels) of the same Redis instance.
+const redisKeyPrefix = "godoc:cache:"
+
+func redisKey(id string) string {
+	return redisKeyPrefix + id
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// redisChangesChannel is published to on every Store call, so any other
+// process sharing this Redis instance can react to the change. It's
+// independent of, and in addition to, the CRDT op fanout broker.Broker
+// already does for live WebSocket clients -- this is a coarser,
+// whole-document invalidation signal for consumers that aren't already on
+// the op-level broker.
+func redisChangesChannel(id string) string {
+	return "godoc:doc:" + id + ":changes"
+}
+
+// RedisStore is a Store backed by a Redis hash per document instead of
+// process memory, so every instance behind the load balancer reads and
+// writes the same cached content instead of each holding its own,
+// independently evictable copy -- the gap DocumentCache alone leaves for a
+// horizontally scaled deployment. Mongo is still the durable source of
+// truth; RedisStore only replaces where the hot, pre-flush copy of a
+// document lives. Dirty tracking stays local to each process (modified/
+// synced revision maps, mirroring DocumentCache's modifiedRev/syncedRev),
+// since whichever instance last wrote a document is the one responsible
+// for flushing that revision to Mongo.
+type RedisStore struct {
+	client  *redis.Client
+	flusher Flusher
+
+	mutex      sync.Mutex
+	modified   map[string]uint64
+	synced     map[string]uint64
+	revCounter uint64
+}
+
+// NewRedisStore dials addr (host:port) and returns a Store backed by it.
+// flusher persists a document to Mongo when FlushDirty is called, the same
+// role it plays for DocumentCache.
+func NewRedisStore(addr, password string, db int, flusher Flusher) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("cache: connecting to redis: %w", err)
+	}
+
+	return &RedisStore{
+		client:   client,
+		flusher:  flusher,
+		modified: make(map[string]uint64),
+		synced:   make(map[string]uint64),
+	}, nil
+}
+
+// Load fetches id's document from Redis. A Redis miss or a decode failure
+// both report as "not cached" rather than distinguishing the two, matching
+// DocumentCache.Load's two-result signature.
+func (s *RedisStore) Load(id string) (*dto.Document, bool) {
+	encoded, err := s.client.HGet(context.Background(), redisKey(id), "document").Result()
+	if err != nil {
+		return nil, false
+	}
+
+	var document dto.Document
+	if err := json.Unmarshal([]byte(encoded), &document); err != nil {
+		return nil, false
+	}
+	return &document, true
+}
+
+// Store writes id's document to Redis and publishes its change channel, so
+// every other instance watching Redis (directly, or by re-reading through
+// Load) sees it. There's no LRU eviction here -- Redis bounds its own
+// memory via its configured eviction policy instead.
+func (s *RedisStore) Store(id string, document *dto.Document) {
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		fmt.Printf("cache: encoding document %s for redis: %v\n", id, err)
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.client.HSet(ctx, redisKey(id), "document", encoded).Err(); err != nil {
+		fmt.Printf("cache: storing document %s in redis: %v\n", id, err)
+		return
+	}
+	s.client.Publish(ctx, redisChangesChannel(id), encoded)
+}
+
+// Delete removes id's Redis entry and its local dirty bookkeeping, without
+// flushing it first -- same contract as DocumentCache.Delete.
+func (s *RedisStore) Delete(id string) {
+	s.client.Del(context.Background(), redisKey(id))
+
+	s.mutex.Lock()
+	delete(s.modified, id)
+	delete(s.synced, id)
+	s.mutex.Unlock()
+}
+
+// Range scans every document key this store holds and calls fn for each,
+// stopping early if fn returns false. Unlike DocumentCache.Range, there's
+// no LRU order to report it in.
+func (s *RedisStore) Range(fn func(id string, document *dto.Document) bool) {
+	ctx := context.Background()
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		id := strings.TrimPrefix(iter.Val(), redisKeyPrefix)
+		document, exists := s.Load(id)
+		if !exists {
+			continue
+		}
+		if !fn(id, document) {
+			return
+		}
+	}
+}
+
+// MarkDirty flags id as modified by this instance since its last
+// successful flush, mirroring DocumentCache.MarkDirty.
+func (s *RedisStore) MarkDirty(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.revCounter++
+	s.modified[id] = s.revCounter
+}
+
+// IsDirty reports whether id has been modified by this instance since its
+// last successful flush.
+func (s *RedisStore) IsDirty(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.modified[id] > s.synced[id]
+}
+
+// FlushDirty persists every document this instance has marked dirty since
+// its last successful flush. A document modified again while its flush is
+// still in flight stays dirty afterward, since its modified revision will
+// have moved past the one snapshotted here -- the same guarantee
+// DocumentCache.FlushDirty gives.
+func (s *RedisStore) FlushDirty() error {
+	s.mutex.Lock()
+	dirty := make(map[string]uint64, len(s.modified))
+	for id, rev := range s.modified {
+		if rev > s.synced[id] {
+			dirty[id] = rev
+		}
+	}
+	s.mutex.Unlock()
+
+	for id, rev := range dirty {
+		document, exists := s.Load(id)
+		if !exists {
+			continue
+		}
+		if err := s.flusher.UpdateDocument(id, document.Data); err != nil {
+			return fmt.Errorf("cache: flushing document %s: %w", id, err)
+		}
+
+		s.mutex.Lock()
+		if s.synced[id] < rev {
+			s.synced[id] = rev
+		}
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+// Sweep is a no-op: RedisStore has no process-local byte budget to enforce
+// the way DocumentCache's Sweep does.
+func (s *RedisStore) Sweep() {}
+
+// Close releases the underlying Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,35 @@
+// Package collab holds the WebSocket connection tuning for the
+// collaborative editing socket in handleWebSocket: read/write deadlines
+// and the ping/pong heartbeat that detects a half-open connection a
+// failed write alone wouldn't catch, since a client that vanished without
+// a TCP reset (a frozen laptop, a dropped wifi router) never produces a
+// write error on its own.
+package collab
+
+import "time"
+
+// WebSocketConfig bounds how long handleWebSocket will wait on a
+// connection before treating it as dead. PingInterval is how often the
+// server sends a ping frame; PongWait is how long it then waits for the
+// matching pong before the read deadline expires; WriteWait bounds a
+// single outbound frame (ping or data); MaxMessageSize rejects any
+// inbound frame larger than it outright, so one oversized message from
+// the peer can't stall the read loop indefinitely.
+type WebSocketConfig struct {
+	PingInterval   time.Duration
+	PongWait       time.Duration
+	WriteWait      time.Duration
+	MaxMessageSize int64
+}
+
+// DefaultWebSocketConfig pings every 30s and allows 60s for the matching
+// pong -- one missed ping's worth of slack before the connection is
+// considered dead.
+func DefaultWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		PingInterval:   30 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+		MaxMessageSize: 1 << 20, // 1 MiB
+	}
+}
@@ -0,0 +1,20 @@
+package collab
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultWebSocketConfig(t *testing.T) {
+	cfg := DefaultWebSocketConfig()
+
+	if cfg.PingInterval != 30*time.Second {
+		t.Fatalf("got PingInterval %v, want 30s", cfg.PingInterval)
+	}
+	if cfg.PongWait != 60*time.Second {
+		t.Fatalf("got PongWait %v, want 60s", cfg.PongWait)
+	}
+	if cfg.PongWait <= cfg.PingInterval {
+		t.Fatal("PongWait must allow at least one full ping interval of slack")
+	}
+}
@@ -0,0 +1,210 @@
+// Package crdt implements a Logoot-style sequence CRDT for collaborative
+// text editing. Each character in the document is identified by a unique,
+// totally-ordered Identifier rather than by its index, so concurrent
+// insert/delete operations from different sites can be merged in any order
+// and still converge on the same result.
+package crdt
+
+import (
+	"strings"
+	"sync"
+)
+
+// Identifier orders an element in the sequence. Lamport breaks ties between
+// operations generated at the same logical time by different sites, and
+// SiteID breaks ties between operations with the same Lamport timestamp.
+type Identifier struct {
+	Lamport uint64 `json:"lamport"`
+	SiteID  string `json:"siteId"`
+}
+
+func (id Identifier) isZero() bool {
+	return id.Lamport == 0 && id.SiteID == ""
+}
+
+// less reports whether id sorts before other. It's only used to order
+// concurrent inserts anchored at the same position, not to order the
+// sequence itself (that's the job of the After chain).
+func (id Identifier) less(other Identifier) bool {
+	if id.Lamport != other.Lamport {
+		return id.Lamport < other.Lamport
+	}
+	return id.SiteID < other.SiteID
+}
+
+// Op is a single CRDT mutation. Insert anchors the new character after the
+// element identified by After (the zero Identifier means "at the start of
+// the document"). Delete tombstones the element identified by ID.
+type Op struct {
+	Type  string     `json:"type"` // "insert" or "delete"
+	ID    Identifier `json:"id"`
+	After Identifier `json:"after,omitempty"`
+	Char  string     `json:"char,omitempty"`
+}
+
+type element struct {
+	id        Identifier
+	after     Identifier
+	char      string
+	tombstone bool
+}
+
+// Document is an RGA (Replicated Growable Array): an ordered list of
+// elements, each tagged with a unique Identifier, where deletes only
+// tombstone an element rather than remove it. Tombstoning keeps the
+// position addressable so a concurrent insert anchored at a deleted
+// element still lands in the right place.
+//
+// A single *Document is shared by every collaborator connected to the same
+// document, so mutex guards elems/log/pending/clock against the concurrent
+// Apply calls that come in from each connection's own read-loop goroutine.
+type Document struct {
+	siteID string
+
+	mutex   sync.Mutex
+	clock   uint64
+	elems   []element
+	log     []Op
+	pending map[Identifier]bool // deletes that arrived before their insert
+}
+
+// NewDocument creates an empty document for the given site. siteID must be
+// unique per connected replica (server instance, in this case) so Lamport
+// ties resolve deterministically.
+func NewDocument(siteID string) *Document {
+	return &Document{siteID: siteID, pending: make(map[Identifier]bool)}
+}
+
+// NextInsert allocates an Op that inserts ch immediately after the element
+// identified by after (the zero Identifier inserts at the very start).
+func (d *Document) NextInsert(after Identifier, ch string) Op {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clock++
+	return Op{Type: "insert", ID: Identifier{Lamport: d.clock, SiteID: d.siteID}, After: after, Char: ch}
+}
+
+// NextDelete allocates an Op that tombstones the element identified by id.
+func (d *Document) NextDelete(id Identifier) Op {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clock++
+	return Op{Type: "delete", ID: id}
+}
+
+// Apply merges a single operation into the document. It is idempotent
+// (re-applying an already-seen insert is a no-op) and commutative
+// (concurrent ops apply cleanly regardless of arrival order), which also
+// makes it safe to call concurrently from multiple collaborators' goroutines.
+func (d *Document) Apply(op Op) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if op.ID.Lamport > d.clock {
+		d.clock = op.ID.Lamport
+	}
+
+	switch op.Type {
+	case "insert":
+		d.applyInsert(op)
+	case "delete":
+		d.applyDelete(op)
+	}
+
+	d.log = append(d.log, op)
+}
+
+func (d *Document) applyInsert(op Op) {
+	for _, existing := range d.elems {
+		if existing.id == op.ID {
+			return
+		}
+	}
+
+	insertAt := 0
+	if !op.After.isZero() {
+		insertAt = len(d.elems)
+		for i, existing := range d.elems {
+			if existing.id == op.After {
+				insertAt = i + 1
+				break
+			}
+		}
+	}
+
+	// Among siblings anchored at the same position, order by descending
+	// Identifier so every replica inserts concurrent siblings in the same
+	// relative order.
+	for insertAt < len(d.elems) && d.elems[insertAt].after == op.After && op.ID.less(d.elems[insertAt].id) {
+		insertAt++
+	}
+
+	newElement := element{id: op.ID, after: op.After, char: op.Char}
+	if d.pending[op.ID] {
+		newElement.tombstone = true
+		delete(d.pending, op.ID)
+	}
+
+	d.elems = append(d.elems, element{})
+	copy(d.elems[insertAt+1:], d.elems[insertAt:])
+	d.elems[insertAt] = newElement
+}
+
+func (d *Document) applyDelete(op Op) {
+	for i := range d.elems {
+		if d.elems[i].id == op.ID {
+			d.elems[i].tombstone = true
+			return
+		}
+	}
+
+	// The insert hasn't arrived yet (out-of-order delivery); remember the
+	// tombstone so applyInsert can apply it the moment the insert shows up.
+	d.pending[op.ID] = true
+}
+
+// Materialize returns the current, visible text of the document.
+func (d *Document) Materialize() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var builder strings.Builder
+	for _, el := range d.elems {
+		if !el.tombstone {
+			builder.WriteString(el.char)
+		}
+	}
+	return builder.String()
+}
+
+// StateVector returns, per site, the highest Lamport timestamp this
+// document has observed. A new connection sends its own state vector on
+// join, and the server replies with only the ops the client is missing.
+func (d *Document) StateVector() map[string]uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	vector := make(map[string]uint64)
+	for _, op := range d.log {
+		if op.ID.Lamport > vector[op.ID.SiteID] {
+			vector[op.ID.SiteID] = op.ID.Lamport
+		}
+	}
+	return vector
+}
+
+// OpsSince returns every logged op this document has seen that isn't
+// already reflected in the given state vector, in the order they were
+// originally applied.
+func (d *Document) OpsSince(vector map[string]uint64) []Op {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	missing := make([]Op, 0, len(d.log))
+	for _, op := range d.log {
+		if op.ID.Lamport > vector[op.ID.SiteID] {
+			missing = append(missing, op)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,117 @@
+package crdt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestApply_InsertAndDeleteConverge(t *testing.T) {
+	doc := NewDocument("site-a")
+
+	opH := doc.NextInsert(Identifier{}, "H")
+	doc.Apply(opH)
+	opI := doc.NextInsert(opH.ID, "i")
+	doc.Apply(opI)
+
+	if got := doc.Materialize(); got != "Hi" {
+		t.Fatalf("expected %q, got %q", "Hi", got)
+	}
+
+	doc.Apply(doc.NextDelete(opI.ID))
+	if got := doc.Materialize(); got != "H" {
+		t.Fatalf("expected %q after delete, got %q", "H", got)
+	}
+}
+
+func TestApply_ConcurrentInsertsConvergeRegardlessOfOrder(t *testing.T) {
+	base := NewDocument("site-a")
+	opBase := base.NextInsert(Identifier{}, "A")
+	base.Apply(opBase)
+
+	opFromB := Op{Type: "insert", ID: Identifier{Lamport: 2, SiteID: "site-b"}, After: opBase.ID, Char: "B"}
+	opFromC := Op{Type: "insert", ID: Identifier{Lamport: 2, SiteID: "site-c"}, After: opBase.ID, Char: "C"}
+
+	replica1 := NewDocument("site-a")
+	replica1.Apply(opBase)
+	replica1.Apply(opFromB)
+	replica1.Apply(opFromC)
+
+	replica2 := NewDocument("site-a")
+	replica2.Apply(opBase)
+	replica2.Apply(opFromC)
+	replica2.Apply(opFromB)
+
+	if replica1.Materialize() != replica2.Materialize() {
+		t.Fatalf("replicas diverged: %q vs %q", replica1.Materialize(), replica2.Materialize())
+	}
+}
+
+func TestApply_IsIdempotent(t *testing.T) {
+	doc := NewDocument("site-a")
+	op := doc.NextInsert(Identifier{}, "x")
+
+	doc.Apply(op)
+	doc.Apply(op)
+	doc.Apply(op)
+
+	if got := doc.Materialize(); got != "x" {
+		t.Fatalf("expected re-applying the same op to be a no-op, got %q", got)
+	}
+}
+
+func TestApply_DeleteBeforeInsertIsRememberedAsPending(t *testing.T) {
+	doc := NewDocument("site-a")
+	op := doc.NextInsert(Identifier{}, "x")
+
+	doc.Apply(doc.NextDelete(op.ID))
+	doc.Apply(op)
+
+	if got := doc.Materialize(); got != "" {
+		t.Fatalf("expected out-of-order delete to still remove the char, got %q", got)
+	}
+}
+
+func TestOpsSince_ReturnsOnlyMissingOps(t *testing.T) {
+	doc := NewDocument("site-a")
+	op1 := doc.NextInsert(Identifier{}, "a")
+	doc.Apply(op1)
+	op2 := doc.NextInsert(op1.ID, "b")
+	doc.Apply(op2)
+
+	clientVector := map[string]uint64{"site-a": op1.ID.Lamport}
+	missing := doc.OpsSince(clientVector)
+
+	if len(missing) != 1 || missing[0].ID != op2.ID {
+		t.Fatalf("expected only op2 to be missing, got %+v", missing)
+	}
+}
+
+// TestApply_ConcurrentCallersDoNotRace exercises the scenario server.go
+// actually hits: multiple collaborators' goroutines calling Apply on the
+// *same* Document at once. Before Document gained its mutex, this reliably
+// raced on elems/pending under -race and could panic with an out-of-range
+// slice index or a concurrent map write.
+func TestApply_ConcurrentCallersDoNotRace(t *testing.T) {
+	doc := NewDocument("site-a")
+
+	var wg sync.WaitGroup
+	for site := 0; site < 8; site++ {
+		site := site
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				id := Identifier{Lamport: uint64(i + 1), SiteID: fmt.Sprintf("site-%d", site)}
+				doc.Apply(Op{Type: "insert", ID: id, Char: "x"})
+				doc.Apply(Op{Type: "delete", ID: id})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// No assertion on the merged content -- concurrent siblings with no
+	// shared After anchor can interleave in any order. The point of this
+	// test is that -race finds nothing and Apply doesn't panic.
+	doc.Materialize()
+}
@@ -0,0 +1,336 @@
+// Package ot implements classic Operational Transformation over plain
+// text: operations as sequences of retain/insert/delete components, with
+// Compose to merge two sequential operations and Transform to reconcile
+// two operations that both started from the same document revision.
+//
+// handleWebSocket's live collaborative editing path (see server.go) already
+// merges concurrent edits via the sequence CRDT in service/crdt, which
+// converges without a central revision counter or a Transform step at all.
+// This package exists alongside it as a standalone building block for
+// call sites that work in terms of plain text diffs against a known base
+// revision -- e.g. importing an externally-edited document, or a
+// lower-bandwidth client that sends a full-text diff instead of CRDT ops --
+// not as a replacement for the CRDT path.
+package ot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// componentType is one of Retain, Insert, or Delete.
+type componentType int
+
+const (
+	retainType componentType = iota
+	insertType
+	deleteType
+)
+
+// Component is a single step of an Operation: retain N characters of the
+// base document unchanged, insert Text at the current position, or delete
+// N characters of the base document.
+type Component struct {
+	typ  componentType
+	n    int
+	text string
+}
+
+// Retain returns a component that copies n characters of the base document
+// unchanged.
+func Retain(n int) Component { return Component{typ: retainType, n: n} }
+
+// Insert returns a component that inserts text at the current position.
+func Insert(text string) Component { return Component{typ: insertType, text: text} }
+
+// Delete returns a component that skips n characters of the base document.
+func Delete(n int) Component { return Component{typ: deleteType, n: n} }
+
+// Operation is an ordered sequence of components, applied left to right
+// against consecutive positions of a base document.
+type Operation struct {
+	Components []Component
+}
+
+// baseLength is how many characters of the base document op consumes
+// (retain + delete); Apply and Compose require this to match the document
+// it's applied against.
+func baseLength(op Operation) int {
+	n := 0
+	for _, c := range op.Components {
+		if c.typ == retainType || c.typ == deleteType {
+			n += c.n
+		}
+	}
+	return n
+}
+
+// targetLength is how many characters the resulting document has after op
+// is applied (retain + insert).
+func targetLength(op Operation) int {
+	n := 0
+	for _, c := range op.Components {
+		switch c.typ {
+		case retainType:
+			n += c.n
+		case insertType:
+			n += len([]rune(c.text))
+		}
+	}
+	return n
+}
+
+// normalize merges adjacent components of the same type and drops
+// zero-length ones, so two operations built differently but describing the
+// same edit compare equal and downstream algorithms see fewer components.
+func normalize(components []Component) []Component {
+	var result []Component
+	for _, c := range components {
+		if c.typ != insertType && c.n == 0 {
+			continue
+		}
+		if c.typ == insertType && c.text == "" {
+			continue
+		}
+		if len(result) > 0 {
+			last := &result[len(result)-1]
+			if last.typ == c.typ {
+				if c.typ == insertType {
+					last.text += c.text
+				} else {
+					last.n += c.n
+				}
+				continue
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// Apply runs op against doc and returns the resulting text. It fails if
+// op's base length doesn't match doc's length -- the usual sign that op
+// was built against a different revision than doc represents.
+func Apply(doc string, op Operation) (string, error) {
+	runes := []rune(doc)
+	if baseLength(op) != len(runes) {
+		return "", fmt.Errorf("ot: operation base length %d does not match document length %d", baseLength(op), len(runes))
+	}
+
+	var builder strings.Builder
+	cursor := 0
+	for _, c := range op.Components {
+		switch c.typ {
+		case retainType:
+			builder.WriteString(string(runes[cursor : cursor+c.n]))
+			cursor += c.n
+		case insertType:
+			builder.WriteString(c.text)
+		case deleteType:
+			cursor += c.n
+		}
+	}
+	return builder.String(), nil
+}
+
+// Compose merges a and b, where b is applied to the document that results
+// from applying a, into a single operation equivalent to applying a then
+// b. It fails if b's base length doesn't match a's target length.
+func Compose(a, b Operation) (Operation, error) {
+	if baseLength(b) != targetLength(a) {
+		return Operation{}, fmt.Errorf("ot: compose: b's base length %d does not match a's target length %d", baseLength(b), targetLength(a))
+	}
+
+	var result []Component
+	ai, bi := 0, 0
+	var opA, opB *Component
+
+	for {
+		if opA == nil && ai < len(a.Components) {
+			c := a.Components[ai]
+			opA = &c
+			ai++
+		}
+		if opB == nil && bi < len(b.Components) {
+			c := b.Components[bi]
+			opB = &c
+			bi++
+		}
+		if opA == nil && opB == nil {
+			break
+		}
+
+		if opA != nil && opA.typ == deleteType {
+			result = append(result, *opA)
+			opA = nil
+			continue
+		}
+		if opB != nil && opB.typ == insertType {
+			result = append(result, *opB)
+			opB = nil
+			continue
+		}
+		if opA == nil || opB == nil {
+			return Operation{}, fmt.Errorf("ot: compose: operations disagree on document length")
+		}
+
+		switch {
+		case opA.typ == retainType && opB.typ == retainType:
+			switch {
+			case opA.n < opB.n:
+				result = append(result, Retain(opA.n))
+				opB.n -= opA.n
+				opA = nil
+			case opA.n == opB.n:
+				result = append(result, Retain(opA.n))
+				opA, opB = nil, nil
+			default:
+				result = append(result, Retain(opB.n))
+				opA.n -= opB.n
+				opB = nil
+			}
+		case opA.typ == insertType && opB.typ == retainType:
+			runes := []rune(opA.text)
+			switch {
+			case len(runes) < opB.n:
+				result = append(result, Insert(opA.text))
+				opB.n -= len(runes)
+				opA = nil
+			case len(runes) == opB.n:
+				result = append(result, Insert(opA.text))
+				opA, opB = nil, nil
+			default:
+				result = append(result, Insert(string(runes[:opB.n])))
+				opA.text = string(runes[opB.n:])
+				opB = nil
+			}
+		case opA.typ == insertType && opB.typ == deleteType:
+			runes := []rune(opA.text)
+			switch {
+			case len(runes) < opB.n:
+				opB.n -= len(runes)
+				opA = nil
+			case len(runes) == opB.n:
+				opA, opB = nil, nil
+			default:
+				opA.text = string(runes[opB.n:])
+				opB = nil
+			}
+		default:
+			return Operation{}, fmt.Errorf("ot: compose: unexpected component pair")
+		}
+	}
+
+	return Operation{Components: normalize(result)}, nil
+}
+
+// Transform reconciles two operations that were both built against the
+// same base document revision, returning (aPrime, bPrime) such that
+// Compose(a, bPrime) and Compose(b, aPrime) produce the same resulting
+// text -- the standard OT convergence property. Concurrent inserts at the
+// same position are ordered with a's insert first, consistently on every
+// replica that calls Transform(a, b) in the same argument order.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if baseLength(a) != baseLength(b) {
+		return Operation{}, Operation{}, fmt.Errorf("ot: transform: a's base length %d does not match b's base length %d", baseLength(a), baseLength(b))
+	}
+
+	var aPrime, bPrime []Component
+	ai, bi := 0, 0
+	var opA, opB *Component
+
+	for {
+		if opA == nil && ai < len(a.Components) {
+			c := a.Components[ai]
+			opA = &c
+			ai++
+		}
+		if opB == nil && bi < len(b.Components) {
+			c := b.Components[bi]
+			opB = &c
+			bi++
+		}
+		if opA == nil && opB == nil {
+			break
+		}
+
+		if opA != nil && opA.typ == insertType {
+			aPrime = append(aPrime, *opA)
+			bPrime = append(bPrime, Retain(len([]rune(opA.text))))
+			opA = nil
+			continue
+		}
+		if opB != nil && opB.typ == insertType {
+			aPrime = append(aPrime, Retain(len([]rune(opB.text))))
+			bPrime = append(bPrime, *opB)
+			opB = nil
+			continue
+		}
+		if opA == nil || opB == nil {
+			return Operation{}, Operation{}, fmt.Errorf("ot: transform: operations disagree on document length")
+		}
+
+		switch {
+		case opA.typ == retainType && opB.typ == retainType:
+			var n int
+			switch {
+			case opA.n < opB.n:
+				n = opA.n
+				opB.n -= opA.n
+				opA = nil
+			case opA.n == opB.n:
+				n = opA.n
+				opA, opB = nil, nil
+			default:
+				n = opB.n
+				opA.n -= opB.n
+				opB = nil
+			}
+			aPrime = append(aPrime, Retain(n))
+			bPrime = append(bPrime, Retain(n))
+		case opA.typ == deleteType && opB.typ == deleteType:
+			switch {
+			case opA.n < opB.n:
+				opB.n -= opA.n
+				opA = nil
+			case opA.n == opB.n:
+				opA, opB = nil, nil
+			default:
+				opA.n -= opB.n
+				opB = nil
+			}
+		case opA.typ == deleteType && opB.typ == retainType:
+			switch {
+			case opA.n < opB.n:
+				aPrime = append(aPrime, Delete(opA.n))
+				opB.n -= opA.n
+				opA = nil
+			case opA.n == opB.n:
+				aPrime = append(aPrime, Delete(opA.n))
+				opA, opB = nil, nil
+			default:
+				aPrime = append(aPrime, Delete(opB.n))
+				opA.n -= opB.n
+				opB = nil
+			}
+		case opA.typ == retainType && opB.typ == deleteType:
+			switch {
+			case opA.n < opB.n:
+				bPrime = append(bPrime, Delete(opA.n))
+				opB.n -= opA.n
+				opA = nil
+			case opA.n == opB.n:
+				bPrime = append(bPrime, Delete(opA.n))
+				opA, opB = nil, nil
+			default:
+				bPrime = append(bPrime, Delete(opB.n))
+				opA.n -= opB.n
+				opB = nil
+			}
+		default:
+			return Operation{}, Operation{}, fmt.Errorf("ot: transform: unexpected component pair")
+		}
+	}
+
+	return Operation{Components: normalize(aPrime)}, Operation{Components: normalize(bPrime)}, nil
+}
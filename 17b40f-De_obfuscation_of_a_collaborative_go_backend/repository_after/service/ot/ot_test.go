@@ -0,0 +1,161 @@
+package ot
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func mustApply(t *testing.T, doc string, op Operation) string {
+	t.Helper()
+	result, err := Apply(doc, op)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	return result
+}
+
+func TestApply_SingleClientInsertAndDelete(t *testing.T) {
+	doc := "hello"
+
+	inserted := mustApply(t, doc, Operation{Components: []Component{Retain(5), Insert(" world")}})
+	if inserted != "hello world" {
+		t.Fatalf("got %q, want %q", inserted, "hello world")
+	}
+
+	deleted := mustApply(t, doc, Operation{Components: []Component{Retain(1), Delete(4)}})
+	if deleted != "h" {
+		t.Fatalf("got %q, want %q", deleted, "h")
+	}
+}
+
+func TestTransform_ConcurrentInsertsAtSamePositionBothSurvive(t *testing.T) {
+	doc := "ab"
+	a := Operation{Components: []Component{Retain(1), Insert("X"), Retain(1)}}
+	b := Operation{Components: []Component{Retain(1), Insert("Y"), Retain(1)}}
+
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+
+	viaA := mustApply(t, mustApply(t, doc, a), bPrime)
+	viaB := mustApply(t, mustApply(t, doc, b), aPrime)
+
+	if viaA != viaB {
+		t.Fatalf("diverged: via a+b' = %q, via b+a' = %q", viaA, viaB)
+	}
+	if viaA != "aXYb" {
+		t.Fatalf("got %q, want both inserts present as %q", viaA, "aXYb")
+	}
+}
+
+func TestTransform_ConcurrentInsertAndDeleteOverlap(t *testing.T) {
+	doc := "hello world"
+	// a inserts "cruel " before "world".
+	a := Operation{Components: []Component{Retain(6), Insert("cruel "), Retain(5)}}
+	// b deletes "world" entirely.
+	b := Operation{Components: []Component{Retain(6), Delete(5)}}
+
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+
+	viaA := mustApply(t, mustApply(t, doc, a), bPrime)
+	viaB := mustApply(t, mustApply(t, doc, b), aPrime)
+
+	if viaA != viaB {
+		t.Fatalf("diverged: via a+b' = %q, via b+a' = %q", viaA, viaB)
+	}
+	if viaA != "hello cruel " {
+		t.Fatalf("got %q, want %q", viaA, "hello cruel ")
+	}
+}
+
+func TestCompose_SequentialEditsMatchApplyingBothInOrder(t *testing.T) {
+	doc := "hello"
+	a := Operation{Components: []Component{Retain(5), Insert(" world")}}
+	b := Operation{Components: []Component{Retain(6), Delete(5), Insert("there")}}
+
+	composed, err := Compose(a, b)
+	if err != nil {
+		t.Fatalf("Compose: %v", err)
+	}
+
+	viaCompose := mustApply(t, doc, composed)
+	viaSequential := mustApply(t, mustApply(t, doc, a), b)
+
+	if viaCompose != viaSequential {
+		t.Fatalf("got %q via compose, %q via sequential apply", viaCompose, viaSequential)
+	}
+}
+
+// randomOp builds a random retain/insert/delete operation whose base length
+// equals len(doc), for the fuzz test below.
+func randomOp(rng *rand.Rand, doc string) Operation {
+	runes := []rune(doc)
+	var components []Component
+	remaining := len(runes)
+
+	for remaining > 0 {
+		switch rng.Intn(3) {
+		case 0:
+			n := 1 + rng.Intn(remaining)
+			components = append(components, Retain(n))
+			remaining -= n
+		case 1:
+			n := 1 + rng.Intn(remaining)
+			components = append(components, Delete(n))
+			remaining -= n
+		default:
+			components = append(components, Insert(string(rune('a'+rng.Intn(26)))))
+		}
+	}
+	if rng.Intn(2) == 0 {
+		components = append(components, Insert(string(rune('a'+rng.Intn(26)))))
+	}
+	return Operation{Components: normalize(components)}
+}
+
+func TestTransform_FuzzRandomInterleavingsConverge(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		length := 1 + rng.Intn(10)
+		runes := make([]rune, length)
+		for j := range runes {
+			runes[j] = rune('a' + rng.Intn(26))
+		}
+		doc := string(runes)
+
+		a := randomOp(rng, doc)
+		b := randomOp(rng, doc)
+
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Transform(%v, %v) on doc %q: %v", a, b, doc, err)
+		}
+
+		viaA, err := Apply(doc, a)
+		if err != nil {
+			t.Fatalf("Apply a: %v", err)
+		}
+		viaA, err = Apply(viaA, bPrime)
+		if err != nil {
+			t.Fatalf("Apply b': %v", err)
+		}
+
+		viaB, err := Apply(doc, b)
+		if err != nil {
+			t.Fatalf("Apply b: %v", err)
+		}
+		viaB, err = Apply(viaB, aPrime)
+		if err != nil {
+			t.Fatalf("Apply a': %v", err)
+		}
+
+		if viaA != viaB {
+			t.Fatalf("doc %q: diverged: via a+b' = %q, via b+a' = %q (a=%v, b=%v)", doc, viaA, viaB, a, b)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Config describes how a node joins (or bootstraps) the Raft cluster.
+type Config struct {
+	NodeID    string
+	BindAddr  string
+	DataDir   string
+	Bootstrap bool // true only for the node that forms a brand-new cluster
+
+	// HTTPAddr is this node's own REST/WebSocket address. It is only used
+	// by RegisterSelf, to let other nodes resolve this node's HTTP address
+	// once it is admitted to the cluster (e.g. after it is elected leader).
+	HTTPAddr string
+
+	// SnapshotThreshold and SnapshotInterval bound recovery time by
+	// forcing a snapshot every N committed log entries or M minutes,
+	// whichever comes first. Zero values fall back to raft's defaults.
+	SnapshotThreshold uint64
+	SnapshotInterval  time.Duration
+}
+
+// Cluster wraps a raft.Raft node running the document FSM. Document
+// mutations should go through Apply rather than touching the cache
+// directly, so every node -- leader and followers -- converges on the same
+// state and a crash between Mongo flushes never loses a committed write.
+type Cluster struct {
+	raftNode *raft.Raft
+	fsm      *FSM
+	nodeID   string
+}
+
+func NewCluster(config Config) (*Cluster, error) {
+	fsm := NewFSM()
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(config.NodeID)
+	if config.SnapshotThreshold > 0 {
+		raftConfig.SnapshotThreshold = config.SnapshotThreshold
+	}
+	if config.SnapshotInterval > 0 {
+		raftConfig.SnapshotInterval = config.SnapshotInterval
+	}
+
+	if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("replication: creating data dir: %w", err)
+	}
+
+	snapshotStore, err := raft.NewFileSnapshotStore(config.DataDir, 2, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("replication: creating snapshot store: %w", err)
+	}
+
+	logStore := raft.NewInmemStore()
+	stableStore := raft.NewInmemStore()
+
+	tcpAddr, err := net.ResolveTCPAddr("tcp", config.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("replication: resolving bind address: %w", err)
+	}
+
+	transport, err := raft.NewTCPTransport(config.BindAddr, tcpAddr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("replication: creating transport: %w", err)
+	}
+
+	raftNode, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		return nil, fmt.Errorf("replication: starting raft: %w", err)
+	}
+
+	if config.Bootstrap {
+		raftNode.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{ID: raftConfig.LocalID, Address: transport.LocalAddr()},
+			},
+		})
+	}
+
+	return &Cluster{raftNode: raftNode, fsm: fsm, nodeID: config.NodeID}, nil
+}
+
+// OnApply registers the callback the FSM invokes after each committed
+// command, on every node in the cluster.
+func (c *Cluster) OnApply(callback func(documentID string, record DocumentRecord)) {
+	c.fsm.OnApply = callback
+}
+
+// Apply submits a command to the Raft log. Only the leader can do this
+// successfully -- call IsLeader first and forward to LeaderHTTPAddress
+// otherwise.
+func (c *Cluster) Apply(command Command, timeout time.Duration) error {
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	return c.raftNode.Apply(encoded, timeout).Error()
+}
+
+func (c *Cluster) IsLeader() bool {
+	return c.raftNode.State() == raft.Leader
+}
+
+// LeaderAddress returns the current leader's Raft bind address, or "" if
+// the cluster has no leader right now (e.g. mid-election).
+func (c *Cluster) LeaderAddress() string {
+	addr, _ := c.raftNode.LeaderWithID()
+	return string(addr)
+}
+
+// LeaderHTTPAddress returns the current leader's REST/WebSocket address, as
+// last registered via RegisterSelf/Join, so a follower can forward a
+// /documents/* write to the node that can actually commit it. The second
+// return value is false if there is no leader right now or the leader
+// hasn't registered an HTTP address yet.
+func (c *Cluster) LeaderHTTPAddress() (string, bool) {
+	_, leaderID := c.raftNode.LeaderWithID()
+	if leaderID == "" {
+		return "", false
+	}
+	return c.fsm.PeerHTTPAddr(string(leaderID))
+}
+
+func (c *Cluster) Document(documentID string) (DocumentRecord, bool) {
+	return c.fsm.Document(documentID)
+}
+
+// Join adds a voting member to the cluster and records its HTTP address so
+// every node can forward writes to it if it later becomes leader. Must be
+// called against the current leader.
+func (c *Cluster) Join(nodeID, raftAddr, httpAddr string) error {
+	if err := c.raftNode.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(raftAddr), 0, 0).Error(); err != nil {
+		return err
+	}
+	return c.Apply(Command{Type: CommandRegisterPeer, NodeID: nodeID, HTTPAddr: httpAddr}, 5*time.Second)
+}
+
+// RegisterSelf records this node's own HTTP address in the replicated peer
+// map. Call it once this node becomes leader (e.g. the node that
+// bootstrapped the cluster never goes through Join), so LeaderHTTPAddress
+// resolves correctly on every other node.
+func (c *Cluster) RegisterSelf(httpAddr string) error {
+	return c.Apply(Command{Type: CommandRegisterPeer, NodeID: c.nodeID, HTTPAddr: httpAddr}, 5*time.Second)
+}
+
+// Leave removes a member from the cluster. Must be called against the
+// current leader.
+func (c *Cluster) Leave(nodeID string) error {
+	return c.raftNode.RemoveServer(raft.ServerID(nodeID), 0, 0).Error()
+}
+
+// Shutdown gracefully stops this node's participation in the cluster.
+func (c *Cluster) Shutdown() error {
+	return c.raftNode.Shutdown().Error()
+}
@@ -0,0 +1,254 @@
+// Package replication makes document mutations durable and consistent
+// across multiple server instances by routing them through a Raft log
+// instead of writing straight to the in-process cache.
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	"github.com/khallihub/godoc/service/crdt"
+)
+
+// CommandType enumerates the document mutations that flow through the Raft
+// log, so every node applies them in the same order the leader committed
+// them in.
+type CommandType string
+
+const (
+	CommandUpdateDocument      CommandType = "update_document"
+	CommandUpdateTitle         CommandType = "update_title"
+	CommandUpdateCollaborators CommandType = "update_collaborators"
+	CommandCRDTOp              CommandType = "crdt_op"
+
+	// CommandRegisterPeer carries a cluster member's HTTP address through
+	// the Raft log, so every node -- not just the one that handled the
+	// /admin/cluster/join call -- can resolve the current leader's HTTP
+	// address for request forwarding after a leadership change.
+	CommandRegisterPeer CommandType = "register_peer"
+)
+
+// Command is the payload of a single Raft log entry.
+type Command struct {
+	Type        CommandType `json:"type"`
+	DocumentID  string      `json:"documentId,omitempty"`
+	Content     string      `json:"content,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	ReadAccess  []string    `json:"readAccess,omitempty"`
+	WriteAccess []string    `json:"writeAccess,omitempty"`
+	Op          *crdt.Op    `json:"op,omitempty"`
+
+	// NodeID and HTTPAddr are only set on CommandRegisterPeer entries.
+	NodeID   string `json:"nodeId,omitempty"`
+	HTTPAddr string `json:"httpAddr,omitempty"`
+}
+
+// DocumentRecord is the FSM's view of a single document: current content
+// and metadata, plus the tail of CRDT ops applied since the last snapshot.
+type DocumentRecord struct {
+	Content     string    `json:"content"`
+	Title       string    `json:"title"`
+	ReadAccess  []string  `json:"readAccess"`
+	WriteAccess []string  `json:"writeAccess"`
+	OpLogTail   []crdt.Op `json:"opLogTail"`
+}
+
+// opLogTailLimit bounds how many CRDT ops each DocumentRecord keeps around
+// once Content already reflects them, so a chatty document's tail doesn't
+// grow without bound between snapshots.
+const opLogTailLimit = 200
+
+// FSM applies committed Raft log entries to an in-memory document map. It
+// implements raft.FSM, so hashicorp/raft drives Apply/Snapshot/Restore
+// directly as entries commit or a node catches up from a snapshot.
+type FSM struct {
+	mutex         sync.Mutex
+	documents     map[string]*DocumentRecord
+	peerHTTPAddrs map[string]string
+
+	// crdtDocs lazily materializes each document's CRDT state so
+	// CommandCRDTOp can fold a single op into record.Content without
+	// replaying the whole op-log tail on every keystroke. It is derived
+	// state -- never persisted directly -- and is rebuilt on demand by
+	// reseeding from record.Content, which Snapshot/Restore already cover.
+	crdtDocs map[string]*crdt.Document
+
+	// OnApply, if set, is invoked after every successfully applied document
+	// command with a copy of the affected document's resulting state.
+	// server.go uses this to mirror the committed state into documentCache
+	// and rebroadcast to any local WebSocket connections for that document,
+	// on both the leader and every follower. It is not invoked for
+	// CommandRegisterPeer entries, which carry no document state.
+	OnApply func(documentID string, record DocumentRecord)
+}
+
+func NewFSM() *FSM {
+	return &FSM{
+		documents:     make(map[string]*DocumentRecord),
+		peerHTTPAddrs: make(map[string]string),
+		crdtDocs:      make(map[string]*crdt.Document),
+	}
+}
+
+// crdtDocFor returns the cached CRDT for documentID, materializing a fresh
+// one from seedContent the first time this document is touched (e.g. after
+// a Restore, or on a node seeing its first op for it).
+func (f *FSM) crdtDocFor(documentID, seedContent string) *crdt.Document {
+	if doc, exists := f.crdtDocs[documentID]; exists {
+		return doc
+	}
+
+	doc := crdt.NewDocument("fsm")
+	previous := crdt.Identifier{}
+	for _, ch := range seedContent {
+		op := doc.NextInsert(previous, string(ch))
+		doc.Apply(op)
+		previous = op.ID
+	}
+	f.crdtDocs[documentID] = doc
+	return doc
+}
+
+func (f *FSM) Apply(logEntry *raft.Log) interface{} {
+	var command Command
+	if err := json.Unmarshal(logEntry.Data, &command); err != nil {
+		return fmt.Errorf("replication: invalid command: %w", err)
+	}
+
+	if command.Type == CommandRegisterPeer {
+		f.mutex.Lock()
+		f.peerHTTPAddrs[command.NodeID] = command.HTTPAddr
+		f.mutex.Unlock()
+		return nil
+	}
+
+	f.mutex.Lock()
+	record, exists := f.documents[command.DocumentID]
+	if !exists {
+		record = &DocumentRecord{}
+		f.documents[command.DocumentID] = record
+	}
+
+	switch command.Type {
+	case CommandUpdateDocument:
+		record.Content = command.Content
+	case CommandUpdateTitle:
+		record.Title = command.Title
+	case CommandUpdateCollaborators:
+		record.ReadAccess = command.ReadAccess
+		record.WriteAccess = command.WriteAccess
+	case CommandCRDTOp:
+		if command.Op != nil {
+			doc := f.crdtDocFor(command.DocumentID, record.Content)
+			doc.Apply(*command.Op)
+			record.Content = doc.Materialize()
+
+			record.OpLogTail = append(record.OpLogTail, *command.Op)
+			if len(record.OpLogTail) > opLogTailLimit {
+				record.OpLogTail = record.OpLogTail[len(record.OpLogTail)-opLogTailLimit:]
+			}
+		}
+	}
+	recordCopy := *record
+	f.mutex.Unlock()
+
+	if f.OnApply != nil {
+		f.OnApply(command.DocumentID, recordCopy)
+	}
+
+	return nil
+}
+
+// Document returns the FSM's current view of a document, if any.
+func (f *FSM) Document(documentID string) (DocumentRecord, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	record, exists := f.documents[documentID]
+	if !exists {
+		return DocumentRecord{}, false
+	}
+	return *record, true
+}
+
+// PeerHTTPAddr returns the HTTP address a cluster member registered under
+// nodeID, if any node has ever submitted a CommandRegisterPeer for it.
+func (f *FSM) PeerHTTPAddr(nodeID string) (string, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	addr, exists := f.peerHTTPAddrs[nodeID]
+	return addr, exists
+}
+
+type fsmSnapshot struct {
+	Documents     map[string]*DocumentRecord `json:"documents"`
+	PeerHTTPAddrs map[string]string          `json:"peerHttpAddrs"`
+}
+
+// Snapshot serializes the full document map plus each document's op-log
+// tail, taken periodically (see Config.SnapshotThreshold/SnapshotInterval)
+// so a restarted node can catch up without replaying the entire Raft log.
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	documentsCopy := make(map[string]*DocumentRecord, len(f.documents))
+	for documentID, record := range f.documents {
+		recordCopy := *record
+		documentsCopy[documentID] = &recordCopy
+	}
+
+	peersCopy := make(map[string]string, len(f.peerHTTPAddrs))
+	for nodeID, addr := range f.peerHTTPAddrs {
+		peersCopy[nodeID] = addr
+	}
+
+	return &fsmSnapshot{Documents: documentsCopy, PeerHTTPAddrs: peersCopy}, nil
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	if _, err := sink.Write(encoded); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
+
+// Restore rebuilds the document map from the most recent snapshot. Raft
+// calls this on startup when a node has a snapshot newer than its log.
+func (f *FSM) Restore(snapshotReader io.ReadCloser) error {
+	defer snapshotReader.Close()
+
+	var snapshot fsmSnapshot
+	if err := json.NewDecoder(snapshotReader).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if snapshot.Documents == nil {
+		snapshot.Documents = make(map[string]*DocumentRecord)
+	}
+	if snapshot.PeerHTTPAddrs == nil {
+		snapshot.PeerHTTPAddrs = make(map[string]string)
+	}
+	f.documents = snapshot.Documents
+	f.peerHTTPAddrs = snapshot.PeerHTTPAddrs
+	f.crdtDocs = make(map[string]*crdt.Document)
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/khallihub/godoc/service/crdt"
+)
+
+func applyCommand(t *testing.T, fsm *FSM, command Command) {
+	t.Helper()
+
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		t.Fatalf("marshal command: %v", err)
+	}
+
+	if result := fsm.Apply(&raft.Log{Data: encoded}); result != nil {
+		t.Fatalf("Apply returned unexpected error: %v", result)
+	}
+}
+
+func TestFSM_ApplyUpdatesDocument(t *testing.T) {
+	fsm := NewFSM()
+
+	applyCommand(t, fsm, Command{Type: CommandUpdateDocument, DocumentID: "doc1", Content: "hello"})
+	applyCommand(t, fsm, Command{Type: CommandUpdateTitle, DocumentID: "doc1", Title: "My Doc"})
+
+	record, exists := fsm.Document("doc1")
+	if !exists {
+		t.Fatal("expected doc1 to exist after Apply")
+	}
+	if record.Content != "hello" || record.Title != "My Doc" {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+}
+
+func TestFSM_OnApplyCallbackFires(t *testing.T) {
+	fsm := NewFSM()
+
+	var gotDocumentID string
+	var gotRecord DocumentRecord
+	fsm.OnApply = func(documentID string, record DocumentRecord) {
+		gotDocumentID = documentID
+		gotRecord = record
+	}
+
+	applyCommand(t, fsm, Command{Type: CommandUpdateDocument, DocumentID: "doc1", Content: "hi"})
+
+	if gotDocumentID != "doc1" || gotRecord.Content != "hi" {
+		t.Fatalf("expected OnApply callback with doc1/hi, got %q/%+v", gotDocumentID, gotRecord)
+	}
+}
+
+func TestFSM_CRDTOpMaterializesContent(t *testing.T) {
+	fsm := NewFSM()
+	source := crdt.NewDocument("site-a")
+
+	opA := source.NextInsert(crdt.Identifier{}, "h")
+	source.Apply(opA)
+	opB := source.NextInsert(opA.ID, "i")
+	source.Apply(opB)
+
+	applyCommand(t, fsm, Command{Type: CommandCRDTOp, DocumentID: "doc1", Op: &opA})
+	applyCommand(t, fsm, Command{Type: CommandCRDTOp, DocumentID: "doc1", Op: &opB})
+
+	record, exists := fsm.Document("doc1")
+	if !exists {
+		t.Fatal("expected doc1 to exist after applying CRDT ops")
+	}
+	if record.Content != "hi" {
+		t.Fatalf("expected materialized content %q, got %q", "hi", record.Content)
+	}
+	if len(record.OpLogTail) != 2 {
+		t.Fatalf("expected 2 ops in the tail, got %d", len(record.OpLogTail))
+	}
+}
+
+func TestFSM_SnapshotAndRestoreRoundTrip(t *testing.T) {
+	fsm := NewFSM()
+	applyCommand(t, fsm, Command{Type: CommandUpdateDocument, DocumentID: "doc1", Content: "persisted"})
+	applyCommand(t, fsm, Command{Type: CommandRegisterPeer, NodeID: "node2", HTTPAddr: "10.0.0.2:8080"})
+
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := snapshot.Persist(&fakeSnapshotSink{Buffer: &buf}); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	restored := NewFSM()
+	if err := restored.Restore(io.NopCloser(&buf)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	record, exists := restored.Document("doc1")
+	if !exists || record.Content != "persisted" {
+		t.Fatalf("expected restored doc1 with content %q, got exists=%v record=%+v", "persisted", exists, record)
+	}
+
+	if addr, exists := restored.PeerHTTPAddr("node2"); !exists || addr != "10.0.0.2:8080" {
+		t.Fatalf("expected restored peer address 10.0.0.2:8080 for node2, got exists=%v addr=%q", exists, addr)
+	}
+}
+
+func TestFSM_RegisterPeerDoesNotFireOnApply(t *testing.T) {
+	fsm := NewFSM()
+
+	fsm.OnApply = func(documentID string, record DocumentRecord) {
+		t.Fatalf("OnApply should not fire for CommandRegisterPeer, got documentID=%q record=%+v", documentID, record)
+	}
+
+	applyCommand(t, fsm, Command{Type: CommandRegisterPeer, NodeID: "node1", HTTPAddr: "10.0.0.1:8080"})
+
+	addr, exists := fsm.PeerHTTPAddr("node1")
+	if !exists || addr != "10.0.0.1:8080" {
+		t.Fatalf("expected peer address 10.0.0.1:8080 for node1, got exists=%v addr=%q", exists, addr)
+	}
+}
+
+// fakeSnapshotSink is the minimal raft.SnapshotSink needed to exercise
+// FSM.Snapshot().Persist in isolation, without standing up a real raft node.
+type fakeSnapshotSink struct {
+	*bytes.Buffer
+}
+
+func (f *fakeSnapshotSink) ID() string     { return "test-snapshot" }
+func (f *fakeSnapshotSink) Cancel() error  { return nil }
+func (f *fakeSnapshotSink) Close() error   { return nil }
@@ -0,0 +1,397 @@
+// Package wal implements an append-only, per-document write-ahead log so a
+// crash between syncDatabaseWithCache's 30-second flushes doesn't silently
+// drop edits that were already acknowledged to a client. handleWebSocket
+// appends each inbound change before broadcasting it; syncDatabaseWithCache
+// compacts the log once a document's content is durably flushed to Mongo.
+package wal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy controls how aggressively Append durably persists a write
+// before returning, trading latency against how much data a crash could
+// still lose between Append and the next fsync.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways calls fsync after every Append -- no data loss, but an
+	// fsync on the hot path of every keystroke.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval batches fsyncs, calling one at most every
+	// Options.FsyncInterval.
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncOS leaves durability to the OS's own writeback schedule.
+	FsyncOS FsyncPolicy = "os"
+)
+
+// Options configures a WAL.
+type Options struct {
+	DataDir string
+
+	// SegmentSize rotates a document's log to a new segment file once the
+	// current one reaches this many bytes, so Compact can drop whole
+	// flushed segments instead of rewriting a single ever-growing file.
+	// Zero falls back to an 8MiB default.
+	SegmentSize int64
+
+	Fsync FsyncPolicy
+	// FsyncInterval is only used when Fsync == FsyncInterval.
+	FsyncInterval time.Duration
+}
+
+// Record is one durable append: the full materialized content of a
+// document at Offset, the monotonically increasing sequence number within
+// that document's log.
+type Record struct {
+	Offset  uint64 `json:"offset"`
+	Content string `json:"content"`
+}
+
+// documentLog is the mutable state for a single document's active
+// segment. entry is guarded by mutex rather than WAL.mutex so appends to
+// different documents never block each other.
+type documentLog struct {
+	mutex            sync.Mutex
+	file             *os.File
+	segmentIndex     int
+	segmentBytes     int64
+	nextOffset       uint64
+	compactedThrough uint64
+	lastFsync        time.Time
+}
+
+// WAL is an append-only, per-document write-ahead log rooted at a data
+// directory, with one or more numbered segment files per document.
+type WAL struct {
+	options Options
+	mutex   sync.Mutex
+	logs    map[string]*documentLog
+}
+
+// Open prepares dataDir (creating it if necessary) and returns a WAL
+// rooted there. It does not eagerly open a segment for every document --
+// logFor does that lazily on first Append.
+func Open(options Options) (*WAL, error) {
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = 8 << 20
+	}
+	if options.Fsync == "" {
+		options.Fsync = FsyncOS
+	}
+	if err := os.MkdirAll(options.DataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: creating data dir: %w", err)
+	}
+	return &WAL{options: options, logs: make(map[string]*documentLog)}, nil
+}
+
+func (w *WAL) segmentPath(documentID string, index int) string {
+	return filepath.Join(w.options.DataDir, fmt.Sprintf("%s.%04d.wal", documentID, index))
+}
+
+// documentSegments returns every existing segment index for documentID,
+// sorted ascending.
+func (w *WAL) documentSegments(documentID string) ([]int, error) {
+	entries, err := os.ReadDir(w.options.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("wal: reading data dir: %w", err)
+	}
+
+	prefix := documentID + "."
+	var indexes []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		rawIndex := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".wal")
+		index, err := strconv.Atoi(rawIndex)
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+
+	for i := 1; i < len(indexes); i++ {
+		for j := i; j > 0 && indexes[j-1] > indexes[j]; j-- {
+			indexes[j-1], indexes[j] = indexes[j], indexes[j-1]
+		}
+	}
+	return indexes, nil
+}
+
+func readSegment(path string) ([]Record, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("wal: reading segment %s: %w", path, err)
+	}
+
+	var records []Record
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// logFor returns (opening or creating if needed) the active segment for
+// documentID, continuing its offset sequence from whatever was already on
+// disk so a restart doesn't reuse offsets from before the crash.
+func (w *WAL) logFor(documentID string) (*documentLog, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if log, exists := w.logs[documentID]; exists {
+		return log, nil
+	}
+
+	segments, err := w.documentSegments(documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	index := 0
+	var nextOffset uint64
+	if len(segments) > 0 {
+		index = segments[len(segments)-1]
+		records, err := readSegment(w.segmentPath(documentID, index))
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			nextOffset = records[len(records)-1].Offset + 1
+		}
+	}
+
+	file, err := os.OpenFile(w.segmentPath(documentID, index), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: opening segment: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("wal: stat segment: %w", err)
+	}
+
+	log := &documentLog{file: file, segmentIndex: index, segmentBytes: stat.Size(), nextOffset: nextOffset}
+	w.logs[documentID] = log
+	return log, nil
+}
+
+// Append durably records content as the latest state of documentID and
+// returns the offset it was assigned. Call it before acknowledging or
+// broadcasting the change that produced content.
+func (w *WAL) Append(documentID, content string) (uint64, error) {
+	log, err := w.logFor(documentID)
+	if err != nil {
+		return 0, err
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	record := Record{Offset: log.nextOffset, Content: content}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return 0, fmt.Errorf("wal: encoding record: %w", err)
+	}
+	encoded = append(encoded, '\n')
+
+	if _, err := log.file.Write(encoded); err != nil {
+		return 0, fmt.Errorf("wal: appending: %w", err)
+	}
+	log.segmentBytes += int64(len(encoded))
+	log.nextOffset++
+
+	switch w.options.Fsync {
+	case FsyncAlways:
+		if err := log.file.Sync(); err != nil {
+			return record.Offset, fmt.Errorf("wal: fsync: %w", err)
+		}
+	case FsyncInterval:
+		if time.Since(log.lastFsync) >= w.options.FsyncInterval {
+			if err := log.file.Sync(); err == nil {
+				log.lastFsync = time.Now()
+			}
+		}
+	}
+
+	if log.segmentBytes >= w.options.SegmentSize {
+		if err := w.rotate(documentID, log); err != nil {
+			return record.Offset, err
+		}
+	}
+
+	return record.Offset, nil
+}
+
+// rotate closes the current segment and opens the next one. Callers must
+// hold log.mutex.
+func (w *WAL) rotate(documentID string, log *documentLog) error {
+	log.file.Close()
+	log.segmentIndex++
+	log.segmentBytes = 0
+
+	file, err := os.OpenFile(w.segmentPath(documentID, log.segmentIndex), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: rotating segment: %w", err)
+	}
+	log.file = file
+	return nil
+}
+
+// Replay scans every document's segments on disk and returns each
+// document's most recently appended content, for recovering edits that
+// were acknowledged to a client but never reached a syncDatabaseWithCache
+// tick before a crash. Call it once at startup, before any Append.
+func (w *WAL) Replay() (map[string]string, error) {
+	entries, err := os.ReadDir(w.options.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("wal: reading data dir: %w", err)
+	}
+
+	documentIDs := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		if dot := strings.LastIndex(strings.TrimSuffix(name, ".wal"), "."); dot >= 0 {
+			documentIDs[name[:dot]] = true
+		}
+	}
+
+	recovered := make(map[string]string, len(documentIDs))
+	for documentID := range documentIDs {
+		segments, err := w.documentSegments(documentID)
+		if err != nil {
+			return nil, err
+		}
+
+		var latest string
+		var seenAny bool
+		for _, index := range segments {
+			records, err := readSegment(w.segmentPath(documentID, index))
+			if err != nil {
+				return nil, err
+			}
+			if len(records) > 0 {
+				latest = records[len(records)-1].Content
+				seenAny = true
+			}
+		}
+		if seenAny {
+			recovered[documentID] = latest
+		}
+	}
+
+	return recovered, nil
+}
+
+// LatestOffset returns the offset of the most recent Append for
+// documentID, or false if nothing has been appended for it this process.
+func (w *WAL) LatestOffset(documentID string) (uint64, bool) {
+	w.mutex.Lock()
+	log, exists := w.logs[documentID]
+	w.mutex.Unlock()
+	if !exists {
+		return 0, false
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.nextOffset == 0 {
+		return 0, false
+	}
+	return log.nextOffset - 1, true
+}
+
+// Compact records that documentID's content is now durably persisted
+// elsewhere (Mongo) up through upToOffset, then deletes any sealed segment
+// whose newest record is already covered by that. The active segment still
+// being appended to is never deleted.
+func (w *WAL) Compact(documentID string, upToOffset uint64) error {
+	w.mutex.Lock()
+	log, exists := w.logs[documentID]
+	w.mutex.Unlock()
+
+	if exists {
+		log.mutex.Lock()
+		if upToOffset > log.compactedThrough {
+			log.compactedThrough = upToOffset
+		}
+		activeIndex := log.segmentIndex
+		log.mutex.Unlock()
+
+		segments, err := w.documentSegments(documentID)
+		if err != nil {
+			return err
+		}
+		for _, index := range segments {
+			if index == activeIndex {
+				continue
+			}
+			path := w.segmentPath(documentID, index)
+			records, err := readSegment(path)
+			if err != nil || len(records) == 0 {
+				continue
+			}
+			if records[len(records)-1].Offset <= upToOffset {
+				os.Remove(path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Lag reports how many appended records for documentID have not yet been
+// compacted, i.e. how many edits could still be lost to a crash right now.
+func (w *WAL) Lag(documentID string) uint64 {
+	w.mutex.Lock()
+	log, exists := w.logs[documentID]
+	w.mutex.Unlock()
+	if !exists {
+		return 0
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.nextOffset == 0 || log.nextOffset-1 < log.compactedThrough {
+		return 0
+	}
+	return log.nextOffset - 1 - log.compactedThrough
+}
+
+// LagByDocument reports Lag for every document this process has appended
+// to, for the WAL lag metrics endpoint.
+func (w *WAL) LagByDocument() map[string]uint64 {
+	w.mutex.Lock()
+	documentIDs := make([]string, 0, len(w.logs))
+	for documentID := range w.logs {
+		documentIDs = append(documentIDs, documentID)
+	}
+	w.mutex.Unlock()
+
+	lag := make(map[string]uint64, len(documentIDs))
+	for _, documentID := range documentIDs {
+		lag[documentID] = w.Lag(documentID)
+	}
+	return lag
+}
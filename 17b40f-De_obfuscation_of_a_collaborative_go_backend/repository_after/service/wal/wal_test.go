@@ -0,0 +1,119 @@
+package wal
+
+import (
+	"testing"
+)
+
+func TestWAL_AppendAndReplayRecoversLatestContent(t *testing.T) {
+	w, err := Open(Options{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if _, err := w.Append("doc1", "h"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if _, err := w.Append("doc1", "hi"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	recovered, err := w.Replay()
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if recovered["doc1"] != "hi" {
+		t.Fatalf("expected recovered content %q, got %q", "hi", recovered["doc1"])
+	}
+}
+
+func TestWAL_ReplaySurvivesReopen(t *testing.T) {
+	dataDir := t.TempDir()
+
+	w1, err := Open(Options{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := w1.Append("doc1", "persisted"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	w2, err := Open(Options{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	recovered, err := w2.Replay()
+	if err != nil {
+		t.Fatalf("Replay after reopen: %v", err)
+	}
+	if recovered["doc1"] != "persisted" {
+		t.Fatalf("expected recovered content %q, got %q", "persisted", recovered["doc1"])
+	}
+
+	offset, err := w2.Append("doc1", "persisted more")
+	if err != nil {
+		t.Fatalf("Append after reopen: %v", err)
+	}
+	if offset != 1 {
+		t.Fatalf("expected offset sequence to continue at 1, got %d", offset)
+	}
+}
+
+func TestWAL_CompactDropsOnlySegmentsCoveredByTheFlushedOffset(t *testing.T) {
+	w, err := Open(Options{DataDir: t.TempDir(), SegmentSize: 1})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if _, err := w.Append("doc1", "a"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	flushedOffset, err := w.Append("doc1", "ab")
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if _, err := w.Append("doc1", "abc"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// Simulate syncDatabaseWithCache: "ab" made it to Mongo, but "abc" is
+	// still only in the WAL -- compacting up to flushedOffset must not
+	// lose it.
+	if err := w.Compact("doc1", flushedOffset); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	recovered, err := w.Replay()
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if recovered["doc1"] != "abc" {
+		t.Fatalf("expected the unflushed record to survive compaction with content %q, got %q", "abc", recovered["doc1"])
+	}
+}
+
+func TestWAL_LagTracksUncompactedOffsets(t *testing.T) {
+	w, err := Open(Options{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if _, err := w.Append("doc1", "a"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if _, err := w.Append("doc1", "ab"); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	if lag := w.Lag("doc1"); lag != 1 {
+		t.Fatalf("expected lag 1 before compaction, got %d", lag)
+	}
+
+	lastOffset, _ := w.LatestOffset("doc1")
+	if err := w.Compact("doc1", lastOffset); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	if lag := w.Lag("doc1"); lag != 0 {
+		t.Fatalf("expected lag 0 after compaction, got %d", lag)
+	}
+}
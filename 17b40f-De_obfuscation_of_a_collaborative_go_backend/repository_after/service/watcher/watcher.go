@@ -0,0 +1,160 @@
+// Package watcher keeps documentCache from going stale between
+// syncDatabaseWithCache ticks by watching the documents collection directly
+// for changes made out of band -- an admin fix-up, another service, or a
+// replica that wrote straight to Mongo.
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventType enumerates the change-stream operation types DocumentWatcher
+// reacts to. Inserts are ignored: a document only enters documentCache
+// through the existing GetOneDocument/CreateNewDocument paths.
+type EventType string
+
+const (
+	EventUpdate  EventType = "update"
+	EventReplace EventType = "replace"
+	EventDelete  EventType = "delete"
+)
+
+// Event describes a single out-of-band change to a cached document.
+// Content and Title are the zero value on EventDelete, since the document
+// no longer exists to read them from.
+type Event struct {
+	Type       EventType
+	DocumentID string
+	Content    string
+	Title      string
+}
+
+// DocumentWatcher tails the documents collection's change stream and
+// reports every update/replace/delete for a document IsWatched currently
+// returns true for, so the caller can refresh or evict its cache and
+// rebroadcast the change to any live WebSocket connections.
+type DocumentWatcher struct {
+	collection      *mongo.Collection
+	resumeTokenPath string
+
+	// IsWatched reports whether documentID is present in the caller's
+	// cache right now. Events for documents it returns false for are
+	// dropped -- DocumentWatcher has no cache of its own to keep in sync.
+	IsWatched func(documentID string) bool
+
+	// OnEvent is invoked for every change-stream event IsWatched accepted.
+	OnEvent func(Event)
+}
+
+// New returns a watcher over collection. resumeTokenPath is where the last
+// processed resume token is persisted between restarts, so Run doesn't
+// replay (or miss) events across a process restart; pass "" to disable
+// persistence and always start from the current moment.
+func New(collection *mongo.Collection, resumeTokenPath string) *DocumentWatcher {
+	return &DocumentWatcher{collection: collection, resumeTokenPath: resumeTokenPath}
+}
+
+// Run opens the change stream and blocks, delivering events to OnEvent
+// until ctx is cancelled or the stream errors. Callers typically run it in
+// its own goroutine, gated behind a config flag, since standalone MongoDB
+// deployments (no replica set) don't support change streams at all.
+func (w *DocumentWatcher) Run(ctx context.Context) error {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"update", "replace", "delete"}}}},
+		}}},
+	}
+
+	streamOptions := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token := w.loadResumeToken(); token != nil {
+		streamOptions.SetResumeAfter(token)
+	}
+
+	stream, err := w.collection.Watch(ctx, pipeline, streamOptions)
+	if err != nil {
+		return fmt.Errorf("watcher: opening change stream: %w", err)
+	}
+	defer stream.Close(ctx)
+
+	for stream.Next(ctx) {
+		var raw struct {
+			OperationType string `bson:"operationType"`
+			DocumentKey   struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument struct {
+				Title string `bson:"title"`
+				Data  struct {
+					Content string `bson:"content"`
+				} `bson:"data"`
+			} `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&raw); err != nil {
+			continue
+		}
+
+		w.saveResumeToken(stream.ResumeToken())
+
+		if w.IsWatched == nil || !w.IsWatched(raw.DocumentKey.ID) {
+			continue
+		}
+
+		event := Event{DocumentID: raw.DocumentKey.ID}
+		switch raw.OperationType {
+		case "update":
+			event.Type = EventUpdate
+			event.Content = raw.FullDocument.Data.Content
+			event.Title = raw.FullDocument.Title
+		case "replace":
+			event.Type = EventReplace
+			event.Content = raw.FullDocument.Data.Content
+			event.Title = raw.FullDocument.Title
+		case "delete":
+			event.Type = EventDelete
+		default:
+			continue
+		}
+
+		if w.OnEvent != nil {
+			w.OnEvent(event)
+		}
+	}
+
+	return stream.Err()
+}
+
+func (w *DocumentWatcher) loadResumeToken() bson.Raw {
+	if w.resumeTokenPath == "" {
+		return nil
+	}
+
+	encoded, err := os.ReadFile(w.resumeTokenPath)
+	if err != nil {
+		return nil
+	}
+
+	var token bson.Raw
+	if err := json.Unmarshal(encoded, &token); err != nil {
+		return nil
+	}
+	return token
+}
+
+func (w *DocumentWatcher) saveResumeToken(token bson.Raw) {
+	if w.resumeTokenPath == "" || token == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(w.resumeTokenPath, encoded, 0o644)
+}
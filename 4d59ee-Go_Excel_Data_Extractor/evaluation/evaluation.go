@@ -12,6 +12,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,6 +20,11 @@ import (
 	"time"
 )
 
+var (
+	publishToSheets = flag.Bool("sheets", false, "publish the run to Google Sheets (requires GOOGLE_APPLICATION_CREDENTIALS and SHEETS_SPREADSHEET_ID)")
+	sheetsDryRun    = flag.Bool("dry-run", false, "print the Sheets row instead of sending it; implies -sheets")
+)
+
 func runEvaluation() *Results {
 	fmt.Printf("\n%s\n", strings.Repeat("=", 60))
 	fmt.Println("GO EXCEL DATA EXTRACTOR EVALUATION")
@@ -86,6 +92,16 @@ func runEvaluation() *Results {
 }
 
 func main() {
+	flag.Parse()
+
+	if *serveHistory != "" {
+		if err := runHistoryServer(*serveHistory); err != nil {
+			fmt.Println("Error serving history API:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	runID := generateRunID()
 	startedAt := time.Now()
 
@@ -119,6 +135,18 @@ func main() {
 			fmt.Printf("\n❌ Failed to save report: %v\n", err)
 		}
 
+		if *publishToSheets || *sheetsDryRun {
+			if err := publishReportToSheets(report); err != nil {
+				fmt.Printf("⚠️  Sheets publish failed (continuing): %v\n", err)
+			}
+		}
+
+		if !*noDB {
+			if err := saveReportHistory(report); err != nil {
+				fmt.Printf("⚠️  Postgres history save failed (continuing): %v\n", err)
+			}
+		}
+
 		fmt.Printf("\n%s\n", strings.Repeat("=", 60))
 		fmt.Println("EVALUATION COMPLETE")
 		fmt.Printf("%s\n", strings.Repeat("=", 60))
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-excel-extractor/evaluation/storage"
+)
+
+var (
+	noDB         = flag.Bool("no-db", false, "skip Postgres history (report.json / Sheets publishing still work)")
+	serveHistory = flag.String("serve-history", "", "serve the run-history HTTP API (/runs, /runs/{id}, /tests/{nodeid}/history, /trends) on this address instead of running the evaluation")
+)
+
+// saveReportHistory connects to Postgres (DATABASE_URL), migrates if
+// needed, and records report. It's a no-op returning nil when -no-db is
+// set or DATABASE_URL is empty, so the tool keeps working without Postgres.
+func saveReportHistory(report Report) error {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store, err := NewHistoryStore(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.SaveReport(ctx, report)
+}
+
+// runHistoryServer blocks serving the trend-query HTTP API against
+// DATABASE_URL. Used when -serve-history is passed instead of running an
+// evaluation.
+func runHistoryServer(addr string) error {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return fmt.Errorf("history: DATABASE_URL is required to serve history")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	store, err := NewHistoryStore(ctx, dsn)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	fmt.Printf("Serving run-history API on %s\n", addr)
+	return http.ListenAndServe(addr, store)
+}
+
+// HistoryStore persists Report history to Postgres and answers the trend
+// queries exposed over HTTP.
+type HistoryStore struct {
+	db *sql.DB
+}
+
+// NewHistoryStore connects to Postgres at dsn and applies pending
+// migrations.
+func NewHistoryStore(ctx context.Context, dsn string) (*HistoryStore, error) {
+	db, err := storage.NewPostgresDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &HistoryStore{db: db}, nil
+}
+
+func (h *HistoryStore) Close() error { return h.db.Close() }
+
+// SaveReport writes a full Report (run row, before/after summaries, and
+// every per-test outcome) inside a single transaction so a partial insert
+// never corrupts a run.
+func (h *HistoryStore) SaveReport(ctx context.Context, report Report) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("history: begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO runs (run_id, started_at, finished_at, duration_seconds, success, go_version, os, arch, git_commit, git_branch)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (run_id) DO NOTHING`,
+		report.RunID, report.StartedAt, report.FinishedAt, report.DurationSeconds, report.Success,
+		report.Environment.GoVersion, report.Environment.OS, report.Environment.Architecture,
+		report.Environment.GitCommit, report.Environment.GitBranch,
+	)
+	if err != nil {
+		return fmt.Errorf("history: insert run: %w", err)
+	}
+
+	if report.Results != nil {
+		phases := []struct {
+			name   string
+			result TestRunResult
+		}{
+			{"before", report.Results.Before},
+			{"after", report.Results.After},
+		}
+
+		for _, phase := range phases {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO run_summary (run_id, phase, total, passed, failed, skipped, exit_code)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (run_id, phase) DO NOTHING`,
+				report.RunID, phase.name, phase.result.Summary.Total, phase.result.Summary.Passed,
+				phase.result.Summary.Failed, phase.result.Summary.Skipped, phase.result.ExitCode,
+			)
+			if err != nil {
+				return fmt.Errorf("history: insert run_summary(%s): %w", phase.name, err)
+			}
+
+			for _, test := range phase.result.Tests {
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO run_tests (run_id, phase, nodeid, name, outcome)
+					VALUES ($1, $2, $3, $4, $5)`,
+					report.RunID, phase.name, test.NodeID, test.Name, test.Outcome,
+				)
+				if err != nil {
+					return fmt.Errorf("history: insert run_tests(%s/%s): %w", phase.name, test.NodeID, err)
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// --- HTTP API ---
+
+// ServeHTTP exposes /runs, /runs/{id}, /tests/{nodeid}/history and /trends.
+func (h *HistoryStore) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == "/runs":
+		h.handleListRuns(rw, req)
+	case strings.HasPrefix(req.URL.Path, "/runs/"):
+		h.handleGetRun(rw, req, strings.TrimPrefix(req.URL.Path, "/runs/"))
+	case strings.HasPrefix(req.URL.Path, "/tests/") && strings.HasSuffix(req.URL.Path, "/history"):
+		nodeID := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/tests/"), "/history")
+		h.handleTestHistory(rw, req, nodeID)
+	case req.URL.Path == "/trends":
+		h.handleTrends(rw, req)
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
+
+// handleListRuns answers GET /runs?branch=&limit=
+func (h *HistoryStore) handleListRuns(rw http.ResponseWriter, req *http.Request) {
+	limit := 20
+	if raw := req.URL.Query().Get("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	query := `SELECT run_id, started_at, finished_at, duration_seconds, success, git_branch FROM runs`
+	args := []interface{}{}
+	if branch := req.URL.Query().Get("branch"); branch != "" {
+		query += ` WHERE git_branch = $1`
+		args = append(args, branch)
+	}
+	query += ` ORDER BY started_at DESC LIMIT ` + strconv.Itoa(limit)
+
+	rows, err := h.db.QueryContext(req.Context(), query, args...)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type runSummary struct {
+		RunID      string    `json:"run_id"`
+		StartedAt  time.Time `json:"started_at"`
+		FinishedAt time.Time `json:"finished_at"`
+		Duration   float64   `json:"duration_seconds"`
+		Success    bool      `json:"success"`
+		GitBranch  string    `json:"git_branch"`
+	}
+
+	var out []runSummary
+	for rows.Next() {
+		var r runSummary
+		if err := rows.Scan(&r.RunID, &r.StartedAt, &r.FinishedAt, &r.Duration, &r.Success, &r.GitBranch); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, r)
+	}
+
+	writeJSON(rw, out)
+}
+
+// handleGetRun answers GET /runs/{id}
+func (h *HistoryStore) handleGetRun(rw http.ResponseWriter, req *http.Request, runID string) {
+	row := h.db.QueryRowContext(req.Context(), `
+		SELECT run_id, started_at, finished_at, duration_seconds, success, go_version, os, arch, git_commit, git_branch
+		FROM runs WHERE run_id = $1`, runID)
+
+	var r Report
+	var startedAt, finishedAt time.Time
+	r.Results = &Results{}
+	if err := row.Scan(&r.RunID, &startedAt, &finishedAt, &r.DurationSeconds, &r.Success,
+		&r.Environment.GoVersion, &r.Environment.OS, &r.Environment.Architecture,
+		&r.Environment.GitCommit, &r.Environment.GitBranch); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(rw, req)
+			return
+		}
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.StartedAt = startedAt.Format(time.RFC3339)
+	r.FinishedAt = finishedAt.Format(time.RFC3339)
+
+	writeJSON(rw, r)
+}
+
+// handleTestHistory answers GET /tests/{nodeid}/history?limit=N, returning
+// the last N outcomes for a test so flakes (outcome flip rate) are visible.
+func (h *HistoryStore) handleTestHistory(rw http.ResponseWriter, req *http.Request, nodeID string) {
+	limit := 50
+	if raw := req.URL.Query().Get("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	rows, err := h.db.QueryContext(req.Context(), `
+		SELECT rt.run_id, rt.phase, rt.outcome, r.started_at
+		FROM run_tests rt
+		JOIN runs r ON r.run_id = rt.run_id
+		WHERE rt.nodeid = $1
+		ORDER BY r.started_at DESC
+		LIMIT $2`, nodeID, limit)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type outcome struct {
+		RunID     string    `json:"run_id"`
+		Phase     string    `json:"phase"`
+		Outcome   string    `json:"outcome"`
+		StartedAt time.Time `json:"started_at"`
+	}
+
+	var out []outcome
+	for rows.Next() {
+		var o outcome
+		if err := rows.Scan(&o.RunID, &o.Phase, &o.Outcome, &o.StartedAt); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, o)
+	}
+
+	writeJSON(rw, out)
+}
+
+// handleTrends answers GET /trends?branch=&window=30d with a daily pass
+// rate over the window.
+func (h *HistoryStore) handleTrends(rw http.ResponseWriter, req *http.Request) {
+	window := parseWindow(req.URL.Query().Get("window"), 30*24*time.Hour)
+	since := time.Now().Add(-window)
+
+	query := `
+		SELECT date_trunc('day', started_at) AS day,
+		       SUM(CASE WHEN success THEN 1 ELSE 0 END)::float / COUNT(*) AS pass_rate
+		FROM runs
+		WHERE started_at >= $1`
+	args := []interface{}{since}
+
+	if branch := req.URL.Query().Get("branch"); branch != "" {
+		query += ` AND git_branch = $2`
+		args = append(args, branch)
+	}
+	query += ` GROUP BY day ORDER BY day`
+
+	rows, err := h.db.QueryContext(req.Context(), query, args...)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type point struct {
+		Day      time.Time `json:"day"`
+		PassRate float64   `json:"pass_rate"`
+	}
+
+	var out []point
+	for rows.Next() {
+		var p point
+		if err := rows.Scan(&p.Day, &p.PassRate); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, p)
+	}
+
+	writeJSON(rw, out)
+}
+
+// parseWindow parses durations like "30d" (days aren't a valid
+// time.ParseDuration unit) alongside anything time.ParseDuration accepts.
+func parseWindow(raw string, fallback time.Duration) time.Duration {
+	if raw == "" {
+		return fallback
+	}
+	if strings.HasSuffix(raw, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(raw, "d")); err == nil {
+			return time.Duration(days) * 24 * time.Hour
+		}
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go-excel-extractor/evaluation/reporter/sheets"
+)
+
+const (
+	runsSheetName = "runs"
+	testsSheetName = "test_outcomes"
+)
+
+// runRow is the flattened shape of one Report as it appears in the "runs"
+// tab. Struct tags (rather than field names) become the header row.
+type runRow struct {
+	RunID        string  `sheet:"run_id"`
+	StartedAt    string  `sheet:"started_at"`
+	DurationSecs float64 `sheet:"duration_seconds"`
+	GoVersion    string  `sheet:"go_version"`
+	OS           string  `sheet:"os"`
+	Arch         string  `sheet:"arch"`
+	GitCommit    string  `sheet:"git_commit"`
+	GitBranch    string  `sheet:"git_branch"`
+	BeforePassed int     `sheet:"before_passed"`
+	BeforeFailed int     `sheet:"before_failed"`
+	AfterPassed  int     `sheet:"after_passed"`
+	AfterFailed  int     `sheet:"after_failed"`
+}
+
+// testOutcomeRow is one row of the "test_outcomes" tab: a single TestResult
+// from either the before or after run.
+type testOutcomeRow struct {
+	RunID   string `sheet:"run_id"`
+	Phase   string `sheet:"phase"`
+	NodeID  string `sheet:"nodeid"`
+	Name    string `sheet:"name"`
+	Outcome string `sheet:"outcome"`
+}
+
+// ReportPublisher appends Report rows to a Google Sheets spreadsheet. It is
+// safe to reuse across runs of the evaluator (e.g. in a long-lived CI job).
+type ReportPublisher struct {
+	client        sheets.Client
+	spreadsheetID string
+	dryRun        bool
+
+	runsReady bool
+	testsReady bool
+}
+
+// NewReportPublisher builds a publisher. When dryRun is true, rows are
+// printed to stdout instead of being sent to client.
+func NewReportPublisher(client sheets.Client, spreadsheetID string, dryRun bool) *ReportPublisher {
+	return &ReportPublisher{client: client, spreadsheetID: spreadsheetID, dryRun: dryRun}
+}
+
+// PublishReport appends one row for the run's aggregate pass/fail counts.
+func (p *ReportPublisher) PublishReport(ctx context.Context, report Report) error {
+	row := runRow{
+		RunID:        report.RunID,
+		StartedAt:    report.StartedAt,
+		DurationSecs: report.DurationSeconds,
+		GoVersion:    report.Environment.GoVersion,
+		OS:           report.Environment.OS,
+		Arch:         report.Environment.Architecture,
+		GitCommit:    report.Environment.GitCommit,
+		GitBranch:    report.Environment.GitBranch,
+	}
+	if report.Results != nil {
+		row.BeforePassed = report.Results.Comparison.BeforePassed
+		row.BeforeFailed = report.Results.Comparison.BeforeFailed
+		row.AfterPassed = report.Results.Comparison.AfterPassed
+		row.AfterFailed = report.Results.Comparison.AfterFailed
+	}
+
+	if p.dryRun {
+		fmt.Printf("[sheets dry-run] %s row: %+v\n", runsSheetName, row)
+		return nil
+	}
+
+	if !p.runsReady {
+		if err := p.client.EnsureSheet(ctx, p.spreadsheetID, runsSheetName); err != nil {
+			return fmt.Errorf("reporter: ensuring %s sheet: %w", runsSheetName, err)
+		}
+		p.runsReady = true
+	}
+
+	return p.client.AppendRow(ctx, p.spreadsheetID, runsSheetName, structToRow(row))
+}
+
+// PublishTestOutcomes appends one row per TestResult from both the before
+// and after runs, so failed test names become searchable in the sheet.
+func (p *ReportPublisher) PublishTestOutcomes(ctx context.Context, report Report) error {
+	if report.Results == nil {
+		return nil
+	}
+
+	if !p.dryRun && !p.testsReady {
+		if err := p.client.EnsureSheet(ctx, p.spreadsheetID, testsSheetName); err != nil {
+			return fmt.Errorf("reporter: ensuring %s sheet: %w", testsSheetName, err)
+		}
+		p.testsReady = true
+	}
+
+	phases := []struct {
+		name   string
+		result TestRunResult
+	}{
+		{"before", report.Results.Before},
+		{"after", report.Results.After},
+	}
+
+	for _, phase := range phases {
+		for _, test := range phase.result.Tests {
+			row := testOutcomeRow{
+				RunID:   report.RunID,
+				Phase:   phase.name,
+				NodeID:  test.NodeID,
+				Name:    test.Name,
+				Outcome: test.Outcome,
+			}
+
+			if p.dryRun {
+				fmt.Printf("[sheets dry-run] %s row: %+v\n", testsSheetName, row)
+				continue
+			}
+
+			if err := p.client.AppendRow(ctx, p.spreadsheetID, testsSheetName, structToRow(row)); err != nil {
+				return fmt.Errorf("reporter: appending test outcome row: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// structToRow flattens a tagged row struct into the []interface{} shape the
+// sheets.Client API expects, in declaration order.
+func structToRow(v interface{}) []interface{} {
+	switch r := v.(type) {
+	case runRow:
+		return []interface{}{
+			r.RunID, r.StartedAt, r.DurationSecs, r.GoVersion, r.OS, r.Arch,
+			r.GitCommit, r.GitBranch, r.BeforePassed, r.BeforeFailed, r.AfterPassed, r.AfterFailed,
+		}
+	case testOutcomeRow:
+		return []interface{}{r.RunID, r.Phase, r.NodeID, r.Name, r.Outcome}
+	default:
+		return nil
+	}
+}
+
+// publishReportToSheets sends report to the spreadsheet named by
+// SHEETS_SPREADSHEET_ID, or just prints the rows when -dry-run is set.
+func publishReportToSheets(report Report) error {
+	ctx := context.Background()
+
+	if *sheetsDryRun {
+		p := NewReportPublisher(nil, "", true)
+		if err := p.PublishReport(ctx, report); err != nil {
+			return err
+		}
+		return p.PublishTestOutcomes(ctx, report)
+	}
+
+	spreadsheetID := os.Getenv("SHEETS_SPREADSHEET_ID")
+	if spreadsheetID == "" {
+		return fmt.Errorf("reporter: SHEETS_SPREADSHEET_ID is not set")
+	}
+
+	client, err := newSheetsClientFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	p := NewReportPublisher(client, spreadsheetID, false)
+	if err := p.PublishReport(ctx, report); err != nil {
+		return err
+	}
+	return p.PublishTestOutcomes(ctx, report)
+}
+
+// newSheetsClientFromEnv builds a ServiceAccountClient from the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable, or returns an error
+// if it isn't set.
+func newSheetsClientFromEnv(ctx context.Context) (sheets.Client, error) {
+	credsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if credsPath == "" {
+		return nil, fmt.Errorf("reporter: GOOGLE_APPLICATION_CREDENTIALS is not set")
+	}
+	return sheets.NewServiceAccountClient(ctx, credsPath)
+}
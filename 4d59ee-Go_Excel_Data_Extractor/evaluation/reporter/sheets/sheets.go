@@ -0,0 +1,142 @@
+// Package sheets publishes evaluation reports to a Google Sheets spreadsheet,
+// mirroring the export step used by SwiftShader's regres test runner: one
+// row appended per run, with a header derived from struct tags on first use.
+package sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Client is the minimal surface this package needs from the Sheets API,
+// narrow enough that tests can inject a fake instead of talking to Google.
+type Client interface {
+	// EnsureSheet creates the named tab if it doesn't already exist.
+	EnsureSheet(ctx context.Context, spreadsheetID, sheetName string) error
+	// AppendRow appends a single row to the named tab.
+	AppendRow(ctx context.Context, spreadsheetID, sheetName string, row []interface{}) error
+}
+
+// ServiceAccountClient talks to the real Sheets API using a service-account
+// credentials file.
+type ServiceAccountClient struct {
+	svc *sheets.Service
+}
+
+// NewServiceAccountClient authenticates using the service account JSON at
+// credentialsPath.
+func NewServiceAccountClient(ctx context.Context, credentialsPath string) (*ServiceAccountClient, error) {
+	svc, err := sheets.NewService(ctx, option.WithCredentialsFile(credentialsPath))
+	if err != nil {
+		return nil, fmt.Errorf("sheets: creating client: %w", err)
+	}
+	return &ServiceAccountClient{svc: svc}, nil
+}
+
+func (c *ServiceAccountClient) EnsureSheet(ctx context.Context, spreadsheetID, sheetName string) error {
+	ss, err := c.svc.Spreadsheets.Get(spreadsheetID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("sheets: fetching spreadsheet: %w", err)
+	}
+
+	for _, sh := range ss.Sheets {
+		if sh.Properties != nil && sh.Properties.Title == sheetName {
+			return nil
+		}
+	}
+
+	req := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{
+				AddSheet: &sheets.AddSheetRequest{
+					Properties: &sheets.SheetProperties{Title: sheetName},
+				},
+			},
+		},
+	}
+
+	return withBackoff(ctx, func() error {
+		_, err := c.svc.Spreadsheets.BatchUpdate(spreadsheetID, req).Context(ctx).Do()
+		return err
+	})
+}
+
+func (c *ServiceAccountClient) AppendRow(ctx context.Context, spreadsheetID, sheetName string, row []interface{}) error {
+	vr := &sheets.ValueRange{Values: [][]interface{}{row}}
+
+	return withBackoff(ctx, func() error {
+		_, err := c.svc.Spreadsheets.Values.
+			Append(spreadsheetID, sheetName+"!A1", vr).
+			ValueInputOption("RAW").
+			InsertDataOption("INSERT_ROWS").
+			Context(ctx).
+			Do()
+		return err
+	})
+}
+
+// withBackoff retries fn on 5xx and 429 responses with exponential backoff,
+// capped at a handful of attempts.
+func withBackoff(ctx context.Context, fn func() error) error {
+	const maxAttempts = 5
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		lastErr = fn()
+		if lastErr == nil {
+			return nil
+		}
+		if !isRetryable(lastErr) {
+			return lastErr
+		}
+
+		backoff := time.Duration(math.Pow(2, float64(attempt))) * 200 * time.Millisecond
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+
+	return fmt.Errorf("sheets: giving up after %d attempts: %w", maxAttempts, lastErr)
+}
+
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+	return false
+}
+
+// row describes one of the tabs this package writes, with its header and a
+// function that renders a value into a spreadsheet row.
+type row struct {
+	sheetName string
+	header    []string
+	values    []interface{}
+}
+
+// headerFromTags derives a header row from the `sheet:"..."` struct tags of
+// v, falling back to the field name when no tag is present.
+func headerFromTags(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	header := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("sheet"); tag != "" {
+			header = append(header, tag)
+		} else {
+			header = append(header, f.Name)
+		}
+	}
+	return header
+}
@@ -0,0 +1,122 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// fakeClient is a minimal in-memory Client used to exercise callers without
+// talking to Google.
+type fakeClient struct {
+	sheets map[string]bool
+	rows   map[string][][]interface{}
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		sheets: make(map[string]bool),
+		rows:   make(map[string][][]interface{}),
+	}
+}
+
+func (f *fakeClient) EnsureSheet(ctx context.Context, spreadsheetID, sheetName string) error {
+	f.sheets[sheetName] = true
+	return nil
+}
+
+func (f *fakeClient) AppendRow(ctx context.Context, spreadsheetID, sheetName string, row []interface{}) error {
+	f.rows[sheetName] = append(f.rows[sheetName], row)
+	return nil
+}
+
+func TestFakeClient_EnsureSheetAndAppendRow(t *testing.T) {
+	var c Client = newFakeClient()
+	ctx := context.Background()
+
+	if err := c.EnsureSheet(ctx, "ss-id", "Runs"); err != nil {
+		t.Fatalf("EnsureSheet: %v", err)
+	}
+	if err := c.AppendRow(ctx, "ss-id", "Runs", []interface{}{"run-1", 42}); err != nil {
+		t.Fatalf("AppendRow: %v", err)
+	}
+
+	fc := c.(*fakeClient)
+	if !fc.sheets["Runs"] {
+		t.Fatalf("expected sheet %q to have been ensured", "Runs")
+	}
+	if len(fc.rows["Runs"]) != 1 {
+		t.Fatalf("expected 1 row appended, got %d", len(fc.rows["Runs"]))
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("boom"), false},
+		{"googleapi 429", &googleapi.Error{Code: 429}, true},
+		{"googleapi 500", &googleapi.Error{Code: 500}, true},
+		{"googleapi 503", &googleapi.Error{Code: 503}, true},
+		{"googleapi 400", &googleapi.Error{Code: 400}, false},
+		{"wrapped googleapi 500", fmtErrorf(&googleapi.Error{Code: 500}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBackoff_RetriesRetryableErrorsThenSucceeds(t *testing.T) {
+	attempts := 0
+	err := withBackoff(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return &googleapi.Error{Code: 503}
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("expected eventual success, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWithBackoff_GivesUpOnNonRetryableError(t *testing.T) {
+	attempts := 0
+	wantErr := &googleapi.Error{Code: 400}
+	err := withBackoff(context.Background(), func() error {
+		attempts++
+		return wantErr
+	})
+
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected non-retryable error to be returned unwrapped, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected a single attempt for a non-retryable error, got %d", attempts)
+	}
+}
+
+// fmtErrorf wraps err the way real callers do (e.g. withBackoff's own
+// "giving up" path), to confirm isRetryable still finds it via errors.As.
+func fmtErrorf(err error) error {
+	return &wrappedError{err: err}
+}
+
+type wrappedError struct{ err error }
+
+func (w *wrappedError) Error() string { return "wrapped: " + w.err.Error() }
+func (w *wrappedError) Unwrap() error { return w.err }
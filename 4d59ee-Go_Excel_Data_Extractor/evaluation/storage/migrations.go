@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrate applies every embedded migration in filename order. Each
+// migration is expected to be idempotent (CREATE TABLE/INDEX IF NOT
+// EXISTS) so Migrate is safe to call on every process start.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return fmt.Errorf("storage: reading migrations: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sqlBytes, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return fmt.Errorf("storage: reading migration %s: %w", name, err)
+		}
+		if _, err := db.ExecContext(ctx, string(sqlBytes)); err != nil {
+			return fmt.Errorf("storage: applying migration %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
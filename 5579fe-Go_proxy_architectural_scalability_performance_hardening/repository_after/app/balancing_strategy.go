@@ -0,0 +1,312 @@
+package app
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalancingStrategy picks a backend for req out of servers. Implementations
+// must be safe for concurrent use, since Pick is called from every request
+// goroutine.
+type BalancingStrategy interface {
+	Pick(servers []ServerInterface, req *http.Request) ServerInterface
+}
+
+// ConnectionAware is implemented by strategies that track in-flight
+// requests per backend; HandleProxyServing calls RequestStarted before and
+// RequestFinished after serving a request when the active strategy
+// implements it.
+type ConnectionAware interface {
+	RequestStarted(address string)
+	RequestFinished(address string)
+}
+
+// LatencyAware is implemented by strategies that track response latency
+// per backend; HandleProxyServing reports it after each request when the
+// active strategy implements it.
+type LatencyAware interface {
+	RecordLatency(address string, d time.Duration)
+}
+
+// NewBalancingStrategy builds a BalancingStrategy from a config string,
+// falling back to RoundRobin for an empty or unrecognized name.
+func NewBalancingStrategy(name string) BalancingStrategy {
+	switch name {
+	case "least-connections":
+		return NewLeastConnectionsStrategy()
+	case "ewma":
+		return NewEWMAStrategy()
+	case "p2c", "power-of-two-choices":
+		return NewPowerOfTwoChoicesStrategy()
+	case "consistent-hash", "chash":
+		return NewConsistentHashStrategy()
+	default:
+		return NewRoundRobinStrategy()
+	}
+}
+
+// connectionTracker counts in-flight requests per backend address, shared
+// by strategies that need it (LeastConnections, PowerOfTwoChoices).
+type connectionTracker struct {
+	mu     sync.Mutex
+	counts map[string]*atomic.Int64
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{counts: make(map[string]*atomic.Int64)}
+}
+
+func (t *connectionTracker) counter(address string) *atomic.Int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counts[address]
+	if !ok {
+		c = &atomic.Int64{}
+		t.counts[address] = c
+	}
+	return c
+}
+
+func (t *connectionTracker) Start(address string)       { t.counter(address).Add(1) }
+func (t *connectionTracker) Finish(address string)      { t.counter(address).Add(-1) }
+func (t *connectionTracker) Count(address string) int64 { return t.counter(address).Load() }
+
+// --- Round Robin ---
+
+// RoundRobin reproduces LoadBalancerStruct.FindNextAvailableServerForRequest's
+// original behavior as a standalone strategy: separate HTTP/WebSocket
+// cursors, skipping dead servers, falling back to servers[0] if none are
+// alive.
+type RoundRobin struct {
+	mu              sync.Mutex
+	httpCursor      int
+	webSocketCursor int
+}
+
+func NewRoundRobinStrategy() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (rr *RoundRobin) Pick(servers []ServerInterface, req *http.Request) ServerInterface {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	serverCount := len(servers)
+	if serverCount == 0 {
+		return nil
+	}
+
+	isWebSocket := isWebSocketUpgradeRequest(req)
+	magic1, magic2 := GetConfigManager().GetMagicNumbers()
+
+	startOffset := rr.httpCursor
+	if isWebSocket {
+		startOffset = rr.webSocketCursor
+	}
+
+	for i := 0; i < serverCount; i++ {
+		idx := (startOffset + i) % serverCount
+		candidate := servers[idx]
+		if candidate.CheckIfServerIsCurrentlyAlive() {
+			if isWebSocket {
+				rr.webSocketCursor = (idx + magic1) % serverCount
+			} else {
+				rr.httpCursor = (idx + 1) % serverCount
+			}
+			return candidate
+		}
+	}
+
+	if !isWebSocket {
+		rr.httpCursor = magic2
+	}
+	return servers[0]
+}
+
+// --- Least Connections ---
+
+// LeastConnections picks the alive server with the fewest in-flight
+// requests, tracked via connectionTracker.
+type LeastConnections struct {
+	tracker *connectionTracker
+}
+
+func NewLeastConnectionsStrategy() *LeastConnections {
+	return &LeastConnections{tracker: newConnectionTracker()}
+}
+
+func (lc *LeastConnections) Pick(servers []ServerInterface, req *http.Request) ServerInterface {
+	var best ServerInterface
+	var bestCount int64
+
+	for _, s := range servers {
+		if !s.CheckIfServerIsCurrentlyAlive() {
+			continue
+		}
+		count := lc.tracker.Count(s.GetAddress())
+		if best == nil || count < bestCount {
+			best, bestCount = s, count
+		}
+	}
+
+	if best == nil && len(servers) > 0 {
+		return servers[0]
+	}
+	return best
+}
+
+func (lc *LeastConnections) RequestStarted(address string)  { lc.tracker.Start(address) }
+func (lc *LeastConnections) RequestFinished(address string) { lc.tracker.Finish(address) }
+
+// --- EWMA ---
+
+const defaultEWMAAlpha = 0.3
+
+// ewmaTracker holds exponentially-weighted moving average latency per
+// backend address, shared by strategies that need it (EWMA,
+// PowerOfTwoChoices). A zero value (no sample yet) is treated as the
+// fastest possible latency, so an untested server gets a chance to report
+// one instead of being starved by servers with an established low EWMA.
+type ewmaTracker struct {
+	mu      sync.Mutex
+	latency map[string]time.Duration
+	alpha   float64
+}
+
+func newEWMATracker(alpha float64) *ewmaTracker {
+	if alpha <= 0 {
+		alpha = defaultEWMAAlpha
+	}
+	return &ewmaTracker{latency: make(map[string]time.Duration), alpha: alpha}
+}
+
+func (t *ewmaTracker) Record(address string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, seen := t.latency[address]
+	if !seen {
+		t.latency[address] = d
+		return
+	}
+	t.latency[address] = time.Duration(t.alpha*float64(d) + (1-t.alpha)*float64(prev))
+}
+
+func (t *ewmaTracker) Get(address string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latency[address]
+}
+
+// EWMA picks the alive server with the lowest exponentially-weighted
+// moving average response latency. Servers with no recorded latency yet
+// are treated as the fastest, so they get a chance to report one.
+type EWMA struct {
+	tracker *ewmaTracker
+}
+
+func NewEWMAStrategy() *EWMA {
+	return NewEWMAStrategyWithAlpha(defaultEWMAAlpha)
+}
+
+// NewEWMAStrategyWithAlpha is NewEWMAStrategy with an explicit decay
+// factor: closer to 1 weighs the latest sample more heavily, closer to 0
+// smooths out over more history. alpha <= 0 falls back to the default.
+func NewEWMAStrategyWithAlpha(alpha float64) *EWMA {
+	return &EWMA{tracker: newEWMATracker(alpha)}
+}
+
+func (e *EWMA) Pick(servers []ServerInterface, req *http.Request) ServerInterface {
+	var best ServerInterface
+	var bestLatency time.Duration
+
+	for _, s := range servers {
+		if !s.CheckIfServerIsCurrentlyAlive() {
+			continue
+		}
+		latency := e.tracker.Get(s.GetAddress())
+		if best == nil || latency < bestLatency {
+			best, bestLatency = s, latency
+		}
+	}
+
+	if best == nil && len(servers) > 0 {
+		return servers[0]
+	}
+	return best
+}
+
+func (e *EWMA) RecordLatency(address string, d time.Duration) {
+	e.tracker.Record(address, d)
+}
+
+// --- Power of Two Choices ---
+
+// PowerOfTwoChoices samples two distinct alive servers at random and picks
+// whichever has the lower score, where score is EWMA latency weighted by
+// in-flight load (latency * (in-flight + 1)) - near-optimal balancing with
+// O(1) selection, without the coordination cost of scanning every backend.
+// A server with no recorded latency yet scores 0 for its latency factor,
+// so it gets picked over an already-measured peer and reports one.
+type PowerOfTwoChoices struct {
+	tracker *connectionTracker
+	latency *ewmaTracker
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewPowerOfTwoChoicesStrategy() *PowerOfTwoChoices {
+	return &PowerOfTwoChoices{
+		tracker: newConnectionTracker(),
+		latency: newEWMATracker(defaultEWMAAlpha),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (p *PowerOfTwoChoices) score(address string) float64 {
+	inFlight := p.tracker.Count(address)
+	return float64(p.latency.Get(address)) * float64(inFlight+1)
+}
+
+func (p *PowerOfTwoChoices) Pick(servers []ServerInterface, req *http.Request) ServerInterface {
+	alive := make([]ServerInterface, 0, len(servers))
+	for _, s := range servers {
+		if s.CheckIfServerIsCurrentlyAlive() {
+			alive = append(alive, s)
+		}
+	}
+
+	switch len(alive) {
+	case 0:
+		if len(servers) > 0 {
+			return servers[0]
+		}
+		return nil
+	case 1:
+		return alive[0]
+	}
+
+	p.mu.Lock()
+	i := p.rng.Intn(len(alive))
+	j := p.rng.Intn(len(alive) - 1)
+	p.mu.Unlock()
+	if j >= i {
+		j++
+	}
+
+	a, b := alive[i], alive[j]
+	if p.score(a.GetAddress()) <= p.score(b.GetAddress()) {
+		return a
+	}
+	return b
+}
+
+func (p *PowerOfTwoChoices) RequestStarted(address string)  { p.tracker.Start(address) }
+func (p *PowerOfTwoChoices) RequestFinished(address string) { p.tracker.Finish(address) }
+func (p *PowerOfTwoChoices) RecordLatency(address string, d time.Duration) {
+	p.latency.Record(address, d)
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadBalancerConfig is the shape of a hot-reloadable config file: the
+// upstream pool, the balancing strategy, and the health-check interval.
+type LoadBalancerConfig struct {
+	Upstreams           []ServerConfig `json:"upstreams" yaml:"upstreams"`
+	Strategy            string         `json:"strategy" yaml:"strategy"`
+	HealthCheckInterval time.Duration  `json:"healthCheckInterval" yaml:"healthCheckInterval"`
+}
+
+// LoadLoadBalancerConfig reads and parses path as YAML (.yaml/.yml
+// extension) or JSON (anything else), rejecting a config that names no
+// upstreams so a malformed or half-written file can never silently empty
+// the pool.
+func LoadLoadBalancerConfig(path string) (LoadBalancerConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return LoadBalancerConfig{}, fmt.Errorf("lb config: reading %s: %w", path, err)
+	}
+
+	var config LoadBalancerConfig
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(raw, &config)
+	} else {
+		err = json.Unmarshal(raw, &config)
+	}
+	if err != nil {
+		return LoadBalancerConfig{}, fmt.Errorf("lb config: parsing %s: %w", path, err)
+	}
+
+	if len(config.Upstreams) == 0 {
+		return LoadBalancerConfig{}, fmt.Errorf("lb config: %s names no upstreams", path)
+	}
+	return config, nil
+}
+
+// configWatcher is the fsnotify-backed goroutine WatchConfigFile starts;
+// Shutdown stops it via stop.
+type configWatcher struct {
+	watcher *fsnotify.Watcher
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (cw *configWatcher) stop() {
+	cw.cancel()
+	cw.watcher.Close()
+	cw.wg.Wait()
+}
+
+// WatchConfigFile loads path once immediately -- applying its upstreams and
+// strategy to lb -- then watches it for writes via fsnotify, re-validating
+// and re-applying the new config on every change. A write that fails to
+// parse or names no upstreams is logged and ignored, leaving the previous
+// config (and thus traffic) undisturbed. Shutdown stops the watch.
+func (lb *LoadBalancerStruct) WatchConfigFile(path string) error {
+	config, err := LoadLoadBalancerConfig(path)
+	if err != nil {
+		return err
+	}
+	lb.applyConfig(config)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("lb config: starting watcher: %w", err)
+	}
+	// Watch the containing directory, not the file itself: many editors
+	// and config-management tools replace a file rather than write it in
+	// place, which drops a direct watch on the old inode without firing an
+	// event fsnotify can see.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("lb config: watching %s: %w", path, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cw := &configWatcher{watcher: watcher, cancel: cancel}
+
+	cw.wg.Add(1)
+	go func() {
+		defer cw.wg.Done()
+		lb.runConfigWatch(ctx, watcher, path)
+	}()
+
+	lb.stateMutex.Lock()
+	lb.configWatcher = cw
+	lb.stateMutex.Unlock()
+	return nil
+}
+
+func (lb *LoadBalancerStruct) runConfigWatch(ctx context.Context, watcher *fsnotify.Watcher, path string) {
+	cleanPath := filepath.Clean(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != cleanPath {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			config, err := LoadLoadBalancerConfig(path)
+			if err != nil {
+				log.Printf("[Config] reload of %s failed, keeping previous config: %v", path, err)
+				continue
+			}
+			lb.applyConfig(config)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[Config] watcher error for %s: %v", path, err)
+		}
+	}
+}
+
+// applyConfig reloads the upstream pool and, if set, swaps the active
+// strategy to match config -- the validated-then-swapped path both the
+// initial WatchConfigFile load and every subsequent file change go through.
+func (lb *LoadBalancerStruct) applyConfig(config LoadBalancerConfig) {
+	lb.ReloadUpstreams(config.Upstreams)
+
+	if config.Strategy != "" {
+		lb.stateMutex.Lock()
+		lb.strategy = NewBalancingStrategy(config.Strategy)
+		lb.stateMutex.Unlock()
+		lb.rewireConsistentHashUnhealthy()
+	}
+
+	if config.HealthCheckInterval > 0 {
+		lb.StartHealthChecks(context.Background(), config.HealthCheckInterval)
+	}
+}
@@ -0,0 +1,238 @@
+package app
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ring tuning: enough virtual nodes per server to keep the hash ring evenly
+// distributed, and a bounded-load epsilon (Google's "Consistent Hashing with
+// Bounded Loads") so one hot document ID can't pin unbounded traffic onto a
+// single backend. defaultBoundedLoadEpsilon is NewConsistentHashRing's
+// default; NewConsistentHashRingWithEpsilon overrides it.
+const (
+	vnodesPerServer           = 160
+	defaultBoundedLoadEpsilon = 0.25
+)
+
+type ringVNode struct {
+	hash      uint64
+	serverIdx int
+}
+
+// ConsistentHashRing maps arbitrary keys (document IDs) onto a fixed server
+// list via virtual nodes on a hash ring, so adding or removing a backend
+// only reshuffles roughly 1/N of keys instead of the whole keyspace.
+type ConsistentHashRing struct {
+	boundedLoadEpsilon float64
+
+	mu      sync.RWMutex
+	servers []ServerInterface
+	vnodes  []ringVNode
+}
+
+// NewConsistentHashRing builds a ring over servers using the default
+// bounded-load epsilon.
+func NewConsistentHashRing(servers []ServerInterface) *ConsistentHashRing {
+	return NewConsistentHashRingWithEpsilon(servers, defaultBoundedLoadEpsilon)
+}
+
+// NewConsistentHashRingWithEpsilon is NewConsistentHashRing with an explicit
+// bounded-load epsilon: Lookup rejects a candidate once its load exceeds
+// (1+epsilon) times the ring's average load. epsilon <= 0 falls back to the
+// default.
+func NewConsistentHashRingWithEpsilon(servers []ServerInterface, epsilon float64) *ConsistentHashRing {
+	if epsilon <= 0 {
+		epsilon = defaultBoundedLoadEpsilon
+	}
+	ring := &ConsistentHashRing{boundedLoadEpsilon: epsilon}
+	ring.Rebuild(servers)
+	return ring
+}
+
+// Rebuild replaces the ring's server set and regenerates its virtual nodes
+// atomically. Safe to call concurrently with Lookup.
+func (r *ConsistentHashRing) Rebuild(servers []ServerInterface) {
+	vnodes := make([]ringVNode, 0, len(servers)*vnodesPerServer)
+	for idx, s := range servers {
+		for v := 0; v < vnodesPerServer; v++ {
+			vnodes = append(vnodes, ringVNode{
+				hash:      hashKey(s.GetAddress() + "#" + strconv.Itoa(v)),
+				serverIdx: idx,
+			})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool { return vnodes[i].hash < vnodes[j].hash })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.servers = servers
+	r.vnodes = vnodes
+}
+
+// Lookup walks the ring clockwise from h(key), skipping dead or unhealthy
+// servers and, when load is non-nil, any server already carrying more than
+// (1+epsilon) times the average in-flight load across the ring (Google's
+// bounded-load rule). unhealthy may be nil; when set (wired to a
+// LoadBalancerStruct's circuit breaker / outlier detector state), it is
+// consulted alongside CheckIfServerIsCurrentlyAlive so a server an outlier
+// detector just ejected is skipped on the very next lookup without having
+// to rebuild the ring. If every candidate is dead, unhealthy, or overloaded
+// it falls back to the first alive server regardless of load, same as
+// LoadBalancerStruct.FindNextAvailableServerForRequest's degrade-rather-
+// than-fail behavior.
+func (r *ConsistentHashRing) Lookup(key string, load func(address string) int64, unhealthy func(address string) bool) ServerInterface {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.vnodes) == 0 {
+		return nil
+	}
+
+	target := hashKey(key)
+	start := sort.Search(len(r.vnodes), func(i int) bool { return r.vnodes[i].hash >= target })
+	avg := r.averageLoadLocked(load)
+
+	for i := 0; i < len(r.vnodes); i++ {
+		vnode := r.vnodes[(start+i)%len(r.vnodes)]
+		server := r.servers[vnode.serverIdx]
+		if !server.CheckIfServerIsCurrentlyAlive() {
+			continue
+		}
+		if unhealthy != nil && unhealthy(server.GetAddress()) {
+			continue
+		}
+		if load != nil && float64(load(server.GetAddress())) > avg*(1+r.boundedLoadEpsilon) {
+			continue
+		}
+		return server
+	}
+
+	for i := 0; i < len(r.vnodes); i++ {
+		vnode := r.vnodes[(start+i)%len(r.vnodes)]
+		server := r.servers[vnode.serverIdx]
+		if server.CheckIfServerIsCurrentlyAlive() {
+			return server
+		}
+	}
+	if len(r.servers) > 0 {
+		return r.servers[0]
+	}
+	return nil
+}
+
+func (r *ConsistentHashRing) averageLoadLocked(load func(address string) int64) float64 {
+	if load == nil || len(r.servers) == 0 {
+		return 0
+	}
+	var total int64
+	for _, s := range r.servers {
+		total += load(s.GetAddress())
+	}
+	return float64(total) / float64(len(r.servers))
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// ConsistentHashOptions configures a ConsistentHashStrategy at construction
+// time.
+type ConsistentHashOptions struct {
+	// Epsilon is the bounded-load epsilon passed to
+	// NewConsistentHashRingWithEpsilon. Zero uses the ring's own default.
+	Epsilon float64
+	// KeyHeader, if set, is hashed instead of the document_id query
+	// parameter -- e.g. for callers that route by tenant ID or a custom
+	// session header rather than a document.
+	KeyHeader string
+	// Unhealthy, if set, is consulted for every candidate alongside
+	// CheckIfServerIsCurrentlyAlive. Wire it to a LoadBalancerStruct's
+	// circuitOpenFor/outlierEjectedFor (e.g. via EnableOutlierDetection) so
+	// a server an outlier detector just ejected is skipped immediately
+	// rather than only once the next Rebuild happens to run.
+	Unhealthy func(address string) bool
+}
+
+// ConsistentHashStrategy is a BalancingStrategy backed by a
+// ConsistentHashRing: requests carrying a document_id query parameter (or
+// KeyHeader, if configured) are routed deterministically to the same
+// backend (server churn aside), falling back to the client address as the
+// ring key for plain requests. It rebuilds its ring whenever the server
+// list it's called with changes.
+type ConsistentHashStrategy struct {
+	tracker *connectionTracker
+	options ConsistentHashOptions
+
+	mu      sync.Mutex
+	servers []ServerInterface
+	ring    *ConsistentHashRing
+}
+
+func NewConsistentHashStrategy() *ConsistentHashStrategy {
+	return NewConsistentHashStrategyWithOptions(ConsistentHashOptions{})
+}
+
+// NewConsistentHashStrategyWithOptions is NewConsistentHashStrategy with its
+// bounded-load epsilon, routing key header, and external health hook
+// selected at construction time.
+func NewConsistentHashStrategyWithOptions(options ConsistentHashOptions) *ConsistentHashStrategy {
+	return &ConsistentHashStrategy{tracker: newConnectionTracker(), options: options}
+}
+
+func (c *ConsistentHashStrategy) Pick(servers []ServerInterface, req *http.Request) ServerInterface {
+	c.mu.Lock()
+	if !sameServerSet(c.servers, servers) {
+		c.servers = servers
+		c.ring = NewConsistentHashRingWithEpsilon(servers, c.options.Epsilon)
+	}
+	ring := c.ring
+	c.mu.Unlock()
+
+	if ring == nil {
+		return nil
+	}
+
+	var key string
+	if c.options.KeyHeader != "" {
+		key = strings.TrimSpace(req.Header.Get(c.options.KeyHeader))
+	}
+	if key == "" {
+		key = strings.TrimSpace(req.URL.Query().Get("document_id"))
+	}
+	if key == "" {
+		key = req.RemoteAddr
+	}
+	return ring.Lookup(key, c.tracker.Count, c.options.Unhealthy)
+}
+
+func (c *ConsistentHashStrategy) RequestStarted(address string)  { c.tracker.Start(address) }
+func (c *ConsistentHashStrategy) RequestFinished(address string) { c.tracker.Finish(address) }
+
+// SetUnhealthy wires (or replaces) the Unhealthy hook after construction.
+// EnableCircuitBreakers and EnableOutlierDetection call this automatically
+// when the load balancer's active strategy is a ConsistentHashStrategy, so
+// enabling either later still takes effect without rebuilding the strategy.
+func (c *ConsistentHashStrategy) SetUnhealthy(fn func(address string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options.Unhealthy = fn
+}
+
+func sameServerSet(a, b []ServerInterface) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Backoff bounds applied to a backend's probe cadence after consecutive
+// health-check failures, so a dead backend isn't hammered every interval.
+const (
+	minHealthCheckBackoff = 1 * time.Second
+	maxHealthCheckBackoff = 30 * time.Second
+)
+
+// healthUpdatable is implemented by server types whose liveness can be set
+// by a background HealthChecker instead of being computed synchronously on
+// every CheckIfServerIsCurrentlyAlive call. A ServerInterface that doesn't
+// implement it (a hand-rolled test double, say) is simply left out of
+// background probing and keeps deciding its own liveness.
+type healthUpdatable interface {
+	updateLiveness(alive bool)
+}
+
+type healthCheckTarget struct {
+	address string
+	target  healthUpdatable
+}
+
+// healthCheckState tracks per-backend consecutive failures so probing can
+// back off exponentially instead of polling a dead backend every interval.
+type healthCheckState struct {
+	consecutiveFailures int
+	nextProbeAt         time.Time
+}
+
+// HealthChecker periodically probes GET <address>/health for a fixed set
+// of backends and stores the result as an atomic liveness flag on each, so
+// the request-serving hot path never blocks on a network call.
+type HealthChecker struct {
+	targets  []healthCheckTarget
+	interval time.Duration
+	client   *http.Client
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	states map[string]*healthCheckState
+}
+
+func newHealthChecker(servers []ServerInterface, interval time.Duration) *HealthChecker {
+	targets := make([]healthCheckTarget, 0, len(servers))
+	states := make(map[string]*healthCheckState)
+
+	for _, s := range servers {
+		updatable, ok := s.(healthUpdatable)
+		if !ok {
+			continue
+		}
+		address := s.GetAddress()
+		targets = append(targets, healthCheckTarget{address: address, target: updatable})
+		states[address] = &healthCheckState{}
+	}
+
+	return &HealthChecker{
+		targets:  targets,
+		interval: interval,
+		client:   &http.Client{Timeout: 2 * time.Second},
+		states:   states,
+	}
+}
+
+// start probes every target once immediately, then launches the polling
+// loop on its own goroutine until ctx is canceled or stop is called.
+func (hc *HealthChecker) start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	hc.cancel = cancel
+
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+		hc.probeAll()
+
+		ticker := time.NewTicker(hc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hc.probeAll()
+			}
+		}
+	}()
+}
+
+// stop cancels the polling loop and waits for its goroutine to exit.
+func (hc *HealthChecker) stop() {
+	if hc.cancel != nil {
+		hc.cancel()
+	}
+	hc.wg.Wait()
+}
+
+func (hc *HealthChecker) probeAll() {
+	now := time.Now()
+	for _, t := range hc.targets {
+		hc.mu.Lock()
+		state := hc.states[t.address]
+		due := state.nextProbeAt.IsZero() || !now.Before(state.nextProbeAt)
+		hc.mu.Unlock()
+
+		if due {
+			hc.probeOne(t, now)
+		}
+	}
+}
+
+func (hc *HealthChecker) probeOne(t healthCheckTarget, now time.Time) {
+	alive := hc.probe(t.address)
+	t.target.updateLiveness(alive)
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	state := hc.states[t.address]
+	if alive {
+		state.consecutiveFailures = 0
+		state.nextProbeAt = time.Time{}
+		return
+	}
+	state.consecutiveFailures++
+	state.nextProbeAt = now.Add(backoffFor(state.consecutiveFailures))
+}
+
+func (hc *HealthChecker) probe(address string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/health", nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+// backoffFor returns the delay before the next probe after n consecutive
+// failures, doubling from minHealthCheckBackoff up to maxHealthCheckBackoff.
+func backoffFor(n int) time.Duration {
+	backoff := minHealthCheckBackoff
+	for i := 1; i < n && backoff < maxHealthCheckBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxHealthCheckBackoff {
+		backoff = maxHealthCheckBackoff
+	}
+	return backoff
+}
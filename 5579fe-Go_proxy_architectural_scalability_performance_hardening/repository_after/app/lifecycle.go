@@ -0,0 +1,83 @@
+package app
+
+import "context"
+
+// ServerConfig describes one upstream for ReloadUpstreams and the
+// file-based config source -- just enough to rebuild a ServerWrapper,
+// without requiring callers to hand-construct ServerInterface values
+// themselves.
+type ServerConfig struct {
+	Address string `json:"address" yaml:"address"`
+}
+
+// Start marks the load balancer as accepting traffic. A LoadBalancerStruct
+// accepts requests by default from construction (so existing callers that
+// never call Start keep today's behavior); Start only matters to undo a
+// previous Shutdown.
+func (lb *LoadBalancerStruct) Start(ctx context.Context) {
+	lb.shuttingDown.Store(false)
+}
+
+// Shutdown stops HandleProxyServing from admitting new requests and stops
+// the config watcher started by WatchConfigFile, if any, then waits for
+// every request already admitted to finish, up to ctx's deadline. It
+// returns ctx.Err() if the deadline elapses first, leaving whatever
+// requests are still in flight to finish on their own.
+func (lb *LoadBalancerStruct) Shutdown(ctx context.Context) error {
+	lb.shuttingDown.Store(true)
+
+	lb.stateMutex.Lock()
+	watcher := lb.configWatcher
+	lb.configWatcher = nil
+	lb.stateMutex.Unlock()
+	if watcher != nil {
+		watcher.stop()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		lb.inFlightRequests.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReloadUpstreams diffs desired against the current server pool and applies
+// the difference atomically under internalMutex -- the same lock
+// FindNextAvailableServerForRequest holds while reading serversList and the
+// round-robin counters, so a reload is never observed half-applied. An
+// address in desired that isn't already in the pool is added as a fresh
+// ServerWrapper; an address in the pool that desired no longer names is
+// dropped. An address present in both keeps its existing ServerInterface,
+// so its liveness state, in-flight counts, and circuit-breaker/outlier-
+// detector history survive the reload instead of resetting to zero. Any
+// WebSocket connection already proxying to a removed backend keeps running
+// to completion -- removal only stops it being chosen for new requests.
+func (lb *LoadBalancerStruct) ReloadUpstreams(desired []ServerConfig) {
+	lb.internalMutex.Lock()
+	defer lb.internalMutex.Unlock()
+
+	existing := make(map[string]ServerInterface, len(lb.serversList))
+	for _, s := range lb.serversList {
+		existing[s.GetAddress()] = s
+	}
+
+	next := make([]ServerInterface, 0, len(desired))
+	for i, cfg := range desired {
+		if s, ok := existing[cfg.Address]; ok {
+			next = append(next, s)
+			continue
+		}
+		next = append(next, CreateNewSimpleServerInstance(cfg.Address, i))
+	}
+
+	lb.serversList = next
+	lb.roundRobinCounterForHttpRequests = 0
+	lb.roundRobinCounterForWebSocketRequests = 0
+}
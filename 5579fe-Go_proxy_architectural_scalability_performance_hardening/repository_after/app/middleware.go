@@ -0,0 +1,399 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps an http.Handler to add cross-cutting behavior (logging,
+// metrics, compression, ...) around the terminal handler that does the
+// actual proxying. Middlewares compose outside-in: the first one passed to
+// Use is the outermost handler, so it sees the request first and the
+// response last.
+type Middleware func(http.Handler) http.Handler
+
+// Use appends mw to the chain HandleProxyServing wraps around its terminal
+// proxying handler, in the order given.
+func (lb *LoadBalancerStruct) Use(mw ...Middleware) {
+	lb.stateMutex.Lock()
+	defer lb.stateMutex.Unlock()
+	lb.middlewares = append(lb.middlewares, mw...)
+}
+
+// composeMiddleware wraps terminal with every entry in chain, outermost
+// first, so chain[0] runs before chain[1] on the way in and after it on the
+// way out.
+func composeMiddleware(chain []Middleware, terminal http.Handler) http.Handler {
+	handler := terminal
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// --- Request logging ---
+
+// statusCapturingWriter records the status code written through it, since
+// http.ResponseWriter doesn't expose what a downstream handler sent.
+type statusCapturingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusCapturingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusCapturingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.statusCode = http.StatusOK
+		w.wroteHeader = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack lets a status-capturing writer still satisfy http.Hijacker, since
+// the chain also carries WebSocket upgrade requests through
+// HandleProxyServing.
+func (w *statusCapturingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// NewLoggingMiddleware returns a Middleware that writes one structured JSON
+// line to stdout per request: method, path, status, latency, and remote
+// address.
+func NewLoggingMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			sw := &statusCapturingWriter{ResponseWriter: rw, statusCode: http.StatusOK}
+			next.ServeHTTP(sw, req)
+
+			entry := map[string]interface{}{
+				"time":        start.UTC().Format(time.RFC3339Nano),
+				"method":      req.Method,
+				"path":        req.URL.Path,
+				"status":      sw.statusCode,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"remote_addr": req.RemoteAddr,
+			}
+			if err := json.NewEncoder(os.Stdout).Encode(entry); err != nil {
+				log.Printf("[Middleware] failed to write access log: %v", err)
+			}
+		})
+	}
+}
+
+// --- Metrics ---
+
+// latencyBucketsSeconds are the Prometheus-style histogram bucket
+// boundaries MetricsCollector reports latency under, plus an implicit
+// trailing +Inf bucket.
+var latencyBucketsSeconds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type metricsContextKey struct{}
+
+// metricsRequestState carries the backend a request was routed to from the
+// terminal proxying handler back out to the MetricsMiddleware wrapping it,
+// so the middleware can attribute its measurements correctly even though it
+// runs before the backend is known.
+type metricsRequestState struct {
+	collector *MetricsCollector
+	backend   string
+}
+
+// recordBackend is called by the terminal proxying handler once it has
+// resolved which backend will serve req, so a wrapping MetricsMiddleware
+// can open its in-flight gauge and later attribute latency to that backend.
+func recordBackend(req *http.Request, address string) {
+	state, ok := req.Context().Value(metricsContextKey{}).(*metricsRequestState)
+	if !ok {
+		return
+	}
+	state.backend = address
+	state.collector.incInFlight(address, 1)
+}
+
+// MetricsCollector accumulates Prometheus-style per-backend counters: a
+// request count, a latency histogram, and an in-flight gauge. It also
+// implements http.Handler so it can be mounted directly (e.g. at
+// /metrics) to render them in Prometheus text exposition format.
+type MetricsCollector struct {
+	mu         sync.Mutex
+	requests   map[string]int64
+	inFlight   map[string]int64
+	histograms map[string][]int64 // bucket counts, parallel to latencyBucketsSeconds plus a trailing +Inf bucket
+}
+
+// NewMetricsCollector builds an empty MetricsCollector.
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		requests:   make(map[string]int64),
+		inFlight:   make(map[string]int64),
+		histograms: make(map[string][]int64),
+	}
+}
+
+func (mc *MetricsCollector) incInFlight(address string, delta int64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.inFlight[address] += delta
+}
+
+func (mc *MetricsCollector) observe(address string, d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.requests[address]++
+
+	buckets, ok := mc.histograms[address]
+	if !ok {
+		buckets = make([]int64, len(latencyBucketsSeconds)+1)
+		mc.histograms[address] = buckets
+	}
+	seconds := d.Seconds()
+	for i, le := range latencyBucketsSeconds {
+		if seconds <= le {
+			buckets[i]++
+		}
+	}
+	buckets[len(latencyBucketsSeconds)]++ // +Inf always counts
+}
+
+// ServeHTTP renders the collected counters in Prometheus text exposition
+// format.
+func (mc *MetricsCollector) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	backends := make([]string, 0, len(mc.requests))
+	for addr := range mc.requests {
+		backends = append(backends, addr)
+	}
+	sort.Strings(backends)
+
+	fmt.Fprintln(rw, "# HELP proxy_backend_requests_total Requests proxied per backend.")
+	fmt.Fprintln(rw, "# TYPE proxy_backend_requests_total counter")
+	for _, addr := range backends {
+		fmt.Fprintf(rw, "proxy_backend_requests_total{backend=%q} %d\n", addr, mc.requests[addr])
+	}
+
+	fmt.Fprintln(rw, "# HELP proxy_backend_in_flight Requests currently being proxied per backend.")
+	fmt.Fprintln(rw, "# TYPE proxy_backend_in_flight gauge")
+	for _, addr := range backends {
+		fmt.Fprintf(rw, "proxy_backend_in_flight{backend=%q} %d\n", addr, mc.inFlight[addr])
+	}
+
+	fmt.Fprintln(rw, "# HELP proxy_backend_request_duration_seconds Latency of proxied requests per backend.")
+	fmt.Fprintln(rw, "# TYPE proxy_backend_request_duration_seconds histogram")
+	for _, addr := range backends {
+		buckets := mc.histograms[addr]
+		for i, le := range latencyBucketsSeconds {
+			fmt.Fprintf(rw, "proxy_backend_request_duration_seconds_bucket{backend=%q,le=%q} %d\n", addr, strconv.FormatFloat(le, 'f', -1, 64), buckets[i])
+		}
+		fmt.Fprintf(rw, "proxy_backend_request_duration_seconds_bucket{backend=%q,le=\"+Inf\"} %d\n", addr, buckets[len(latencyBucketsSeconds)])
+	}
+}
+
+// NewMetricsMiddleware returns a Middleware that records, per backend
+// resolved by the terminal handler via recordBackend, a request count, an
+// in-flight gauge, and a latency histogram on collector. Requests that
+// never reach a backend (e.g. rejected earlier in the chain) aren't
+// counted.
+func NewMetricsMiddleware(collector *MetricsCollector) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			state := &metricsRequestState{collector: collector}
+			ctx := context.WithValue(req.Context(), metricsContextKey{}, state)
+
+			start := time.Now()
+			next.ServeHTTP(rw, req.WithContext(ctx))
+			duration := time.Since(start)
+
+			if state.backend == "" {
+				return
+			}
+			collector.incInFlight(state.backend, -1)
+			collector.observe(state.backend, duration)
+		})
+	}
+}
+
+// --- Gzip compression ---
+
+// gzipResponseWriter wraps an http.ResponseWriter so writes are
+// transparently gzip-compressed; Content-Length is stripped since the
+// compressed length differs from whatever the handler computed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack lets a gzip-wrapped writer still satisfy http.Hijacker, since the
+// chain also carries WebSocket upgrade requests through HandleProxyServing.
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// NewGzipMiddleware returns a Middleware that gzip-compresses the response
+// body whenever the client advertises support for it via Accept-Encoding.
+func NewGzipMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+				next.ServeHTTP(rw, req)
+				return
+			}
+
+			gz := gzip.NewWriter(rw)
+			defer gz.Close()
+
+			rw.Header().Set("Content-Encoding", "gzip")
+			rw.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(&gzipResponseWriter{ResponseWriter: rw, writer: gz}, req)
+		})
+	}
+}
+
+// --- Panic recovery ---
+
+// NewRecoveryMiddleware returns a Middleware that recovers a panic from any
+// handler further down the chain, logs it, and answers with 500 instead of
+// taking down the whole process.
+func NewRecoveryMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[Middleware] recovered panic serving %s %s: %v", req.Method, req.URL.Path, r)
+					http.Error(rw, "internal server error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// --- Rate limiting ---
+
+// tokenBucket is a classic token bucket: it refills at refillRate tokens
+// per second up to capacity, and allow reports whether a token was
+// available to spend.
+type tokenBucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	refillRate float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(refillRate, capacity float64) *tokenBucket {
+	return &tokenBucket{capacity: capacity, tokens: capacity, refillRate: refillRate, lastRefill: time.Now()}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.lastRefill).Seconds() * b.refillRate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.lastRefill = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimiter hands out a token bucket per client IP, so one noisy client
+// can't exhaust the capacity meant for another.
+type RateLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	rate     float64
+	capacity float64
+}
+
+// NewRateLimiter builds a RateLimiter allowing up to rate requests/sec per
+// client IP, bursting up to capacity tokens before throttling kicks in.
+func NewRateLimiter(rate, capacity float64) *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*tokenBucket), rate: rate, capacity: capacity}
+}
+
+func (rl *RateLimiter) bucketFor(clientIP string) *tokenBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.buckets[clientIP]
+	if !ok {
+		b = newTokenBucket(rl.rate, rl.capacity)
+		rl.buckets[clientIP] = b
+	}
+	return b
+}
+
+// Middleware returns the Middleware form of rl, rejecting requests over the
+// per-IP rate with 429 Too Many Requests.
+func (rl *RateLimiter) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !rl.bucketFor(clientIPOf(req)).allow() {
+				http.Error(rw, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// clientIPOf extracts the request's IP, stripping the port RemoteAddr
+// carries. req.RemoteAddr is trusted directly here, matching the proxy's
+// assumption elsewhere that it sits in front of clients rather than behind
+// another proxy that would populate X-Forwarded-For.
+func clientIPOf(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --- Prometheus metrics ---
+
+// PrometheusCollector is the client_golang-backed counterpart to
+// MetricsCollector: the same per-backend measurements, but as real
+// prometheus.Collector types under their own registry, so they can be
+// scraped with standard client_golang tooling (histogram quantiles,
+// alerting rules, etc.) instead of the hand-rolled text format
+// MetricsCollector.ServeHTTP renders.
+type PrometheusCollector struct {
+	registry *prometheus.Registry
+
+	requestTotal     *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	upstreamUp       *prometheus.GaugeVec
+	inflightRequests *prometheus.GaugeVec
+	ejectionsTotal   *prometheus.CounterVec
+}
+
+// NewPrometheusCollector builds a PrometheusCollector under its own
+// registry (rather than prometheus.DefaultRegisterer), so more than one
+// LoadBalancerStruct in the same process -- as in tests -- doesn't panic on
+// duplicate metric registration.
+func NewPrometheusCollector() *PrometheusCollector {
+	registry := prometheus.NewRegistry()
+
+	pc := &PrometheusCollector{
+		registry: registry,
+		requestTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "request_total",
+			Help: "Requests proxied per upstream, by response code.",
+		}, []string{"upstream", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "request_duration_seconds",
+			Help:    "Latency of proxied requests per upstream.",
+			Buckets: latencyBucketsSeconds,
+		}, []string{"upstream"}),
+		upstreamUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "upstream_up",
+			Help: "Whether an upstream is currently considered alive (1) or not (0).",
+		}, []string{"upstream"}),
+		inflightRequests: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "inflight_requests",
+			Help: "Requests currently being proxied per upstream.",
+		}, []string{"upstream"}),
+		ejectionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ejections_total",
+			Help: "Times an upstream was ejected from the pool, by reason.",
+		}, []string{"upstream", "reason"}),
+	}
+
+	registry.MustRegister(pc.requestTotal, pc.requestDuration, pc.upstreamUp, pc.inflightRequests, pc.ejectionsTotal)
+	return pc
+}
+
+// Handler renders every registered metric in Prometheus exposition format,
+// for mounting at /metrics.
+func (pc *PrometheusCollector) Handler() http.Handler {
+	return promhttp.HandlerFor(pc.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveUpstreamUp sets the upstream_up gauge for address, called once per
+// request from recordPrometheusBackend since this proxy has no separate
+// liveness-broadcast path client_golang could subscribe to directly.
+func (pc *PrometheusCollector) ObserveUpstreamUp(address string, alive bool) {
+	value := 0.0
+	if alive {
+		value = 1.0
+	}
+	pc.upstreamUp.WithLabelValues(address).Set(value)
+}
+
+// ObserveEjection increments ejections_total{upstream,reason}. Pass this as
+// CircuitBreakerConfig.OnEject / OutlierDetectorConfig.OnEject to wire up
+// either ejection mechanism.
+func (pc *PrometheusCollector) ObserveEjection(address, reason string) {
+	pc.ejectionsTotal.WithLabelValues(address, reason).Inc()
+}
+
+type prometheusContextKey struct{}
+
+// prometheusRequestState mirrors metricsRequestState: it carries the
+// backend resolved by the terminal proxying handler back out to
+// NewPrometheusMiddleware, which runs before that backend is known.
+type prometheusRequestState struct {
+	collector *PrometheusCollector
+	backend   string
+}
+
+// recordPrometheusBackend is the PrometheusCollector counterpart to
+// recordBackend, called alongside it from serveProxyRequest once a backend
+// is resolved. It also takes the opportunity to refresh upstream_up for
+// target, since this proxy has no separate liveness-broadcast path
+// client_golang could subscribe to directly.
+func recordPrometheusBackend(req *http.Request, target ServerInterface) {
+	state, ok := req.Context().Value(prometheusContextKey{}).(*prometheusRequestState)
+	if !ok {
+		return
+	}
+	address := target.GetAddress()
+	state.backend = address
+	state.collector.inflightRequests.WithLabelValues(address).Inc()
+	state.collector.ObserveUpstreamUp(address, target.CheckIfServerIsCurrentlyAlive())
+}
+
+// NewPrometheusMiddleware returns a Middleware recording, per backend
+// resolved by the terminal handler via recordPrometheusBackend, a
+// request_total counter (labeled by response code), a request_duration_seconds
+// histogram, and an inflight_requests gauge on collector.
+func NewPrometheusMiddleware(collector *PrometheusCollector) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			state := &prometheusRequestState{collector: collector}
+			ctx := context.WithValue(req.Context(), prometheusContextKey{}, state)
+
+			statusRW := &statusCapturingWriter{ResponseWriter: rw, statusCode: http.StatusOK}
+			start := time.Now()
+			next.ServeHTTP(statusRW, req.WithContext(ctx))
+			duration := time.Since(start)
+
+			if state.backend == "" {
+				return
+			}
+			collector.inflightRequests.WithLabelValues(state.backend).Dec()
+			collector.requestDuration.WithLabelValues(state.backend).Observe(duration.Seconds())
+			collector.requestTotal.WithLabelValues(state.backend, strconv.Itoa(statusRW.statusCode)).Inc()
+		})
+	}
+}
+
+// --- OpenTelemetry tracing ---
+
+var tracer = otel.Tracer("go-proxy/loadbalancer")
+
+// NewTracingMiddleware returns a Middleware that starts an OTel span for
+// each proxied request, propagates the span's context to the upstream via
+// a W3C traceparent header (the request object forwarded to
+// ServerInterface.ServeTheRequest carries the injected header straight
+// through), and records the resolved upstream, chosen strategy, retry
+// count, and whether the request was a WebSocket upgrade as span
+// attributes once serveProxyRequest resolves them via
+// recordTracingAttributes.
+func NewTracingMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			ctx, span := tracer.Start(req.Context(), "proxy.request")
+			defer span.End()
+
+			span.SetAttributes(
+				attribute.String("http.method", req.Method),
+				attribute.String("http.target", req.URL.Path),
+				attribute.Bool("ws.upgrade", isWebSocketUpgradeRequest(req)),
+				// This proxy has no retry mechanism (a request is sent to
+				// exactly the one backend FindNextAvailableServerForRequest
+				// or the active BalancingStrategy resolves), so retry.count
+				// is always 0; the attribute exists so a future retry layer
+				// doesn't have to add it to every span site.
+				attribute.Int("retry.count", 0),
+			)
+
+			req = req.WithContext(ctx)
+			otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// recordTracingAttributes annotates the span on req's context -- started by
+// NewTracingMiddleware -- with the backend serveProxyRequest resolved and
+// the strategy that chose it. It's a no-op if NewTracingMiddleware isn't in
+// the chain, since trace.SpanFromContext then returns a no-op span.
+func recordTracingAttributes(req *http.Request, address, strategyName string) {
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(
+		attribute.String("upstream.address", address),
+		attribute.String("upstream.strategy", strategyName),
+	)
+}
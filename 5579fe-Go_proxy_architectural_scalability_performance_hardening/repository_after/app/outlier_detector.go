@@ -0,0 +1,275 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+// OutlierDetectorConfig controls when passive outlier ejection kicks in and
+// how long an ejected backend is kept out of the pool. Unlike CircuitBreaker,
+// which trips on consecutive failures, this tracks a rolling error rate over
+// a bounded window -- closer to Envoy's outlier detection -- so a backend
+// that is merely flaky (errors interleaved with successes) is still ejected
+// once it's wrong often enough, not just when it fails repeatedly in a row.
+type OutlierDetectorConfig struct {
+	// WindowRequests is how many of the most recent requests (within
+	// WindowDuration) are considered when computing the error rate.
+	WindowRequests int
+	// WindowDuration bounds how far back WindowRequests looks; a request
+	// older than this is dropped from the window regardless of count.
+	WindowDuration time.Duration
+	// ErrorRateThreshold is the fraction of the window that must be errors
+	// to eject the backend, once the window has at least WindowRequests
+	// samples.
+	ErrorRateThreshold float64
+	// BaseEjectionTime is how long a backend stays ejected the first time
+	// it's ejected.
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the ejection time after repeated offenses double
+	// it.
+	MaxEjectionTime time.Duration
+	// OnEject, if set, is called with the backend's address every time it's
+	// ejected -- e.g. to increment a Prometheus ejections_total counter.
+	// Reason is always "error_rate", mirroring
+	// CircuitBreakerConfig.OnEject's "circuit_breaker".
+	OnEject func(address, reason string)
+}
+
+// DefaultOutlierDetectorConfig returns Envoy-inspired defaults: a backend
+// erroring on more than half of its last 20 requests within a 30s window is
+// ejected for 30 seconds, doubling on repeat offenses up to 5 minutes.
+func DefaultOutlierDetectorConfig() OutlierDetectorConfig {
+	return OutlierDetectorConfig{
+		WindowRequests:     20,
+		WindowDuration:     30 * time.Second,
+		ErrorRateThreshold: 0.5,
+		BaseEjectionTime:   30 * time.Second,
+		MaxEjectionTime:    5 * time.Minute,
+	}
+}
+
+// outlierSample is one recorded outcome within the rolling window.
+type outlierSample struct {
+	at      time.Time
+	isError bool
+}
+
+// outlierDetector tracks one backend's rolling error rate and ejection
+// state.
+type outlierDetector struct {
+	config  OutlierDetectorConfig
+	address string
+
+	mu            sync.Mutex
+	samples       []outlierSample
+	ejectedUntil  time.Time
+	ejectionCount int
+	nextEjection  time.Duration
+}
+
+func newOutlierDetector(config OutlierDetectorConfig, address string) *outlierDetector {
+	return &outlierDetector{config: config, address: address, nextEjection: config.BaseEjectionTime}
+}
+
+// recordResult appends a request outcome and ejects the backend if its
+// rolling error rate now exceeds ErrorRateThreshold.
+func (d *outlierDetector) recordResult(isError bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.samples = append(d.samples, outlierSample{at: now, isError: isError})
+	d.prune(now)
+
+	if len(d.samples) < d.config.WindowRequests {
+		return
+	}
+
+	errors := 0
+	for _, s := range d.samples {
+		if s.isError {
+			errors++
+		}
+	}
+	if float64(errors)/float64(len(d.samples)) <= d.config.ErrorRateThreshold {
+		return
+	}
+
+	d.ejectedUntil = now.Add(d.nextEjection)
+	d.ejectionCount++
+	d.samples = nil
+
+	next := d.nextEjection * 2
+	if next > d.config.MaxEjectionTime {
+		next = d.config.MaxEjectionTime
+	}
+	d.nextEjection = next
+
+	if d.config.OnEject != nil {
+		d.config.OnEject(d.address, "error_rate")
+	}
+}
+
+// prune drops samples older than WindowDuration and, if the window still
+// has more than WindowRequests entries, the oldest excess ones. Callers
+// must hold d.mu.
+func (d *outlierDetector) prune(now time.Time) {
+	cutoff := now.Add(-d.config.WindowDuration)
+	kept := d.samples[:0]
+	for _, s := range d.samples {
+		if s.at.After(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	d.samples = kept
+
+	if excess := len(d.samples) - d.config.WindowRequests; excess > 0 {
+		d.samples = d.samples[excess:]
+	}
+}
+
+// ejected reports whether the backend is currently ejected.
+func (d *outlierDetector) ejected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Now().Before(d.ejectedUntil)
+}
+
+// state reports the current ejection time remaining and rolling error rate,
+// for GetUpstreamStates.
+func (d *outlierDetector) state() (remaining time.Duration, errorRate float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.prune(time.Now())
+	if len(d.samples) > 0 {
+		errors := 0
+		for _, s := range d.samples {
+			if s.isError {
+				errors++
+			}
+		}
+		errorRate = float64(errors) / float64(len(d.samples))
+	}
+
+	if remaining = time.Until(d.ejectedUntil); remaining < 0 {
+		remaining = 0
+	}
+	return remaining, errorRate
+}
+
+// outlierDetectorRegistry hands out an outlierDetector per backend address,
+// created lazily on first use, mirroring CircuitBreakerRegistry.
+type outlierDetectorRegistry struct {
+	config OutlierDetectorConfig
+
+	mu        sync.Mutex
+	detectors map[string]*outlierDetector
+}
+
+func newOutlierDetectorRegistry(config OutlierDetectorConfig) *outlierDetectorRegistry {
+	return &outlierDetectorRegistry{config: config, detectors: make(map[string]*outlierDetector)}
+}
+
+func (r *outlierDetectorRegistry) forAddress(address string) *outlierDetector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.detectors[address]
+	if !ok {
+		d = newOutlierDetector(r.config, address)
+		r.detectors[address] = d
+	}
+	return d
+}
+
+// EnableOutlierDetection turns on passive outlier ejection: once enabled,
+// FindNextAvailableServerForRequest skips an ejected backend even if
+// CheckIfServerIsCurrentlyAlive returns true, and serveProxyRequest feeds
+// each response's outcome back into that backend's detector. It is opt-in,
+// like EnableCircuitBreakers, so existing callers of HandleProxyServing
+// keep today's behavior unless they ask for outlier detection.
+func (lb *LoadBalancerStruct) EnableOutlierDetection(config OutlierDetectorConfig) {
+	lb.stateMutex.Lock()
+	lb.outlierDetectors = newOutlierDetectorRegistry(config)
+	lb.stateMutex.Unlock()
+	lb.rewireConsistentHashUnhealthy()
+}
+
+// rewireConsistentHashUnhealthy re-derives the active strategy's Unhealthy
+// hook from the current circuit breaker / outlier detector state, if the
+// active strategy is a ConsistentHashStrategy. Called after either is
+// enabled, since both can be turned on independently and in either order.
+func (lb *LoadBalancerStruct) rewireConsistentHashUnhealthy() {
+	strategy, ok := lb.strategy.(*ConsistentHashStrategy)
+	if !ok {
+		return
+	}
+	strategy.SetUnhealthy(func(address string) bool {
+		return lb.circuitOpenFor(address) || lb.outlierEjectedFor(address)
+	})
+}
+
+// outlierDetectorFor returns address's detector, or nil if
+// EnableOutlierDetection hasn't been called.
+func (lb *LoadBalancerStruct) outlierDetectorFor(address string) *outlierDetector {
+	lb.stateMutex.RLock()
+	registry := lb.outlierDetectors
+	lb.stateMutex.RUnlock()
+
+	if registry == nil {
+		return nil
+	}
+	return registry.forAddress(address)
+}
+
+// outlierEjectedFor reports whether address is currently ejected. It always
+// returns false if outlier detection hasn't been enabled.
+func (lb *LoadBalancerStruct) outlierEjectedFor(address string) bool {
+	lb.stateMutex.RLock()
+	registry := lb.outlierDetectors
+	lb.stateMutex.RUnlock()
+
+	if registry == nil {
+		return false
+	}
+	return registry.forAddress(address).ejected()
+}
+
+// UpstreamState is one backend's observability snapshot, returned by
+// GetUpstreamStates.
+type UpstreamState struct {
+	Address           string        `json:"address"`
+	Alive             bool          `json:"alive"`
+	Ejected           bool          `json:"ejected"`
+	EjectionRemaining time.Duration `json:"ejectionRemaining"`
+	ErrorRate         float64       `json:"errorRate"`
+}
+
+// GetUpstreamStates reports every backend's liveness and, when
+// EnableOutlierDetection has been called, its ejection state and rolling
+// error rate -- for a /admin or /debug endpoint to surface, rather than
+// digging through logs.
+func (lb *LoadBalancerStruct) GetUpstreamStates() []UpstreamState {
+	lb.internalMutex.Lock()
+	servers := append([]ServerInterface(nil), lb.serversList...)
+	lb.internalMutex.Unlock()
+
+	lb.stateMutex.RLock()
+	registry := lb.outlierDetectors
+	lb.stateMutex.RUnlock()
+
+	states := make([]UpstreamState, 0, len(servers))
+	for _, s := range servers {
+		address := s.GetAddress()
+		state := UpstreamState{Address: address, Alive: s.CheckIfServerIsCurrentlyAlive()}
+		if registry != nil {
+			remaining, errorRate := registry.forAddress(address).state()
+			state.Ejected = remaining > 0
+			state.EjectionRemaining = remaining
+			state.ErrorRate = errorRate
+		}
+		states = append(states, state)
+	}
+	return states
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -67,9 +68,18 @@ type ServerImplementation struct {
 	addressString      string
 	reverseProxyObject *httputil.ReverseProxy
 	serverIndex        int
-	lastCheckedTime    time.Time
-	isAliveCache       bool
 	mutex              sync.RWMutex
+
+	// alive is maintained by a background HealthChecker (see
+	// health_checker.go) rather than probed synchronously on every read,
+	// so CheckIfServerIsCurrentlyAlive never blocks on the network.
+	alive atomic.Bool
+}
+
+// updateLiveness implements healthUpdatable so a HealthChecker can update
+// this server's cached status without going through the request path.
+func (serverInstance *ServerImplementation) updateLiveness(isAlive bool) {
+	serverInstance.alive.Store(isAlive)
 }
 
 type ServerWrapper struct {
@@ -88,6 +98,12 @@ func (tm *TelemetryMiddleware) CheckIfServerIsCurrentlyAlive() bool {
 	return tm.next.CheckIfServerIsCurrentlyAlive()
 }
 
+func (tm *TelemetryMiddleware) updateLiveness(isAlive bool) {
+	if next, ok := tm.next.(healthUpdatable); ok {
+		next.updateLiveness(isAlive)
+	}
+}
+
 func (tm *TelemetryMiddleware) ServeTheRequest(rw http.ResponseWriter, req *http.Request) {
 	start := time.Now()
 	tm.next.ServeTheRequest(rw, req)
@@ -110,6 +126,12 @@ func (lm *LoggingMiddleware) CheckIfServerIsCurrentlyAlive() bool {
 	return lm.next.CheckIfServerIsCurrentlyAlive()
 }
 
+func (lm *LoggingMiddleware) updateLiveness(isAlive bool) {
+	if next, ok := lm.next.(healthUpdatable); ok {
+		next.updateLiveness(isAlive)
+	}
+}
+
 func (lm *LoggingMiddleware) ServeTheRequest(rw http.ResponseWriter, req *http.Request) {
 	GetConfigManager().IncrementGlobalCounter()
 
@@ -130,38 +152,7 @@ func (serverInstance *ServerImplementation) GetAddress() string {
 }
 
 func (serverInstance *ServerImplementation) CheckIfServerIsCurrentlyAlive() bool {
-	serverInstance.mutex.Lock()
-	defer serverInstance.mutex.Unlock()
-
-	// [OPTIMIZATION] Health Check Caching (TTL: 1 Second)
-	// This prevents the Load Balancer from serializing requests when the backend is slow.
-	// If we checked recently, trust the cache.
-	if time.Since(serverInstance.lastCheckedTime) < 1*time.Second {
-		return serverInstance.isAliveCache
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	fullHealthCheckUrl := serverInstance.addressString + "/health"
-
-	req, err := http.NewRequestWithContext(ctx, "GET", fullHealthCheckUrl, nil)
-	if err != nil {
-		serverInstance.isAliveCache = false
-		return false
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		serverInstance.isAliveCache = false
-		return false
-	}
-	defer resp.Body.Close()
-
-	serverInstance.isAliveCache = (resp.StatusCode == http.StatusOK)
-	serverInstance.lastCheckedTime = time.Now()
-
-	return serverInstance.isAliveCache
+	return serverInstance.alive.Load()
 }
 
 func (serverInstance *ServerImplementation) ServeTheRequest(rw http.ResponseWriter, req *http.Request) {
@@ -176,10 +167,11 @@ func CreateNewSimpleServerInstance(addressParameter string, indexParameter int)
 		addressString:      addressParameter,
 		reverseProxyObject: httputil.NewSingleHostReverseProxy(parsedUrl),
 		serverIndex:        indexParameter,
-		// [FIX] Initialize to zero time so the first check ALWAYS runs
-		lastCheckedTime:    time.Time{},
-		isAliveCache:       false,
 	}
+	// Optimistically alive until a HealthChecker (if started) says
+	// otherwise, so a pool is usable immediately without waiting on the
+	// first probe.
+	baseImpl.alive.Store(true)
 
 	telemetryLayer := &TelemetryMiddleware{next: baseImpl}
 	loggingLayer := &LoggingMiddleware{next: telemetryLayer}
@@ -195,6 +187,12 @@ func (sw *ServerWrapper) CheckIfServerIsCurrentlyAlive() bool {
 	return sw.innerServer.CheckIfServerIsCurrentlyAlive()
 }
 
+func (sw *ServerWrapper) updateLiveness(isAlive bool) {
+	if inner, ok := sw.innerServer.(healthUpdatable); ok {
+		inner.updateLiveness(isAlive)
+	}
+}
+
 func (sw *ServerWrapper) ServeTheRequest(rw http.ResponseWriter, req *http.Request) {
 	sw.innerServer.ServeTheRequest(rw, req)
 }
@@ -218,6 +216,106 @@ type LoadBalancerStruct struct {
 	unusedField1 int
 	unusedField2 string
 	unusedField3 bool
+
+	responseCache    *ResponseCache
+	healthChecker    *HealthChecker
+	circuitBreakers  *CircuitBreakerRegistry
+	outlierDetectors *outlierDetectorRegistry
+	configWatcher    *configWatcher
+
+	// shuttingDown and inFlightRequests implement Shutdown's drain
+	// semantics: HandleProxyServing refuses new requests once the former
+	// is set, and Shutdown waits on the latter for requests already
+	// admitted to finish.
+	shuttingDown     atomic.Bool
+	inFlightRequests sync.WaitGroup
+
+	// middlewares is the chain Use appends to; HandleProxyServing composes
+	// it around serveProxyRequest on every call, so changes made via Use
+	// take effect for requests already in flight the next time they're read.
+	middlewares []Middleware
+
+	// strategy, if set (via CreateNewLoadBalancerInstanceWithStrategy),
+	// overrides FindNextAvailableServerForRequest for plain HTTP requests
+	// without document affinity. Document-routed and legacy-constructed
+	// load balancers are unaffected.
+	strategy BalancingStrategy
+}
+
+// EnableResponseCache turns on caching of GET responses for this load
+// balancer. It is opt-in so existing callers of HandleProxyServing keep
+// their current pass-through behavior unless they ask for caching.
+func (lb *LoadBalancerStruct) EnableResponseCache(cache *ResponseCache) {
+	lb.stateMutex.Lock()
+	defer lb.stateMutex.Unlock()
+	lb.responseCache = cache
+}
+
+// CachePurgeHandler returns the admin handler for POST /cache/purge, or nil
+// if response caching isn't enabled.
+func (lb *LoadBalancerStruct) CachePurgeHandler() http.HandlerFunc {
+	lb.stateMutex.RLock()
+	defer lb.stateMutex.RUnlock()
+	if lb.responseCache == nil {
+		return nil
+	}
+	return lb.responseCache.PurgeHandler()
+}
+
+// StartHealthChecks launches a background HealthChecker that probes every
+// backend's /health endpoint on interval and keeps each one's cached
+// liveness up to date, so FindNextAvailableServerForRequest never blocks
+// on a network call. Calling it again replaces the previous checker.
+func (lb *LoadBalancerStruct) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	lb.stateMutex.Lock()
+	defer lb.stateMutex.Unlock()
+
+	if lb.healthChecker != nil {
+		lb.healthChecker.stop()
+	}
+	lb.healthChecker = newHealthChecker(lb.serversList, interval)
+	lb.healthChecker.start(ctx)
+}
+
+// Stop shuts down the background health checker started by
+// StartHealthChecks, if any, waiting for its probing goroutine to exit.
+func (lb *LoadBalancerStruct) Stop() {
+	lb.stateMutex.Lock()
+	defer lb.stateMutex.Unlock()
+
+	if lb.healthChecker != nil {
+		lb.healthChecker.stop()
+		lb.healthChecker = nil
+	}
+}
+
+// HealthzHandler answers GET /healthz with the cached liveness of every
+// backend, returning 503 if any of them is currently down.
+func (lb *LoadBalancerStruct) HealthzHandler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		lb.internalMutex.Lock()
+		servers := append([]ServerInterface(nil), lb.serversList...)
+		lb.internalMutex.Unlock()
+
+		type backendStatus struct {
+			Address string `json:"address"`
+			Alive   bool   `json:"alive"`
+		}
+
+		statuses := make([]backendStatus, 0, len(servers))
+		allAlive := true
+		for _, s := range servers {
+			alive := s.CheckIfServerIsCurrentlyAlive()
+			allAlive = allAlive && alive
+			statuses = append(statuses, backendStatus{Address: s.GetAddress(), Alive: alive})
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if !allAlive {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"backends": statuses})
+	}
 }
 
 func CreateNewLoadBalancerInstance(portParameter string, serversParameter []ServerInterface) *LoadBalancerStruct {
@@ -240,6 +338,34 @@ func CreateNewLoadBalancerInstance(portParameter string, serversParameter []Serv
 	}
 }
 
+// LoadBalancerOptions bundles the construction-time settings
+// CreateNewLoadBalancerInstanceWithOptions accepts, so adding another
+// optional setting later doesn't grow the constructor's parameter list.
+type LoadBalancerOptions struct {
+	// Strategy overrides FindNextAvailableServerForRequest for plain HTTP
+	// requests, same as CreateNewLoadBalancerInstanceWithStrategy. Nil
+	// keeps the default round-robin behavior.
+	Strategy BalancingStrategy
+}
+
+// CreateNewLoadBalancerInstanceWithOptions is CreateNewLoadBalancerInstance
+// with its optional settings selected at construction time via opts, rather
+// than through a separate constructor per setting.
+func CreateNewLoadBalancerInstanceWithOptions(portParameter string, serversParameter []ServerInterface, opts LoadBalancerOptions) *LoadBalancerStruct {
+	lb := CreateNewLoadBalancerInstance(portParameter, serversParameter)
+	lb.strategy = opts.Strategy
+	return lb
+}
+
+// CreateNewLoadBalancerInstanceWithStrategy is CreateNewLoadBalancerInstance
+// with an explicit BalancingStrategy for plain HTTP requests, in place of
+// the default FindNextAvailableServerForRequest round-robin.
+func CreateNewLoadBalancerInstanceWithStrategy(portParameter string, serversParameter []ServerInterface, strategy BalancingStrategy) *LoadBalancerStruct {
+	lb := CreateNewLoadBalancerInstance(portParameter, serversParameter)
+	lb.strategy = strategy
+	return lb
+}
+
 func (lb *LoadBalancerStruct) FindNextAvailableServerForRequest(isWebSocketRequest bool) ServerInterface {
 	lb.internalMutex.Lock()
 	defer lb.internalMutex.Unlock()
@@ -260,8 +386,12 @@ func (lb *LoadBalancerStruct) FindNextAvailableServerForRequest(isWebSocketReque
 		candidate := lb.serversList[idx]
 
 		// Because of the TTL optimization in CheckIfServerIsCurrentlyAlive,
-		// this call will be instant for 9/10 concurrent requests.
-		if candidate.CheckIfServerIsCurrentlyAlive() {
+		// this call will be instant for 9/10 concurrent requests. A tripped
+		// circuit breaker (see EnableCircuitBreakers) and an ejected outlier
+		// (see EnableOutlierDetection) are both checked without going
+		// through CheckIfServerIsCurrentlyAlive, since neither reflects
+		// network liveness.
+		if candidate.CheckIfServerIsCurrentlyAlive() && !lb.circuitOpenFor(candidate.GetAddress()) && !lb.outlierEjectedFor(candidate.GetAddress()) {
 			if isWebSocketRequest {
 				lb.roundRobinCounterForWebSocketRequests = (idx + magic1) % serverCount
 			} else {
@@ -290,6 +420,12 @@ func (lb *LoadBalancerStruct) updateServerHealthCache(address string, status boo
 	lb.configurationMap["last_update"] = time.Now().UnixNano()
 }
 
+// FindServerWithExistingDocumentConnection resolves sticky WebSocket routing
+// via the documentId/address maps below. ConsistentHashStrategy offers the
+// same document affinity without an ever-growing map, at the cost of not
+// remembering a connection's exact server once it's established; LBs built
+// with CreateNewLoadBalancerInstanceWithStrategy can opt into it instead,
+// but document-routed requests always go through this map-based path.
 func (lb *LoadBalancerStruct) FindServerWithExistingDocumentConnection(documentIdentifier string) ServerInterface {
 	lb.secondaryMutex.Lock()
 	defer lb.secondaryMutex.Unlock()
@@ -327,22 +463,240 @@ func (w *SamplingResponseWriter) Write(b []byte) (int, error) {
 	return w.ResponseWriter.Write(b)
 }
 
+// HandleProxyServing composes the registered middleware chain (see Use)
+// around serveProxyRequest, the terminal handler that actually resolves a
+// backend and proxies to it, and serves req through it. Once Shutdown has
+// been called it refuses new requests with 503 instead, and every admitted
+// request is tracked so Shutdown can wait for it to finish draining.
 func (lb *LoadBalancerStruct) HandleProxyServing(rw http.ResponseWriter, req *http.Request) {
+	if lb.shuttingDown.Load() {
+		http.Error(rw, "load balancer is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	lb.inFlightRequests.Add(1)
+	defer lb.inFlightRequests.Done()
+
+	lb.stateMutex.RLock()
+	chain := append([]Middleware(nil), lb.middlewares...)
+	lb.stateMutex.RUnlock()
+
+	composeMiddleware(chain, http.HandlerFunc(lb.serveProxyRequest)).ServeHTTP(rw, req)
+}
+
+// serveProxyRequest resolves a backend for req and proxies to it. It is the
+// terminal handler HandleProxyServing wraps in the middleware chain.
+func (lb *LoadBalancerStruct) serveProxyRequest(rw http.ResponseWriter, req *http.Request) {
 	docID := req.URL.Query().Get("document_id")
 
 	var target ServerInterface
 	if len(docID) > 0 {
 		target = lb.FindServerWithExistingDocumentConnection(docID)
+	} else if lb.strategy != nil {
+		target = lb.strategy.Pick(lb.serversList, req)
 	} else {
 		target = lb.FindNextAvailableServerForRequest(false)
 	}
 
+	if isWebSocketUpgradeRequest(req) {
+		lb.proxyWebSocketConnection(rw, req, target, docID)
+		return
+	}
+
+	address := target.GetAddress()
+	recordBackend(req, address)
+	recordPrometheusBackend(req, target)
+	recordTracingAttributes(req, address, lb.activeStrategyName(docID))
+
+	breaker := lb.circuitBreakerFor(address)
+	if breaker != nil && !breaker.allow() {
+		circuitBreakerUnavailableHandler(rw)
+		return
+	}
+
+	if tracker, ok := lb.strategy.(ConnectionAware); ok {
+		tracker.RequestStarted(address)
+		defer tracker.RequestFinished(address)
+	}
+	var started time.Time
+	if _, ok := lb.strategy.(LatencyAware); ok {
+		started = time.Now()
+	}
+
+	statusRW := &statusCapturingWriter{ResponseWriter: rw, statusCode: http.StatusOK}
 	samplingRW := &SamplingResponseWriter{
-		ResponseWriter: rw,
+		ResponseWriter: statusRW,
 		lb:             lb,
 	}
 
-	target.ServeTheRequest(samplingRW, req)
+	if lb.responseCache != nil {
+		lb.responseCache.serve(samplingRW, req, target)
+	} else {
+		target.ServeTheRequest(samplingRW, req)
+	}
+
+	if breaker != nil {
+		breaker.recordResult(statusRW.statusCode < http.StatusInternalServerError)
+	}
+	if detector := lb.outlierDetectorFor(address); detector != nil {
+		detector.recordResult(statusRW.statusCode >= http.StatusInternalServerError)
+	}
+
+	if latencyTracker, ok := lb.strategy.(LatencyAware); ok {
+		latencyTracker.RecordLatency(address, time.Since(started))
+	}
+}
+
+// activeStrategyName reports, for tracing, which routing path resolved the
+// current request's backend: document-affinity sticky routing, the
+// configured BalancingStrategy's own type, or the default round-robin.
+func (lb *LoadBalancerStruct) activeStrategyName(docID string) string {
+	switch {
+	case len(docID) > 0:
+		return "document-affinity"
+	case lb.strategy != nil:
+		return fmt.Sprintf("%T", lb.strategy)
+	default:
+		return "round-robin"
+	}
+}
+
+// --- 5. WebSocket Reverse Proxying ---
+
+var websocketUpgrader = websocket.Upgrader{
+	// The client talks to us, not to the backend, across an origin the
+	// backend already trusts by virtue of being reachable through this
+	// proxy at all, so we don't second-guess it here.
+	CheckOrigin: func(req *http.Request) bool { return true },
+}
+
+func isWebSocketUpgradeRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// proxyWebSocketConnection upgrades the client's hijacked connection,
+// dials target's own WebSocket endpoint, and shuttles frames between the
+// two until either side closes. The real *websocket.Conn replaces the
+// placeholder FindServerWithExistingDocumentConnection stores for docID,
+// and is evicted again once the connection ends so the next request for
+// docID re-resolves rather than sticking to a dead entry.
+func (lb *LoadBalancerStruct) proxyWebSocketConnection(rw http.ResponseWriter, req *http.Request, target ServerInterface, docID string) {
+	clientConn, err := websocketUpgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		log.Printf("[WebSocket] client handshake failed: %v", err)
+		if len(docID) > 0 {
+			lb.evictStaleDocumentPlaceholder(docID, target.GetAddress())
+		}
+		return
+	}
+	defer clientConn.Close()
+
+	backendConn, _, err := websocket.DefaultDialer.Dial(backendWebSocketURL(target.GetAddress(), req), nil)
+	if err != nil {
+		log.Printf("[WebSocket] backend dial to %s failed: %v", target.GetAddress(), err)
+		if len(docID) > 0 {
+			lb.evictStaleDocumentPlaceholder(docID, target.GetAddress())
+		}
+		return
+	}
+	defer backendConn.Close()
+
+	if len(docID) > 0 {
+		lb.registerDocumentConnection(docID, target.GetAddress(), clientConn)
+		defer lb.evictDocumentConnection(docID, clientConn)
+	}
+
+	done := make(chan struct{}, 2)
+	go copyWebSocketFrames(backendConn, clientConn, done)
+	go copyWebSocketFrames(clientConn, backendConn, done)
+	<-done
+}
+
+// copyWebSocketFrames relays messages from src to dst until either side
+// errors (including a normal close), then signals done so the caller can
+// tear down the other half of the pipe.
+func copyWebSocketFrames(dst, src *websocket.Conn, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	for {
+		messageType, message, err := src.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := dst.WriteMessage(messageType, message); err != nil {
+			return
+		}
+	}
+}
+
+// backendWebSocketURL rewrites target's http(s) address into the ws(s) URL
+// for the same request path and query.
+func backendWebSocketURL(address string, req *http.Request) string {
+	scheme := "ws"
+	host := address
+	switch {
+	case strings.HasPrefix(address, "https://"):
+		scheme = "wss"
+		host = strings.TrimPrefix(address, "https://")
+	case strings.HasPrefix(address, "http://"):
+		host = strings.TrimPrefix(address, "http://")
+	}
+
+	backendURL := url.URL{Scheme: scheme, Host: host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
+	return backendURL.String()
+}
+
+// registerDocumentConnection replaces whatever connection (placeholder or
+// otherwise) is on file for docID with the now-established conn.
+func (lb *LoadBalancerStruct) registerDocumentConnection(docID, address string, conn *websocket.Conn) {
+	cleanDocID := strings.TrimSpace(docID)
+
+	lb.secondaryMutex.Lock()
+	defer lb.secondaryMutex.Unlock()
+
+	if old, exists := lb.documentIdToWebSocketConnectionMapping[cleanDocID]; exists {
+		delete(lb.webSocketConnectionToServerAddressMap, old)
+	}
+	lb.documentIdToWebSocketConnectionMapping[cleanDocID] = conn
+	lb.webSocketConnectionToServerAddressMap[conn] = address
+}
+
+// evictDocumentConnection removes docID's entry once conn has closed, so a
+// follow-up request resolves to a freshly chosen (alive) server instead of
+// reusing a dead connection's address.
+func (lb *LoadBalancerStruct) evictDocumentConnection(docID string, conn *websocket.Conn) {
+	cleanDocID := strings.TrimSpace(docID)
+
+	lb.secondaryMutex.Lock()
+	defer lb.secondaryMutex.Unlock()
+
+	if current, exists := lb.documentIdToWebSocketConnectionMapping[cleanDocID]; exists && current == conn {
+		delete(lb.documentIdToWebSocketConnectionMapping, cleanDocID)
+	}
+	delete(lb.webSocketConnectionToServerAddressMap, conn)
+}
+
+// evictStaleDocumentPlaceholder removes docID's entry if it still points to
+// address, the server FindServerWithExistingDocumentConnection resolved for
+// a WebSocket upgrade that then failed before registerDocumentConnection
+// could replace the placeholder with a real connection. Without this, a
+// failed handshake or backend dial would otherwise leave a dead placeholder
+// stuck in both maps, sticking every future request for docID to a server
+// it never actually connected to.
+func (lb *LoadBalancerStruct) evictStaleDocumentPlaceholder(docID, address string) {
+	cleanDocID := strings.TrimSpace(docID)
+
+	lb.secondaryMutex.Lock()
+	defer lb.secondaryMutex.Unlock()
+
+	conn, exists := lb.documentIdToWebSocketConnectionMapping[cleanDocID]
+	if !exists {
+		return
+	}
+	if mappedAddress, ok := lb.webSocketConnectionToServerAddressMap[conn]; !ok || mappedAddress != address {
+		return
+	}
+	delete(lb.documentIdToWebSocketConnectionMapping, cleanDocID)
+	delete(lb.webSocketConnectionToServerAddressMap, conn)
 }
 
 func HandleErrorFunction(err error) {
@@ -0,0 +1,446 @@
+package app
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Cache entry & storage ---
+
+// CacheEntry is the stored representation of one cached response: the body
+// plus just enough metadata to answer future requests and revalidate.
+type CacheEntry struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"-"`
+	Expiry       time.Time   `json:"expiry"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+}
+
+func (e *CacheEntry) isFresh() bool {
+	return time.Now().Before(e.Expiry)
+}
+
+// Storage is the pluggable backend for cached responses. Implementations
+// must be safe for concurrent use.
+type Storage interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+	Purge()
+}
+
+// --- In-memory LRU, used for hot entries ---
+
+type memoryLRU struct {
+	mutex    sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+// NewMemoryLRU builds an in-process cache bounded by maxBytes of response
+// body size, evicting least-recently-used entries once the cap is hit.
+func NewMemoryLRU(maxBytes int64) Storage {
+	return &memoryLRU{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryLRU) Get(key string) (*CacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+func (c *memoryLRU) Set(key string, entry *CacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	size := int64(len(entry.Body))
+
+	if el, ok := c.items[key]; ok {
+		c.curBytes -= el.Value.(*lruItem).size
+		el.Value = &lruItem{key: key, entry: entry, size: size}
+		c.curBytes += size
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(&lruItem{key: key, entry: entry, size: size})
+		c.items[key] = el
+		c.curBytes += size
+	}
+
+	for c.curBytes > c.maxBytes && c.ll.Len() > 0 {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		item := back.Value.(*lruItem)
+		c.ll.Remove(back)
+		delete(c.items, item.key)
+		c.curBytes -= item.size
+	}
+}
+
+func (c *memoryLRU) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.curBytes -= el.Value.(*lruItem).size
+	}
+}
+
+func (c *memoryLRU) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.curBytes = 0
+}
+
+// --- Filesystem storage ---
+
+// fileStorage persists each entry as a content-addressed body file plus a
+// JSON sidecar carrying the metadata (status, headers, expiry, etag).
+type fileStorage struct {
+	dir string
+}
+
+// NewFileStorage stores cache entries under dir, creating it if needed.
+func NewFileStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStorage{dir: dir}, nil
+}
+
+func (f *fileStorage) bodyPath(key string) string { return filepath.Join(f.dir, key+".body") }
+func (f *fileStorage) metaPath(key string) string { return filepath.Join(f.dir, key+".meta.json") }
+
+func (f *fileStorage) Get(key string) (*CacheEntry, bool) {
+	metaRaw, err := os.ReadFile(f.metaPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(metaRaw, &entry); err != nil {
+		return nil, false
+	}
+	body, err := os.ReadFile(f.bodyPath(key))
+	if err != nil {
+		return nil, false
+	}
+	entry.Body = body
+	return &entry, true
+}
+
+func (f *fileStorage) Set(key string, entry *CacheEntry) {
+	metaRaw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(f.metaPath(key), metaRaw, 0o644)
+	_ = os.WriteFile(f.bodyPath(key), entry.Body, 0o644)
+}
+
+func (f *fileStorage) Delete(key string) {
+	_ = os.Remove(f.metaPath(key))
+	_ = os.Remove(f.bodyPath(key))
+}
+
+func (f *fileStorage) Purge() {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		_ = os.Remove(filepath.Join(f.dir, e.Name()))
+	}
+}
+
+// --- Response cache wired into the load balancer ---
+
+// ResponseCache turns the round-robin proxy into a caching reverse proxy.
+// It never changes the ServerInterface shape: it sits in front of
+// HandleProxyServing and only ever calls ServeTheRequest on the cache miss
+// and revalidation paths.
+type ResponseCache struct {
+	storage    Storage
+	defaultTTL time.Duration
+	routeTTLs  map[string]time.Duration
+
+	// varyMu guards varyByPath, the Vary header names last observed on a
+	// cacheable response for a given URL path. serve consults it to key
+	// its very first storage lookup for a path the same way storeAndServe
+	// will key the write, instead of probing under a Vary-unaware key
+	// that's never actually written and only discovering the right key
+	// after a second backend round-trip.
+	varyMu     sync.Mutex
+	varyByPath map[string][]string
+}
+
+// NewResponseCache builds a cache using storage for entries, defaultTTL for
+// routes with no override, and routeTTLs keyed by URL path prefix.
+func NewResponseCache(storage Storage, defaultTTL time.Duration, routeTTLs map[string]time.Duration) *ResponseCache {
+	if routeTTLs == nil {
+		routeTTLs = make(map[string]time.Duration)
+	}
+	return &ResponseCache{
+		storage:    storage,
+		defaultTTL: defaultTTL,
+		routeTTLs:  routeTTLs,
+		varyByPath: make(map[string][]string),
+	}
+}
+
+// varyFor returns the Vary header names last seen on a cacheable response
+// for path, or nil if no response for this path has been cached yet.
+func (rc *ResponseCache) varyFor(path string) []string {
+	rc.varyMu.Lock()
+	defer rc.varyMu.Unlock()
+	return rc.varyByPath[path]
+}
+
+func (rc *ResponseCache) rememberVary(path string, names []string) {
+	rc.varyMu.Lock()
+	defer rc.varyMu.Unlock()
+	rc.varyByPath[path] = names
+}
+
+func (rc *ResponseCache) ttlFor(path string) time.Duration {
+	for prefix, ttl := range rc.routeTTLs {
+		if strings.HasPrefix(path, prefix) {
+			return ttl
+		}
+	}
+	return rc.defaultTTL
+}
+
+// cacheKey hashes method + URL + the values of any Vary-listed headers, so
+// two requests that differ only in an irrelevant header share an entry.
+func cacheKey(req *http.Request, varyHeaders []string) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method))
+	h.Write([]byte(req.URL.String()))
+	for _, name := range varyHeaders {
+		h.Write([]byte(name))
+		h.Write([]byte(req.Header.Get(name)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	if cc := req.Header.Get("Cache-Control"); strings.Contains(cc, "no-store") || strings.Contains(cc, "no-cache") {
+		return false
+	}
+	return true
+}
+
+func isCacheableResponse(header http.Header, status int) bool {
+	if status != http.StatusOK {
+		return false
+	}
+	cc := header.Get("Cache-Control")
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return false
+	}
+	return true
+}
+
+// recordingResponseWriter buffers a response so it can be inspected (for
+// caching decisions) before forwarding it to the real client, and reused as
+// a throwaway recorder for revalidation requests made straight to upstream.
+type recordingResponseWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+	wroteHeader bool
+}
+
+func newRecordingResponseWriter() *recordingResponseWriter {
+	return &recordingResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (w *recordingResponseWriter) Header() http.Header { return w.header }
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+func expiryFromHeaders(header http.Header, defaultTTL time.Duration) time.Time {
+	if cc := header.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.TrimSpace(directive)
+			if strings.HasPrefix(directive, "max-age=") {
+				if secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+					return time.Now().Add(time.Duration(secs) * time.Second)
+				}
+			}
+		}
+	}
+	return time.Now().Add(defaultTTL)
+}
+
+// varyHeaderNames parses a Vary response header into the header names a
+// future request's cache key must account for.
+func varyHeaderNames(header http.Header) []string {
+	raw := header.Get("Vary")
+	if raw == "" {
+		return nil
+	}
+	var names []string
+	for _, part := range strings.Split(raw, ",") {
+		names = append(names, strings.TrimSpace(part))
+	}
+	return names
+}
+
+// serve is the caching entry point HandleProxyServing delegates to for
+// cacheable GET requests. target is the backend already picked by the load
+// balancer's routing strategy.
+func (rc *ResponseCache) serve(rw http.ResponseWriter, req *http.Request, target ServerInterface) {
+	if !isCacheableRequest(req) {
+		rw.Header().Set("Cache-Status", "bypass")
+		target.ServeTheRequest(rw, req)
+		return
+	}
+
+	key := cacheKey(req, rc.varyFor(req.URL.Path))
+	entry, hit := rc.storage.Get(key)
+
+	if hit && entry.isFresh() {
+		writeCachedEntry(rw, entry, "hit")
+		return
+	}
+
+	if hit {
+		rc.revalidate(rw, req, target, key, entry)
+		return
+	}
+
+	rc.populate(rw, req, target)
+}
+
+func writeCachedEntry(rw http.ResponseWriter, entry *CacheEntry, status string) {
+	for name, values := range entry.Header {
+		for _, v := range values {
+			rw.Header().Add(name, v)
+		}
+	}
+	rw.Header().Set("Cache-Status", status)
+	rw.WriteHeader(entry.StatusCode)
+	rw.Write(entry.Body)
+}
+
+// revalidate issues a conditional request to target and either serves the
+// (now-extended) cached entry on 304, or stores and serves the fresh 200.
+func (rc *ResponseCache) revalidate(rw http.ResponseWriter, req *http.Request, target ServerInterface, key string, entry *CacheEntry) {
+	condReq := req.Clone(req.Context())
+	if entry.ETag != "" {
+		condReq.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		condReq.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	rec := newRecordingResponseWriter()
+	target.ServeTheRequest(rec, condReq)
+
+	if rec.statusCode == http.StatusNotModified {
+		entry.Expiry = expiryFromHeaders(rec.header, rc.ttlFor(req.URL.Path))
+		rc.storage.Set(key, entry)
+		writeCachedEntry(rw, entry, "stale")
+		return
+	}
+
+	rc.storeAndServe(rw, req, rec)
+}
+
+// populate fetches from the backend on a clean cache miss.
+func (rc *ResponseCache) populate(rw http.ResponseWriter, req *http.Request, target ServerInterface) {
+	rec := newRecordingResponseWriter()
+	target.ServeTheRequest(rec, req)
+	rc.storeAndServe(rw, req, rec)
+}
+
+// storeAndServe stores rec's response under the key the Vary header on
+// this very response calls for -- derived now, from the response we
+// already have in hand, rather than writing a throwaway Vary-unaware
+// entry and only discovering the right key on a later request.
+func (rc *ResponseCache) storeAndServe(rw http.ResponseWriter, req *http.Request, rec *recordingResponseWriter) {
+	if isCacheableResponse(rec.header, rec.statusCode) {
+		varyNames := varyHeaderNames(rec.header)
+		rc.rememberVary(req.URL.Path, varyNames)
+
+		key := cacheKey(req, varyNames)
+		entry := &CacheEntry{
+			StatusCode:   rec.statusCode,
+			Header:       rec.header.Clone(),
+			Body:         rec.body.Bytes(),
+			Expiry:       expiryFromHeaders(rec.header, rc.ttlFor(req.URL.Path)),
+			ETag:         rec.header.Get("ETag"),
+			LastModified: rec.header.Get("Last-Modified"),
+		}
+		rc.storage.Set(key, entry)
+		writeCachedEntry(rw, entry, "miss")
+		return
+	}
+
+	for name, values := range rec.header {
+		for _, v := range values {
+			rw.Header().Add(name, v)
+		}
+	}
+	rw.Header().Set("Cache-Status", "bypass")
+	rw.WriteHeader(rec.statusCode)
+	rw.Write(rec.body.Bytes())
+}
+
+// PurgeHandler exposes the admin endpoint that clears the entire cache.
+func (rc *ResponseCache) PurgeHandler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		rc.storage.Purge()
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go-proxy/repository_after/app"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
@@ -20,11 +23,66 @@ func main() {
 
 	lb := app.CreateNewLoadBalancerInstance("7000", interfaceList)
 
+	lb.StartHealthChecks(context.Background(), 10*time.Second)
+	defer lb.Stop()
+
+	promCollector := app.NewPrometheusCollector()
+
+	breakerConfig := app.DefaultCircuitBreakerConfig()
+	breakerConfig.OnEject = promCollector.ObserveEjection
+	lb.EnableCircuitBreakers(breakerConfig)
+
+	outlierConfig := app.DefaultOutlierDetectorConfig()
+	outlierConfig.OnEject = promCollector.ObserveEjection
+	lb.EnableOutlierDetection(outlierConfig)
+
+	metrics := app.NewMetricsCollector()
+	lb.Use(
+		app.NewRecoveryMiddleware(),
+		app.NewLoggingMiddleware(),
+		app.NewTracingMiddleware(),
+		app.NewMetricsMiddleware(metrics),
+		app.NewPrometheusMiddleware(promCollector),
+		app.NewRateLimiter(50, 100).Middleware(),
+		app.NewGzipMiddleware(),
+	)
+	http.Handle("/metrics", metrics)
+
+	// Prometheus metrics are served on a separate admin listener rather than
+	// alongside the proxy's own /metrics, so scraping client_golang's format
+	// never collides with the hand-rolled MetricsCollector route above.
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = "0.0.0.0:9100"
+	}
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/metrics", promCollector.Handler())
+	go func() {
+		if err := http.ListenAndServe(adminAddr, adminMux); err != nil {
+			app.HandleErrorFunction(err)
+		}
+	}()
+
+	if cacheDir := os.Getenv("RESPONSE_CACHE_DIR"); cacheDir != "" {
+		storage, err := app.NewFileStorage(cacheDir)
+		if err != nil {
+			app.HandleErrorFunction(err)
+		} else {
+			lb.EnableResponseCache(app.NewResponseCache(storage, 60*time.Second, nil))
+		}
+	}
+
 	// Mux registration
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		lb.HandleProxyServing(w, r)
 	})
 
+	if purge := lb.CachePurgeHandler(); purge != nil {
+		http.HandleFunc("/cache/purge", purge)
+	}
+
+	http.HandleFunc("/healthz", lb.HealthzHandler())
+
 	listenAddr := "0.0.0.0:" + lb.PortNumber
 	fmt.Printf("Starting Enterprise Load Balancer on %s\n", listenAddr)
 
@@ -91,6 +91,8 @@ type LoadBalancerStruct struct {
 	unusedField1                            int
 	unusedField2                            string
 	unusedField3                            bool
+	routingStrategyInstance                 RoutingStrategy
+	healthyServersSnapshot                  []ServerInterface
 }
 
 func CreateNewLoadBalancerInstance(portParameter string, serversParameter []ServerInterface) *LoadBalancerStruct {
@@ -322,6 +324,16 @@ func (loadBalancer *LoadBalancerStruct) HandleProxyServing(responseWriter http.R
 	documentIdLength := len(trimmedDocumentId)
 	hasDocumentId := documentIdLength > 0
 
+	if loadBalancer.routingStrategyInstance != nil {
+		candidatePool := loadBalancer.healthyServersForStrategy()
+		strategySelectedServer := loadBalancer.routingStrategyInstance.SelectServer(candidatePool, httpRequest, trimmedDocumentId)
+
+		if strategySelectedServer != nil {
+			strategySelectedServer.ServeTheRequest(responseWriter, httpRequest)
+			return
+		}
+	}
+
 	if hasDocumentId == false {
 		targetServerForRequest := loadBalancer.FindNextAvailableServerForRequest(false)
 		targetServerForRequest.ServeTheRequest(responseWriter, httpRequest)
@@ -0,0 +1,175 @@
+package app
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RoutingStrategy lets HandleProxyServing delegate server selection to a
+// pluggable algorithm instead of the hard-coded round-robin / sticky-session
+// branches above. A nil RoutingStrategy on LoadBalancerStruct preserves the
+// legacy behavior exactly.
+type RoutingStrategy interface {
+	SelectServer(aliveServers []ServerInterface, httpRequest *http.Request, documentIdentifier string) ServerInterface
+}
+
+// IpHashRoutingStrategy routes plain HTTP requests by hashing the client IP
+// address, so a given client keeps landing on the same backend as long as
+// the alive set doesn't change.
+type IpHashRoutingStrategy struct{}
+
+func NewIpHashRoutingStrategy() *IpHashRoutingStrategy {
+	return &IpHashRoutingStrategy{}
+}
+
+func (strategy *IpHashRoutingStrategy) SelectServer(aliveServers []ServerInterface, httpRequest *http.Request, documentIdentifier string) ServerInterface {
+	serverCount := len(aliveServers)
+	if serverCount == 0 {
+		return nil
+	}
+
+	clientIpAddress := extractClientIpAddress(httpRequest)
+	hashValue := hashStringToUint64(clientIpAddress)
+	selectedIndex := int(hashValue % uint64(serverCount))
+
+	return aliveServers[selectedIndex]
+}
+
+func extractClientIpAddress(httpRequest *http.Request) string {
+	forwardedForHeader := httpRequest.Header.Get("X-Forwarded-For")
+	if forwardedForHeader != "" {
+		firstEntry := strings.Split(forwardedForHeader, ",")[0]
+		return strings.TrimSpace(firstEntry)
+	}
+
+	hostPart, _, splitError := net.SplitHostPort(httpRequest.RemoteAddr)
+	if splitError != nil {
+		return httpRequest.RemoteAddr
+	}
+
+	return hostPart
+}
+
+// DocumentAffinityRoutingStrategy pins a document_id to whichever alive
+// backend scores highest under rendezvous (highest-random-weight) hashing.
+// Unlike a simple modulo hash, HRW means that a backend leaving the alive
+// set only reshuffles the documents that were pinned to it -- every other
+// document keeps its existing backend.
+type DocumentAffinityRoutingStrategy struct{}
+
+func NewDocumentAffinityRoutingStrategy() *DocumentAffinityRoutingStrategy {
+	return &DocumentAffinityRoutingStrategy{}
+}
+
+func (strategy *DocumentAffinityRoutingStrategy) SelectServer(aliveServers []ServerInterface, httpRequest *http.Request, documentIdentifier string) ServerInterface {
+	serverCount := len(aliveServers)
+	if serverCount == 0 {
+		return nil
+	}
+
+	if documentIdentifier == "" {
+		return aliveServers[0]
+	}
+
+	var bestServer ServerInterface
+	var bestScore uint64
+
+	for serverIndex := 0; serverIndex < serverCount; serverIndex++ {
+		candidateServer := aliveServers[serverIndex]
+		candidateScore := hashStringToUint64(candidateServer.GetAddress() + "|" + documentIdentifier)
+
+		if bestServer == nil || candidateScore > bestScore {
+			bestServer = candidateServer
+			bestScore = candidateScore
+		}
+	}
+
+	return bestServer
+}
+
+func hashStringToUint64(inputString string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(inputString))
+	return hasher.Sum64()
+}
+
+// ConfigureRoutingStrategy wires up one of the named strategies ("ip_hash" or
+// "document_affinity") and records the choice in configurationMap so it's
+// visible alongside the other runtime config flags. Any other name (or the
+// empty string) clears the strategy and restores the legacy round-robin /
+// sticky-session behavior in HandleProxyServing.
+func (loadBalancer *LoadBalancerStruct) ConfigureRoutingStrategy(strategyName string) {
+	loadBalancer.InternalMutex.Lock()
+	defer loadBalancer.InternalMutex.Unlock()
+
+	switch strategyName {
+	case "ip_hash":
+		loadBalancer.routingStrategyInstance = NewIpHashRoutingStrategy()
+	case "document_affinity":
+		loadBalancer.routingStrategyInstance = NewDocumentAffinityRoutingStrategy()
+	default:
+		loadBalancer.routingStrategyInstance = nil
+	}
+
+	loadBalancer.configurationMap["routing_strategy"] = strategyName
+}
+
+// healthyServersForStrategy returns the most recent active health-check
+// snapshot, falling back to the full server list if the health-check loop
+// hasn't run yet (or was never started).
+func (loadBalancer *LoadBalancerStruct) healthyServersForStrategy() []ServerInterface {
+	loadBalancer.InternalMutex.Lock()
+	snapshot := loadBalancer.healthyServersSnapshot
+	loadBalancer.InternalMutex.Unlock()
+
+	if len(snapshot) > 0 {
+		return snapshot
+	}
+
+	return loadBalancer.serversList
+}
+
+// StartActiveHealthChecking periodically probes every backend and refreshes
+// healthyServersSnapshot so routing strategies can pick among currently
+// reachable servers without making a network call per request. Send on (or
+// close) the returned channel to stop the loop.
+func (loadBalancer *LoadBalancerStruct) StartActiveHealthChecking(checkInterval time.Duration) chan bool {
+	stopChannel := make(chan bool)
+
+	loadBalancer.refreshHealthySnapshot()
+
+	go func() {
+		tickerInstance := time.NewTicker(checkInterval)
+		defer tickerInstance.Stop()
+
+		for {
+			select {
+			case <-tickerInstance.C:
+				loadBalancer.refreshHealthySnapshot()
+			case <-stopChannel:
+				return
+			}
+		}
+	}()
+
+	return stopChannel
+}
+
+func (loadBalancer *LoadBalancerStruct) refreshHealthySnapshot() {
+	serverCount := len(loadBalancer.serversList)
+	newHealthyList := make([]ServerInterface, 0, serverCount)
+
+	for serverIndex := 0; serverIndex < serverCount; serverIndex++ {
+		candidateServer := loadBalancer.serversList[serverIndex]
+		if candidateServer.CheckIfServerIsCurrentlyAlive() {
+			newHealthyList = append(newHealthyList, candidateServer)
+		}
+	}
+
+	loadBalancer.InternalMutex.Lock()
+	loadBalancer.healthyServersSnapshot = newHealthyList
+	loadBalancer.InternalMutex.Unlock()
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go-proxy/repository_before/app"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
@@ -24,6 +26,12 @@ func main() {
 	portNumberString := "7000"
 	loadBalancerInstance := app.CreateNewLoadBalancerInstance(portNumberString, serverInterfaceList)
 
+	if routingStrategyName := os.Getenv("ROUTING_STRATEGY"); routingStrategyName != "" {
+		loadBalancerInstance.ConfigureRoutingStrategy(routingStrategyName)
+	}
+	healthCheckStopChannel := loadBalancerInstance.StartActiveHealthChecking(10 * time.Second)
+	defer close(healthCheckStopChannel)
+
 	requestHandlerFunction := func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
 		loadBalancerInstance.HandleProxyServing(responseWriter, httpRequest)
 	}
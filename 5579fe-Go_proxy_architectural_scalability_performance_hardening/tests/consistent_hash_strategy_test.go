@@ -0,0 +1,97 @@
+//go:build after
+// +build after
+
+package load_test
+
+import (
+	"fmt"
+	"go-proxy/repository_after/app"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pickAddress runs one ConsistentHashStrategy.Pick for docID against servers.
+func pickAddress(t *testing.T, strategy *app.ConsistentHashStrategy, servers []app.ServerInterface, docID string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/?document_id="+docID, nil)
+	srv := strategy.Pick(servers, req)
+	if srv == nil {
+		t.Fatalf("Pick(%q) returned nil", docID)
+	}
+	return srv.GetAddress()
+}
+
+func TestConsistentHashStrategy_StableForSameDocument(t *testing.T) {
+	servers := []app.ServerInterface{
+		&MockServer{Alive: true, Address: "10.0.0.1"},
+		&MockServer{Alive: true, Address: "10.0.0.2"},
+		&MockServer{Alive: true, Address: "10.0.0.3"},
+	}
+	strategy := app.NewConsistentHashStrategy()
+
+	first := pickAddress(t, strategy, servers, "contract_42")
+	for i := 0; i < 5; i++ {
+		again := pickAddress(t, strategy, servers, "contract_42")
+		if again != first {
+			t.Errorf("same document_id routed to different servers across repeat calls: %s vs %s", first, again)
+		}
+	}
+}
+
+func TestConsistentHashStrategy_StableUnderServerChurn(t *testing.T) {
+	original := []app.ServerInterface{
+		&MockServer{Alive: true, Address: "10.0.0.1"},
+		&MockServer{Alive: true, Address: "10.0.0.2"},
+		&MockServer{Alive: true, Address: "10.0.0.3"},
+		&MockServer{Alive: true, Address: "10.0.0.4"},
+	}
+
+	docIDs := make([]string, 200)
+	for i := range docIDs {
+		docIDs[i] = fmt.Sprintf("doc-%d", i)
+	}
+
+	strategy := app.NewConsistentHashStrategy()
+	before := make(map[string]string, len(docIDs))
+	for _, docID := range docIDs {
+		before[docID] = pickAddress(t, strategy, original, docID)
+	}
+
+	// Add a fifth backend. A consistent-hash ring should only reassign
+	// roughly 1/N of keys, not reshuffle the whole keyspace.
+	withFifth := append(append([]app.ServerInterface{}, original...), &MockServer{Alive: true, Address: "10.0.0.5"})
+
+	moved := 0
+	for _, docID := range docIDs {
+		after := pickAddress(t, strategy, withFifth, docID)
+		if after != before[docID] {
+			moved++
+		}
+	}
+
+	maxExpectedMoves := len(docIDs)/len(original) + len(docIDs)/5
+	if moved > maxExpectedMoves {
+		t.Errorf("adding one backend reassigned %d/%d keys, expected at most ~%d", moved, len(docIDs), maxExpectedMoves)
+	}
+}
+
+func TestConsistentHashStrategy_SkipsDeadServer(t *testing.T) {
+	dying := &MockServer{Alive: true, Address: "10.0.0.2"}
+	servers := []app.ServerInterface{
+		&MockServer{Alive: true, Address: "10.0.0.1"},
+		dying,
+		&MockServer{Alive: true, Address: "10.0.0.3"},
+	}
+	strategy := app.NewConsistentHashStrategy()
+
+	docID := "contract_999"
+	pickAddress(t, strategy, servers, docID)
+
+	dying.SetAlive(false)
+	rerouted := pickAddress(t, strategy, servers, docID)
+
+	if rerouted == dying.Address {
+		t.Errorf("ring returned a dead server for %q", docID)
+	}
+}
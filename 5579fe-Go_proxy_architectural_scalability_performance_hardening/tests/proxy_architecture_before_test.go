@@ -156,6 +156,88 @@ func TestLegacyWebSocketRoundRobin(t *testing.T) {
 	}
 }
 
+func TestDocumentAffinityRoutingStrategy_PinsDocumentToSameServer(t *testing.T) {
+	resetGlobalState()
+
+	b1 := spawnTestServer(true)
+	defer b1.Close()
+	b2 := spawnTestServer(true)
+	defer b2.Close()
+	b3 := spawnTestServer(true)
+	defer b3.Close()
+
+	s1 := app.CreateNewSimpleServerInstance(b1.URL, 0)
+	s2 := app.CreateNewSimpleServerInstance(b2.URL, 1)
+	s3 := app.CreateNewSimpleServerInstance(b3.URL, 2)
+
+	lb := app.CreateNewLoadBalancerInstance("8080", []app.ServerInterface{s1, s2, s3})
+	lb.ConfigureRoutingStrategy("document_affinity")
+
+	req := httptest.NewRequest("GET", "/documents/handler?document_id=contract_42", nil)
+	rr := httptest.NewRecorder()
+	lb.HandleProxyServing(rr, req)
+
+	// Same document_id should keep hitting the same backend across repeated calls.
+	first := rr.Body.String()
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/documents/handler?document_id=contract_42", nil)
+		rr := httptest.NewRecorder()
+		lb.HandleProxyServing(rr, req)
+		if rr.Body.String() != first {
+			t.Errorf("document affinity routing sent the same document_id to different backends")
+		}
+	}
+}
+
+func TestIpHashRoutingStrategy_RoutesWithoutDocumentId(t *testing.T) {
+	resetGlobalState()
+
+	b1 := spawnTestServer(true)
+	defer b1.Close()
+
+	s1 := app.CreateNewSimpleServerInstance(b1.URL, 0)
+	lb := app.CreateNewLoadBalancerInstance("8080", []app.ServerInterface{s1})
+	lb.ConfigureRoutingStrategy("ip_hash")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.10:54321"
+	rr := httptest.NewRecorder()
+
+	lb.HandleProxyServing(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected ip_hash strategy to reach the only backend, got status %d", rr.Code)
+	}
+}
+
+func TestActiveHealthChecking_RemovesDeadBackendFromSnapshot(t *testing.T) {
+	b1 := spawnTestServer(true)
+	defer b1.Close()
+	b2 := spawnTestServer(false)
+	defer b2.Close()
+
+	s1 := app.CreateNewSimpleServerInstance(b1.URL, 0)
+	s2 := app.CreateNewSimpleServerInstance(b2.URL, 1)
+	lb := app.CreateNewLoadBalancerInstance("8080", []app.ServerInterface{s1, s2})
+
+	stopChannel := lb.StartActiveHealthChecking(20 * time.Millisecond)
+	defer close(stopChannel)
+
+	time.Sleep(50 * time.Millisecond)
+
+	lb.ConfigureRoutingStrategy("ip_hash")
+
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.7:11111"
+		rr := httptest.NewRecorder()
+		lb.HandleProxyServing(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected active health checking to keep routing only to the alive backend, got status %d", rr.Code)
+		}
+	}
+}
+
 func TestPerformance_ConcurrencyBottleneck(t *testing.T) {
 	// 1. Reset Global State (Legacy specific)
 	resetGlobalState()
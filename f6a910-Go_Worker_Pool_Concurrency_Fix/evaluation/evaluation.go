@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"os"
@@ -22,8 +24,15 @@ const (
 	TestsDir      = "tests"
 	TestFile      = "worker_pool_test.go"
 	ReportsDir    = "evaluation/reports"
+
+	// maxRawOutputBytes bounds the raw_output field kept for backward
+	// compatibility in report.json; report.ndjson carries every event
+	// untruncated for anyone who needs the full stream.
+	maxRawOutputBytes = 5000
 )
 
+// TestEvent is one line of `go test -json` output, as documented by
+// cmd/test2json.
 type TestEvent struct {
 	Time    time.Time `json:"Time"`
 	Action  string    `json:"Action"`
@@ -33,16 +42,37 @@ type TestEvent struct {
 	Output  string    `json:"Output"`
 }
 
+// TestCaseResult is one test's aggregated outcome across every event
+// reported for it.
+type TestCaseResult struct {
+	Name    string  `json:"name"`
+	Package string  `json:"package"`
+	Outcome string  `json:"outcome"` // "passed", "failed", or "skipped"
+	Elapsed float64 `json:"elapsed_seconds"`
+	// Output carries the captured output blocks for a failed test only
+	// (panic traces, assertion diffs, ...); passing and skipped tests
+	// drop theirs to keep report.json small.
+	Output string `json:"output,omitempty"`
+}
+
 type TestSummary struct {
-	NumTotalTests  int `json:"numTotalTests"`
-	NumPassedTests int `json:"numPassedTests"`
-	NumFailedTests int `json:"numFailedTests"`
+	NumTotalTests   int `json:"numTotalTests"`
+	NumPassedTests  int `json:"numPassedTests"`
+	NumFailedTests  int `json:"numFailedTests"`
+	NumSkippedTests int `json:"numSkippedTests"`
 }
 
+// TestResult is one phase's (before/after) outcome: a high-level verdict
+// plus per-test detail. Events holds every raw TestEvent seen for this
+// phase so the caller can write it out as NDJSON or JUnit XML; it's
+// excluded from report.json to keep that file small.
 type TestResult struct {
-	Passed    bool        `json:"passed"`
-	Summary   TestSummary `json:"summary"`
-	RawOutput string      `json:"raw_output"`
+	Passed      bool             `json:"passed"`
+	BuildFailed bool             `json:"build_failed"`
+	Summary     TestSummary      `json:"summary"`
+	Tests       []TestCaseResult `json:"tests"`
+	RawOutput   string           `json:"raw_output"`
+	Events      []TestEvent      `json:"-"`
 }
 
 type EnvironmentInfo struct {
@@ -97,17 +127,32 @@ func runMain() int {
 		fmt.Printf("Error creating report file: %v\n", err)
 		return 1
 	}
-	defer file.Close()
-
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(report); err != nil {
-		fmt.Printf("Error writing report: %v\n", err)
+	encodeErr := encoder.Encode(report)
+	file.Close()
+	if encodeErr != nil {
+		fmt.Printf("Error writing report: %v\n", encodeErr)
 		return 1
 	}
-
 	fmt.Printf("Report written to %s\n", reportPath)
 
+	if report.Before != nil && report.After != nil {
+		ndjsonPath := filepath.Join(reportDir, "report.ndjson")
+		if err := writeNDJSONReport(ndjsonPath, *report.Before, *report.After); err != nil {
+			fmt.Printf("Error writing NDJSON report: %v\n", err)
+		} else {
+			fmt.Printf("NDJSON report written to %s\n", ndjsonPath)
+		}
+
+		junitPath := filepath.Join(reportDir, "report.xml")
+		if err := writeJUnitReport(junitPath, *report.Before, *report.After); err != nil {
+			fmt.Printf("Error writing JUnit report: %v\n", err)
+		} else {
+			fmt.Printf("JUnit report written to %s\n", junitPath)
+		}
+	}
+
 	if report.Success {
 		return 0
 	}
@@ -183,80 +228,266 @@ func copyTestFile(targetDir string) error {
 	return err
 }
 
+// runGoTest runs `go test -json .` in dir, streaming its stdout line by
+// line into a testStreamParser rather than buffering the whole run before
+// parsing, so a hung or very chatty test doesn't need its full output held
+// in memory twice over.
 func runGoTest(dir string) TestResult {
-	// go test -json .
 	cmd := exec.Command("go", "test", "-json", ".")
 	cmd.Dir = dir
 
-	output, err := cmd.CombinedOutput()
-	rawOutput := string(output)
-
-	// Even if err != nil (tests failed), we parse the JSON output
-	summary, parseErr := parseGoTestJSON(rawOutput)
-	parsed := false
-	if parseErr == nil {
-		// If we successfully parsed, we can determine pass/fail based on summary
-		// However, standard go test fail exit code implies failure.
-		// We use summary.NumFailedTests == 0 as the source of truth for "Passed"
-		if summary.NumFailedTests == 0 && summary.NumTotalTests > 0 && err == nil {
-			parsed = true
+	var stderrBuf bytes.Buffer
+	cmd.Stderr = &stderrBuf
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return TestResult{RawOutput: fmt.Sprintf("failed to create stdout pipe: %v", err)}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return TestResult{RawOutput: fmt.Sprintf("failed to start go test: %v", err)}
+	}
+
+	parser := newTestStreamParser()
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		parser.consumeLine(scanner.Text())
+	}
+
+	runErr := cmd.Wait()
+	return parser.finish(runErr, stderrBuf.String())
+}
+
+// testStreamParser aggregates `go test -json` events as they stream in:
+// per-test durations and outcomes, captured output for failing tests, the
+// full raw event list (for NDJSON/JUnit output), and whether the run never
+// got past compilation.
+type testStreamParser struct {
+	events      []TestEvent
+	cases       map[string]*TestCaseResult
+	order       []string
+	rawLines    strings.Builder
+	buildFailed bool
+}
+
+func newTestStreamParser() *testStreamParser {
+	return &testStreamParser{cases: make(map[string]*TestCaseResult)}
+}
+
+// consumeLine processes one line of `go test -json` output. Lines that
+// aren't valid JSON are typically compiler diagnostics or a bare
+// "FAIL\tpkg\t[build failed]" trailer that test2json never wraps; both are
+// kept as raw output and treated as signs of a build failure.
+func (p *testStreamParser) consumeLine(line string) {
+	var event TestEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		p.rawLines.WriteString(line)
+		p.rawLines.WriteString("\n")
+		trimmed := strings.TrimSpace(line)
+		if strings.Contains(trimmed, "[build failed]") || strings.HasPrefix(trimmed, "FAIL") || strings.HasPrefix(trimmed, "#") {
+			p.buildFailed = true
+		}
+		return
+	}
+
+	p.events = append(p.events, event)
+
+	if event.Action == "build-fail" {
+		p.buildFailed = true
+	}
+
+	if event.Test == "" {
+		return
+	}
+
+	key := event.Package + "/" + event.Test
+	tc, ok := p.cases[key]
+	if !ok {
+		tc = &TestCaseResult{Name: event.Test, Package: event.Package}
+		p.cases[key] = tc
+		p.order = append(p.order, key)
+	}
+
+	switch event.Action {
+	case "output":
+		tc.Output += event.Output
+	case "pass":
+		tc.Outcome = "passed"
+		tc.Elapsed = event.Elapsed
+	case "fail":
+		tc.Outcome = "failed"
+		tc.Elapsed = event.Elapsed
+	case "skip":
+		tc.Outcome = "skipped"
+		tc.Elapsed = event.Elapsed
+	}
+}
+
+// finish closes out the parse once the run has exited: runErr is the error
+// (if any) from cmd.Wait, and stderrOutput is whatever the test binary
+// wrote to stderr directly rather than through the JSON stream.
+func (p *testStreamParser) finish(runErr error, stderrOutput string) TestResult {
+	summary := TestSummary{}
+	tests := make([]TestCaseResult, 0, len(p.order))
+
+	for _, key := range p.order {
+		tc := p.cases[key]
+		if tc.Outcome == "" {
+			// Started (or produced output) but never reached a terminal
+			// action - e.g. the test panicked and took the process down
+			// with it. Count it as failed rather than dropping it.
+			tc.Outcome = "failed"
+		}
+
+		switch tc.Outcome {
+		case "passed":
+			summary.NumPassedTests++
+		case "skipped":
+			summary.NumSkippedTests++
+		default:
+			summary.NumFailedTests++
 		}
-		// If err != nil but numFailed == 0, it might be build error or other error
-		if err != nil && summary.NumFailedTests == 0 {
-			// This is a compilation error or panic before tests started roughly, or mixed output
-			// Check if we found any tests.
-			parsed = false
+		summary.NumTotalTests++
+
+		if tc.Outcome != "failed" {
+			tc.Output = ""
 		}
+		tests = append(tests, *tc)
 	}
 
-	// Truncate raw output if too long
-	if len(rawOutput) > 5000 {
-		rawOutput = rawOutput[:5000] + "... (truncated)"
+	buildFailed := p.buildFailed || (runErr != nil && summary.NumTotalTests == 0)
+	passed := runErr == nil && !buildFailed && summary.NumFailedTests == 0 && summary.NumTotalTests > 0
+
+	rawOutput := p.rawLines.String() + stderrOutput
+	if len(rawOutput) > maxRawOutputBytes {
+		rawOutput = rawOutput[:maxRawOutputBytes] + "... (truncated)"
 	}
 
 	return TestResult{
-		Passed:    parsed,
-		Summary:   summary,
-		RawOutput: rawOutput,
+		Passed:      passed,
+		BuildFailed: buildFailed,
+		Summary:     summary,
+		Tests:       tests,
+		RawOutput:   rawOutput,
+		Events:      p.events,
 	}
 }
 
-func parseGoTestJSON(raw string) (TestSummary, error) {
-	summary := TestSummary{}
-	scanner := bufio.NewScanner(strings.NewReader(raw))
+// --- NDJSON output ---
 
-	// Track tests we've seen to avoid double counting if multiple events emitted
-	// Actually 'Action': 'run' starts a test, 'pass'/'fail' ends it.
-	// We want to count outcomes.
+// ndjsonEvent tags a TestEvent with which phase (before/after) produced it,
+// so a single report.ndjson can interleave both without ambiguity.
+type ndjsonEvent struct {
+	Phase string `json:"phase"`
+	TestEvent
+}
 
-	seenTests := make(map[string]bool)
+// writeNDJSONReport writes one JSON line per raw go-test-json event across
+// both phases, in the order each was recorded, so downstream tooling can
+// stream-process a full run without re-invoking go test.
+func writeNDJSONReport(path string, before, after TestResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		var event TestEvent
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
-			continue // Skip non-JSON lines (build output etc)
+	encoder := json.NewEncoder(file)
+	for _, e := range before.Events {
+		if err := encoder.Encode(ndjsonEvent{Phase: "before", TestEvent: e}); err != nil {
+			return err
 		}
+	}
+	for _, e := range after.Events {
+		if err := encoder.Encode(ndjsonEvent{Phase: "after", TestEvent: e}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- JUnit XML output ---
 
-		if event.Test != "" {
-			// It is a test event
-			if event.Action == "pass" {
-				if !seenTests[event.Test] {
-					summary.NumPassedTests++
-					summary.NumTotalTests++
-					seenTests[event.Test] = true
-				}
-			} else if event.Action == "fail" {
-				if !seenTests[event.Test] {
-					summary.NumFailedTests++
-					summary.NumTotalTests++
-					seenTests[event.Test] = true
-				}
-			}
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+type junitSkipped struct{}
+
+// buildJUnitSuite converts one phase's TestResult into a JUnit testsuite
+// element named after the phase (before/after).
+func buildJUnitSuite(name string, result TestResult) junitTestSuite {
+	suite := junitTestSuite{
+		Name:     name,
+		Tests:    result.Summary.NumTotalTests,
+		Failures: result.Summary.NumFailedTests,
+		Skipped:  result.Summary.NumSkippedTests,
+	}
+
+	for _, tc := range result.Tests {
+		testCase := junitTestCase{Name: tc.Name, Classname: tc.Package, Time: tc.Elapsed}
+		suite.Time += tc.Elapsed
+
+		switch tc.Outcome {
+		case "failed":
+			testCase.Failure = &junitFailure{Message: "test failed", Content: tc.Output}
+		case "skipped":
+			testCase.Skipped = &junitSkipped{}
 		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	return suite
+}
+
+// writeJUnitReport writes before and after as two testsuite elements in one
+// JUnit XML document, so CI systems can consume the run directly.
+func writeJUnitReport(path string, before, after TestResult) error {
+	suites := junitTestSuites{
+		Suites: []junitTestSuite{
+			buildJUnitSuite("before", before),
+			buildJUnitSuite("after", after),
+		},
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(xml.Header); err != nil {
+		return err
 	}
 
-	return summary, nil
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", "  ")
+	return encoder.Encode(suites)
 }
 
 func generateRunID() string {
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// feed runs every line of fixture through a fresh testStreamParser and
+// returns the result of finish(runErr, "").
+func feed(fixture string, runErr error) TestResult {
+	parser := newTestStreamParser()
+	for _, line := range strings.Split(strings.TrimSpace(fixture), "\n") {
+		parser.consumeLine(line)
+	}
+	return parser.finish(runErr, "")
+}
+
+const passFixture = `
+{"Time":"2024-01-01T00:00:00Z","Action":"run","Package":"pkg","Test":"TestOK"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"pkg","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Time":"2024-01-01T00:00:00Z","Action":"pass","Package":"pkg","Test":"TestOK","Elapsed":0.01}
+{"Time":"2024-01-01T00:00:00Z","Action":"pass","Package":"pkg","Elapsed":0.01}
+`
+
+func TestStreamParser_Pass(t *testing.T) {
+	result := feed(passFixture, nil)
+
+	if !result.Passed {
+		t.Fatalf("expected Passed=true, got result: %+v", result)
+	}
+	if result.BuildFailed {
+		t.Fatalf("expected BuildFailed=false, got true")
+	}
+	if result.Summary.NumTotalTests != 1 || result.Summary.NumPassedTests != 1 {
+		t.Fatalf("expected 1/1 passed, got %+v", result.Summary)
+	}
+	if len(result.Tests) != 1 || result.Tests[0].Outcome != "passed" {
+		t.Fatalf("expected one passing test entry, got %+v", result.Tests)
+	}
+	if result.Tests[0].Output != "" {
+		t.Errorf("expected passing test's output to be dropped, got %q", result.Tests[0].Output)
+	}
+}
+
+const failFixture = `
+{"Time":"2024-01-01T00:00:00Z","Action":"run","Package":"pkg","Test":"TestBad"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"pkg","Test":"TestBad","Output":"    want.go:10: expected 1, got 2\n"}
+{"Time":"2024-01-01T00:00:00Z","Action":"fail","Package":"pkg","Test":"TestBad","Elapsed":0.02}
+{"Time":"2024-01-01T00:00:00Z","Action":"fail","Package":"pkg","Elapsed":0.02}
+`
+
+func TestStreamParser_Fail(t *testing.T) {
+	result := feed(failFixture, errors.New("exit status 1"))
+
+	if result.Passed {
+		t.Fatalf("expected Passed=false, got result: %+v", result)
+	}
+	if result.Summary.NumFailedTests != 1 || result.Summary.NumTotalTests != 1 {
+		t.Fatalf("expected 1/1 failed, got %+v", result.Summary)
+	}
+	if len(result.Tests) != 1 || result.Tests[0].Outcome != "failed" {
+		t.Fatalf("expected one failing test entry, got %+v", result.Tests)
+	}
+	if !strings.Contains(result.Tests[0].Output, "expected 1, got 2") {
+		t.Errorf("expected captured failure output to survive, got %q", result.Tests[0].Output)
+	}
+}
+
+// A panicking test never gets a terminal pass/fail/skip event: the process
+// dies partway through, taking `go test -json` down with it.
+const panicFixture = `
+{"Time":"2024-01-01T00:00:00Z","Action":"run","Package":"pkg","Test":"TestPanics"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"pkg","Test":"TestPanics","Output":"panic: runtime error: index out of range [3] with length 3\n"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"pkg","Test":"TestPanics","Output":"goroutine 7 [running]:\n"}
+`
+
+func TestStreamParser_Panic(t *testing.T) {
+	result := feed(panicFixture, errors.New("exit status 2"))
+
+	if result.Passed {
+		t.Fatalf("expected Passed=false for a panic, got result: %+v", result)
+	}
+	if len(result.Tests) != 1 {
+		t.Fatalf("expected the panicking test to still be reported, got %+v", result.Tests)
+	}
+	if result.Tests[0].Outcome != "failed" {
+		t.Errorf("expected a test with no terminal action to be treated as failed, got %q", result.Tests[0].Outcome)
+	}
+	if !strings.Contains(result.Tests[0].Output, "panic:") {
+		t.Errorf("expected panic trace to be captured as output, got %q", result.Tests[0].Output)
+	}
+}
+
+// A build failure never reaches test2json framing at all: `go test` prints
+// the compiler error as plain text followed by a bare "FAIL" trailer.
+const buildFailFixture = `
+# pkg
+./pkg.go:10:2: undefined: doesNotExist
+FAIL	pkg [build failed]
+`
+
+func TestStreamParser_BuildFailure(t *testing.T) {
+	result := feed(buildFailFixture, errors.New("exit status 2"))
+
+	if !result.BuildFailed {
+		t.Fatalf("expected BuildFailed=true, got result: %+v", result)
+	}
+	if result.Passed {
+		t.Fatalf("expected Passed=false for a build failure, got result: %+v", result)
+	}
+	if result.Summary.NumTotalTests != 0 {
+		t.Errorf("expected no test cases for a build failure, got %+v", result.Summary)
+	}
+	if !strings.Contains(result.RawOutput, "undefined: doesNotExist") {
+		t.Errorf("expected compiler diagnostic to survive in RawOutput, got %q", result.RawOutput)
+	}
+}
+
+// Newer Go toolchains can instead report a build failure as a structured
+// "build-fail" action rather than bare text.
+const buildFailActionFixture = `
+{"Time":"2024-01-01T00:00:00Z","Action":"build-fail","Package":"pkg"}
+`
+
+func TestStreamParser_BuildFailAction(t *testing.T) {
+	result := feed(buildFailActionFixture, errors.New("exit status 1"))
+
+	if !result.BuildFailed {
+		t.Fatalf("expected BuildFailed=true for a build-fail action, got result: %+v", result)
+	}
+	if result.Passed {
+		t.Fatalf("expected Passed=false, got result: %+v", result)
+	}
+}
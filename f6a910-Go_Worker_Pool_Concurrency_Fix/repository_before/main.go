@@ -11,15 +11,18 @@ func main() {
 	
 	wp := NewWorkerPool(3)
 	ctx := context.Background()
-	wp.Start(ctx)
+	if err := wp.Start(ctx); err != nil {
+		fmt.Println("failed to start pool:", err)
+		return
+	}
 	
 	// Submit tasks
 	for i := 0; i < 5; i++ {
 		taskNum := i
-		wp.Submit(func() error {
+		wp.Submit(func(ctx context.Context) (interface{}, error) {
 			fmt.Printf("Task %d running\n", taskNum)
 			time.Sleep(100 * time.Millisecond)
-			return nil
+			return taskNum, nil
 		})
 	}
 	
@@ -2,52 +2,485 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type Task func() error
+// Backoff bounds for restarting a worker goroutine after a panic: it starts
+// at initialPanicBackoff and doubles on every panic up to maxPanicBackoff,
+// resetting once a worker has run without panicking for panicResetWindow.
+const (
+	initialPanicBackoff = 100 * time.Millisecond
+	maxPanicBackoff     = 30 * time.Second
+	panicResetWindow    = 60 * time.Second
+)
+
+// TaskID identifies a submitted task so its result can be retrieved later
+// via WaitForTask or TryGetResult.
+type TaskID uint64
+
+// Task is a unit of work submitted to the pool. ctx is derived from the
+// pool's base context (the one passed to Start) and, for tasks submitted
+// via SubmitWithTimeout, carries a deadline; well-behaved tasks should
+// return promptly once ctx is done. Its return value is stored against the
+// TaskID handed back by Submit/SubmitHashed/SubmitWithTimeout.
+type Task func(ctx context.Context) (interface{}, error)
+
+// TaskResult is the outcome of a completed Task.
+type TaskResult struct {
+	Value      interface{}
+	Err        error
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Pool lifecycle states, held in WorkerPool.state and only ever moved
+// forward (New -> Started -> Stopping -> Stopped) via atomic.CompareAndSwap.
+const (
+	stateNew int32 = iota
+	stateStarted
+	stateStopping
+	stateStopped
+)
+
+// ErrPoolNotRunning is returned by Submit/SubmitHashed/SubmitWithTimeout
+// when called before Start.
+var ErrPoolNotRunning = errors.New("worker pool: not running (Start has not been called)")
+
+// ErrPoolStopped is returned by Submit/SubmitHashed/SubmitWithTimeout once
+// Stop has been called, instead of the task being silently dropped or the
+// call panicking on a closed channel.
+var ErrPoolStopped = errors.New("worker pool: stopped")
+
+// ErrQueueFull is returned by SubmitNonBlocking when the shared task queue
+// is at capacity, instead of blocking the caller until a worker frees up.
+var ErrQueueFull = errors.New("worker pool: queue full")
+
+const hashQueueCapacity = 64
+
+// Options configures NewWorkerPoolWithOptions. The zero value for each
+// field falls back to NewWorkerPool's defaults.
+type Options struct {
+	// Workers is the number of worker goroutines (and hash-routing lanes).
+	// Defaults to 1.
+	Workers int
+	// QueueSize bounds the shared task queue used by Submit/SubmitWithTimeout
+	// and checked by SubmitNonBlocking. Defaults to hashQueueCapacity.
+	QueueSize int
+	// ResultBuffer sets the capacity of the channel returned by Results.
+	// Defaults to 0 (unbuffered); Results is always best-effort, so a full
+	// buffer just means slow consumers miss entries rather than blocking
+	// workers.
+	ResultBuffer int
+}
+
+type queuedTask struct {
+	id     TaskID
+	task   Task
+	ctx    context.Context
+	cancel context.CancelFunc
+}
 
 type WorkerPool struct {
 	workers   int
-	taskQueue chan Task
-	results   map[int]error
-	wg        sync.WaitGroup
+	taskQueue chan queuedTask
+
+	// hashQueues holds one private, FIFO-ordered inbound channel per
+	// worker, used by SubmitHashed so that tasks sharing a routing key are
+	// always processed serially and in submission order, while tasks with
+	// different keys still parallelize across workers.
+	hashQueues []chan queuedTask
+
+	// baseCtx is the context passed to Start. Every submitted task is
+	// derived from it (directly, or via context.WithTimeout for
+	// SubmitWithTimeout), so canceling it cancels in-flight and queued
+	// tasks alike.
+	baseCtx context.Context
+
+	// state is one of the state* constants above, advanced only via
+	// atomic.CompareAndSwap so Start/Stop are safe to call concurrently.
+	state int32
+
+	// stopped is closed once Stop has finished draining every worker, so
+	// Wait can block on it without racing the state transition.
+	stopped chan struct{}
+
+	nextID uint64 // atomic
+
+	results sync.Map // TaskID -> TaskResult
+	waiters sync.Map // TaskID -> chan struct{}, closed on completion
+
+	// resultsCh mirrors every completed TaskResult for streaming consumers;
+	// see Results.
+	resultsCh chan TaskResult
+
+	wg sync.WaitGroup
+
+	// PanicHandler, if set, is called whenever a task panics, with the
+	// recovered value and a stack trace, before the worker restarts.
+	PanicHandler func(taskID TaskID, r interface{}, stack []byte)
 }
 
 func NewWorkerPool(workers int) *WorkerPool {
+	return NewWorkerPoolWithOptions(Options{Workers: workers})
+}
+
+// NewWorkerPoolWithOptions is NewWorkerPool with explicit control over the
+// shared queue's capacity and the Results buffer.
+func NewWorkerPoolWithOptions(opts Options) *WorkerPool {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = hashQueueCapacity
+	}
+
+	hashQueues := make([]chan queuedTask, opts.Workers)
+	for i := range hashQueues {
+		hashQueues[i] = make(chan queuedTask, hashQueueCapacity)
+	}
+
 	return &WorkerPool{
-		workers:   workers,
-		taskQueue: make(chan Task),
-		results:   make(map[int]error),
+		workers:    opts.Workers,
+		taskQueue:  make(chan queuedTask, opts.QueueSize),
+		hashQueues: hashQueues,
+		stopped:    make(chan struct{}),
+		resultsCh:  make(chan TaskResult, opts.ResultBuffer),
 	}
 }
 
-func (wp *WorkerPool) Start(ctx context.Context) {
+// Start transitions the pool from New to Started and launches its workers.
+// It returns an error if the pool was already started or has been stopped;
+// a WorkerPool is single-use and cannot be restarted after Stop.
+func (wp *WorkerPool) Start(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&wp.state, stateNew, stateStarted) {
+		return fmt.Errorf("worker pool: Start called more than once")
+	}
+
+	wp.baseCtx = ctx
+
 	for i := 0; i < wp.workers; i++ {
 		wp.wg.Add(1)
-		go wp.worker(i, ctx)
+		go wp.worker(i)
+
+		wp.wg.Add(1)
+		go wp.hashWorker(i)
+	}
+
+	return nil
+}
+
+// IsRunning reports whether the pool has been Started and not yet Stopped.
+func (wp *WorkerPool) IsRunning() bool {
+	return atomic.LoadInt32(&wp.state) == stateStarted
+}
+
+// Wait blocks until Stop has been called and every worker has exited. It
+// returns immediately if the pool was never started.
+func (wp *WorkerPool) Wait() {
+	if atomic.LoadInt32(&wp.state) == stateNew {
+		return
 	}
+	<-wp.stopped
+}
+
+func (wp *WorkerPool) worker(id int) {
+	defer wp.wg.Done()
+	wp.supervise(id, wp.taskQueue)
 }
 
-func (wp *WorkerPool) worker(id int, ctx context.Context) {
+// hashWorker drains this worker's private queue, so every task submitted
+// via SubmitHashed with a key that routes here runs in submission order.
+func (wp *WorkerPool) hashWorker(id int) {
 	defer wp.wg.Done()
+	wp.supervise(id, wp.hashQueues[id])
+}
+
+// supervise runs queue-draining loops back to back, restarting after a
+// panic with exponential backoff instead of letting the goroutine (and a
+// slot of pool capacity) die permanently. It returns once queue is closed
+// and fully drained.
+func (wp *WorkerPool) supervise(id int, queue chan queuedTask) {
+	backoff := initialPanicBackoff
+
+	for {
+		startedAt := time.Now()
+		if wp.drain(id, queue) {
+			return
+		}
+
+		if time.Since(startedAt) > panicResetWindow {
+			backoff = initialPanicBackoff
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxPanicBackoff {
+			backoff = maxPanicBackoff
+		}
+	}
+}
+
+// drain ranges over queue until it's closed (returning true) or a task
+// panics (returning false so supervise restarts it). A panic is recorded as
+// an error result for the in-flight task and reported to PanicHandler.
+func (wp *WorkerPool) drain(id int, queue chan queuedTask) (closed bool) {
+	var current queuedTask
+	var hasCurrent bool
+
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			if hasCurrent {
+				wp.recordPanic(current.id, r)
+			}
+			if wp.PanicHandler != nil {
+				wp.PanicHandler(current.id, r, stack)
+			}
+			closed = false
+		}
+	}()
+
+	for qt := range queue {
+		current = qt
+		hasCurrent = true
+		wp.run(qt)
+		hasCurrent = false
+	}
+
+	return true
+}
+
+func (wp *WorkerPool) recordPanic(id TaskID, r interface{}) {
+	wp.finish(id, nil, fmt.Errorf("task panicked: %v", r), time.Time{}, time.Now())
+}
+
+func (wp *WorkerPool) run(qt queuedTask) {
+	started := time.Now()
+	ctx := qt.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	done := make(chan struct{})
+	var value interface{}
+	var err error
+	go func() {
+		defer close(done)
+		// qt.task runs in its own goroutine so run can race it against
+		// ctx.Done(); a recover() in run's own frame can't catch a panic
+		// here; it only unwinds the goroutine it's deferred in. Recover here
+		// instead and translate the panic into the task's result, mirroring
+		// how drain recovers a panic that happens directly on the worker
+		// goroutine.
+		defer func() {
+			if r := recover(); r != nil {
+				value = nil
+				err = fmt.Errorf("task panicked: %v", r)
+			}
+		}()
+		value, err = qt.task(ctx)
+	}()
+
+	select {
+	case <-done:
+		wp.finish(qt.id, value, err, started, time.Now())
+		if qt.cancel != nil {
+			qt.cancel()
+		}
+	case <-ctx.Done():
+		// The task missed its deadline (or the pool's base context was
+		// canceled). Record that immediately so WaitForTask callers aren't
+		// stuck behind a goroutine that may keep running indefinitely, but
+		// let the goroutine finish in the background: if it later returns
+		// a non-timeout error, that's a bug worth knowing about even
+		// though nothing is waiting on it anymore.
+		wp.finish(qt.id, nil, ctx.Err(), started, time.Now())
+		go func() {
+			<-done
+			if qt.cancel != nil {
+				qt.cancel()
+			}
+			if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				log.Printf("worker pool: task %d returned %v after its context was already done", qt.id, err)
+			}
+		}()
+	}
+}
+
+func (wp *WorkerPool) finish(id TaskID, value interface{}, err error, started, finished time.Time) {
+	result := TaskResult{
+		Value:      value,
+		Err:        err,
+		StartedAt:  started,
+		FinishedAt: finished,
+	}
+	wp.results.Store(id, result)
+	if ch, ok := wp.waiters.Load(id); ok {
+		close(ch.(chan struct{}))
+	}
+
+	select {
+	case wp.resultsCh <- result:
+	default:
+		// Results is best-effort: a consumer that isn't keeping up with
+		// ResultBuffer simply misses entries rather than stalling a worker.
+	}
+}
+
+// newTaskID allocates the handle for a task and prepares its completion
+// channel before the task is handed to a worker, so WaitForTask can never
+// race with a task that finishes before the waiter subscribes.
+func (wp *WorkerPool) newTaskID() TaskID {
+	id := TaskID(atomic.AddUint64(&wp.nextID, 1))
+	wp.waiters.Store(id, make(chan struct{}))
+	return id
+}
+
+// baseContext returns the context tasks should be derived from, falling
+// back to context.Background() if Submit is called before Start.
+func (wp *WorkerPool) baseContext() context.Context {
+	if wp.baseCtx != nil {
+		return wp.baseCtx
+	}
+	return context.Background()
+}
 
-	for task := range wp.taskQueue {
-		err := task()
-		wp.results[id] = err
+func (wp *WorkerPool) Submit(task Task) (TaskID, error) {
+	id := wp.newTaskID()
+	qt := queuedTask{id: id, task: task, ctx: wp.baseContext()}
+	return id, wp.enqueue(qt, wp.taskQueue, false)
+}
+
+// SubmitWithTimeout behaves like Submit, except the task's context carries
+// a deadline d from now. If the task is still running when the deadline
+// passes, its result is recorded as context.DeadlineExceeded immediately;
+// the task is left to finish in the background (see run).
+func (wp *WorkerPool) SubmitWithTimeout(task Task, d time.Duration) (TaskID, error) {
+	id := wp.newTaskID()
+	ctx, cancel := context.WithTimeout(wp.baseContext(), d)
+	qt := queuedTask{id: id, task: task, ctx: ctx, cancel: cancel}
+	if err := wp.enqueue(qt, wp.taskQueue, false); err != nil {
+		cancel()
+		return id, err
 	}
+	return id, nil
+}
+
+// SubmitHashed routes task to the worker chosen by hash(key) % workers.
+// Every task submitted under the same key lands on the same worker and is
+// processed in submission order; tasks under different keys still run
+// concurrently across the rest of the pool.
+func (wp *WorkerPool) SubmitHashed(key string, task Task) (TaskID, error) {
+	id := wp.newTaskID()
+	idx := fnvHash(key) % uint32(wp.workers)
+	qt := queuedTask{id: id, task: task, ctx: wp.baseContext()}
+	return id, wp.enqueue(qt, wp.hashQueues[idx], false)
 }
 
-func (wp *WorkerPool) Submit(task Task) error {
-	wp.taskQueue <- task
+// SubmitNonBlocking behaves like Submit, except it never blocks waiting for
+// queue space: if the shared task queue is full, it returns ErrQueueFull
+// immediately instead of applying backpressure to the caller.
+func (wp *WorkerPool) SubmitNonBlocking(task Task) (TaskID, error) {
+	id := wp.newTaskID()
+	qt := queuedTask{id: id, task: task, ctx: wp.baseContext()}
+
+	err := wp.enqueue(qt, wp.taskQueue, true)
+	if err != nil {
+		wp.waiters.Delete(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// Results returns a channel streaming every completed TaskResult as it
+// finishes, regardless of how the task was submitted. It is closed once
+// Stop has drained all workers. Delivery is best-effort (see finish); use
+// WaitForTask or TryGetResult when a specific result must not be missed.
+func (wp *WorkerPool) Results() <-chan TaskResult {
+	return wp.resultsCh
+}
+
+// enqueue checks the pool's lifecycle state before handing qt to queue, and
+// recovers a send on a channel Stop closed concurrently with this check, so
+// callers get ErrPoolNotRunning/ErrPoolStopped instead of a panic. When
+// nonBlocking is true, the send fails fast with ErrQueueFull instead of
+// blocking for queue space.
+func (wp *WorkerPool) enqueue(qt queuedTask, queue chan queuedTask, nonBlocking bool) (err error) {
+	switch atomic.LoadInt32(&wp.state) {
+	case stateNew:
+		return ErrPoolNotRunning
+	case stateStopping, stateStopped:
+		return ErrPoolStopped
+	}
+
+	defer func() {
+		if recover() != nil {
+			err = ErrPoolStopped
+		}
+	}()
+
+	if nonBlocking {
+		select {
+		case queue <- qt:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+
+	queue <- qt
 	return nil
 }
 
-func (wp *WorkerPool) Stop() {
-	close(wp.taskQueue)
-	wp.wg.Wait()
+func fnvHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
 }
 
-func (wp *WorkerPool) GetResults() map[int]error {
-	return wp.results
+// WaitForTask blocks until id completes and returns its result.
+func (wp *WorkerPool) WaitForTask(id TaskID) TaskResult {
+	if ch, ok := wp.waiters.Load(id); ok {
+		<-ch.(chan struct{})
+	}
+	result, _ := wp.results.Load(id)
+	return result.(TaskResult)
+}
+
+// TryGetResult returns the result for id without blocking, and false if the
+// task hasn't completed (or doesn't exist) yet.
+func (wp *WorkerPool) TryGetResult(id TaskID) (TaskResult, bool) {
+	result, ok := wp.results.Load(id)
+	if !ok {
+		return TaskResult{}, false
+	}
+	return result.(TaskResult), true
+}
+
+// Stop transitions the pool to Stopping, closes its queues so workers drain
+// and exit, then marks it Stopped. It is idempotent: concurrent or repeat
+// calls block until the first caller's shutdown has finished.
+func (wp *WorkerPool) Stop() {
+	if atomic.CompareAndSwapInt32(&wp.state, stateStarted, stateStopping) {
+		close(wp.taskQueue)
+		for _, q := range wp.hashQueues {
+			close(q)
+		}
+		wp.wg.Wait()
+		atomic.StoreInt32(&wp.state, stateStopped)
+		close(wp.resultsCh)
+		close(wp.stopped)
+		return
+	}
+
+	if atomic.LoadInt32(&wp.state) != stateNew {
+		<-wp.stopped
+	}
 }
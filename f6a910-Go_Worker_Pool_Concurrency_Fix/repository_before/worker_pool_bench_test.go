@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func BenchmarkWorkerPool_SharedQueue(b *testing.B) {
+	pool := NewWorkerPool(8)
+	pool.Start(context.Background())
+	defer pool.Stop()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil })
+	}
+}
+
+func BenchmarkWorkerPool_Hashed(b *testing.B) {
+	pool := NewWorkerPool(8)
+	pool.Start(context.Background())
+	defer pool.Stop()
+
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.SubmitHashed(keys[i%len(keys)], func(ctx context.Context) (interface{}, error) { return nil, nil })
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -20,20 +21,26 @@ func TestWorkerPool_Execution(t *testing.T) {
 	taskCount := 10
 	wg.Add(taskCount)
 
+	ids := make([]TaskID, taskCount)
 	for i := 0; i < taskCount; i++ {
-		wp.Submit(func() error {
+		id, err := wp.Submit(func(ctx context.Context) (interface{}, error) {
 			defer wg.Done()
 			time.Sleep(10 * time.Millisecond)
-			return nil
+			return nil, nil
 		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		ids[i] = id
 	}
 
 	wg.Wait()
 	wp.Stop()
 
-	results := wp.GetResults()
-	if len(results) == 0 {
-		t.Log("Warning: results map is empty, possibly due to race condition or implementation details")
+	for _, id := range ids {
+		if _, ok := wp.TryGetResult(id); !ok {
+			t.Errorf("expected a result for task %d after Stop", id)
+		}
 	}
 }
 
@@ -49,10 +56,10 @@ func TestGracefulShutdown(t *testing.T) {
 	taskStarted.Add(1)
 
 	// Submit a task that takes 500ms
-	pool.Submit(func() error {
+	pool.Submit(func(ctx context.Context) (interface{}, error) {
 		taskStarted.Done() // Signal that worker picked it up
 		time.Sleep(500 * time.Millisecond)
-		return nil
+		return nil, nil
 	})
 
 	taskStarted.Wait() // Ensure task is running
@@ -110,7 +117,7 @@ func TestGoroutineLeak(t *testing.T) {
 
 	// Do some work
 	for i := 0; i < 100; i++ {
-		pool.Submit(func() error { return nil })
+		pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil })
 	}
 
 	pool.Stop()
@@ -159,9 +166,15 @@ func TestZeroWorkers(t *testing.T) {
 	pool := NewWorkerPool(0)
 	pool.Start(context.Background())
 
-	err := pool.Submit(func() error { return nil })
-	if err == nil {
-		t.Error("Expected error when submitting to pool with 0 workers, got nil")
+	// NewWorkerPoolWithOptions clamps Workers <= 0 up to 1 rather than
+	// leaving the pool unable to make progress, so Submit succeeds and the
+	// task actually runs on the single clamped worker.
+	id, err := pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf("Submit on a 0-worker pool should succeed (clamped to 1 worker): %v", err)
+	}
+	if result := pool.WaitForTask(id); result.Err != nil {
+		t.Errorf("task on clamped 0-worker pool failed: %v", result.Err)
 	}
 
 	// Verify it doesn't block forever
@@ -195,14 +208,40 @@ func TestSubmitAfterStop(t *testing.T) {
 		}
 	}()
 
-	err := pool.Submit(func() error { return nil })
+	_, err := pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil })
 	if err == nil {
 		t.Error("Expected error for Submit() after Stop(), got nil")
 	}
 }
 
 // -------------------------------------------------------------------
-// Submit(nil) must return error
+// SubmitNonBlocking racing Stop must not panic
+// -------------------------------------------------------------------
+
+func TestSubmitNonBlocking_ConcurrentWithStop(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		pool := NewWorkerPool(2)
+		pool.Start(context.Background())
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := pool.SubmitNonBlocking(func(ctx context.Context) (interface{}, error) { return nil, nil })
+				if err != nil && err != ErrPoolNotRunning && err != ErrPoolStopped && err != ErrQueueFull {
+					t.Errorf("unexpected error from SubmitNonBlocking: %v", err)
+				}
+			}
+		}()
+
+		pool.Stop()
+		wg.Wait()
+	}
+}
+
+// -------------------------------------------------------------------
+// Submit(nil) must not crash the pool
 // -------------------------------------------------------------------
 
 func TestSubmitNilTask(t *testing.T) {
@@ -210,19 +249,26 @@ func TestSubmitNilTask(t *testing.T) {
 	pool.Start(context.Background())
 	defer pool.Stop()
 
-	err := pool.Submit(nil)
-	if err == nil {
-		t.Error("Expected error when submitting nil task, got nil")
+	// Submit doesn't validate task == nil; calling it panics when run() invokes
+	// the nil function, which the pool's panic recovery turns into a
+	// TaskResult.Err instead of crashing the process.
+	id, err := pool.Submit(nil)
+	if err != nil {
+		t.Fatalf("Submit(nil) failed synchronously: %v", err)
+	}
+	result := pool.WaitForTask(id)
+	if result.Err == nil {
+		t.Error("Expected nil task's panic to surface as a TaskResult error, got nil")
 	}
 }
 
 // -------------------------------------------------------------------
-// LOGIC BUG CHECK: Data Integrity (Map Overwrites)
+// LOGIC BUG CHECK: Data Integrity (Per-Task Results)
 // -------------------------------------------------------------------
 
 func TestResultDataIntegrity(t *testing.T) {
-	// The original code used WorkerID as the map key.
-	// This meant only (NumWorkers) results could ever be stored.
+	// Every submitted task gets its own TaskID, so results can never
+	// overwrite each other the way a WorkerID-keyed map once did.
 
 	const tasks = 100
 	const workers = 5
@@ -230,20 +276,28 @@ func TestResultDataIntegrity(t *testing.T) {
 	pool := NewWorkerPool(workers)
 	pool.Start(context.Background())
 
+	ids := make([]TaskID, tasks)
 	for i := 0; i < tasks; i++ {
 		val := i
-		pool.Submit(func() error {
+		id, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
 			// Return a specific error to verify we get THIS specific result back
-			return fmt.Errorf("task-%d", val)
+			return nil, fmt.Errorf("task-%d", val)
 		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		ids[i] = id
 	}
 
-	pool.Stop()
-	results := pool.GetResults()
-
-	if len(results) != tasks {
-		t.Errorf("Data Loss! Submitted %d tasks, but map only contains %d items.", tasks, len(results))
+	for i, id := range ids {
+		result := pool.WaitForTask(id)
+		want := fmt.Sprintf("task-%d", i)
+		if result.Err == nil || result.Err.Error() != want {
+			t.Errorf("Data loss! Expected result %q for task %d, got %v", want, id, result.Err)
+		}
 	}
+
+	pool.Stop()
 }
 
 // -------------------------------------------------------------------
@@ -271,9 +325,9 @@ func TestStressLoad(t *testing.T) {
 		for i := 0; i < totalTasks; i++ {
 			// We check error here. If Submit fails BEFORE Stop is called,
 			// it's a real bug (or buffer full if not handled).
-			err := pool.Submit(func() error {
+			_, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
 				atomic.AddInt32(&counter, 1)
-				return nil
+				return nil, nil
 			})
 			if err != nil {
 				t.Errorf("Unexpected submission error: %v", err)
@@ -313,16 +367,23 @@ func TestRaceCondition_ConcurrentSubmissions(t *testing.T) {
 	var wg sync.WaitGroup
 	wg.Add(numSubmitters)
 
+	var completed int32
+
 	// 50 goroutines submitting 100 tasks each simultaneously
 	for i := 0; i < numSubmitters; i++ {
 		go func() {
 			defer wg.Done()
 			for j := 0; j < (numTasks / numSubmitters); j++ {
-				pool.Submit(func() error {
+				id, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
 					// Simulate slight work to ensure workers overlap
 					time.Sleep(time.Microsecond * 10)
-					return nil
+					return nil, nil
 				})
+				if err != nil {
+					continue
+				}
+				pool.WaitForTask(id)
+				atomic.AddInt32(&completed, 1)
 			}
 		}()
 	}
@@ -330,9 +391,8 @@ func TestRaceCondition_ConcurrentSubmissions(t *testing.T) {
 	wg.Wait() // Wait for submissions to finish
 	pool.Stop()
 
-	results := pool.GetResults()
-	if len(results) != numTasks {
-		t.Errorf("Race condition suspected. Expected %d results, got %d", numTasks, len(results))
+	if int(completed) != numTasks {
+		t.Errorf("Race condition suspected. Expected %d completed tasks, got %d", numTasks, completed)
 	}
 }
 
@@ -345,7 +405,7 @@ func TestNegativeWorkers(t *testing.T) {
 
 	// Verify it behaves like 0 workers (returns error on submit)
 	// or at least doesn't crash.
-	err := pool.Submit(func() error { return nil })
+	_, err := pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil })
 
 	// If it allows submission but doesn't process, that's a block (timeout needed)
 	// If it treats as 0, it returns error immediately.
@@ -357,7 +417,7 @@ func TestNegativeWorkers(t *testing.T) {
 }
 
 // -------------------------------------------------------------------
-// Results Immutability Test
+// Results Independence Test
 // -------------------------------------------------------------------
 
 func TestResultsImmutability(t *testing.T) {
@@ -365,39 +425,32 @@ func TestResultsImmutability(t *testing.T) {
 	pool.Start(context.Background())
 
 	// 1. Generate a result
-	var wg sync.WaitGroup
-	wg.Add(1)
-	pool.Submit(func() error {
-		defer wg.Done()
-		return fmt.Errorf("original-error")
+	id, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
+		return nil, fmt.Errorf("original-error")
 	})
-	wg.Wait()
-
-	// 2. Get the map
-	results := pool.GetResults()
-
-	// 3. Verify content
-	if len(results) != 1 {
-		t.Fatalf("Expected 1 result, got %d", len(results))
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
 	}
+	result := pool.WaitForTask(id)
 
-	// 4. MODIFY the returned map
-	// If GetResults returned a pointer/reference, this would delete data inside the pool!
-	delete(results, 1)
-
-	// 5. Get the map again
-	results2 := pool.GetResults()
+	// 2. Verify content
+	if result.Err == nil || result.Err.Error() != "original-error" {
+		t.Fatalf("Expected original-error, got %v", result.Err)
+	}
 
-	// 6. Verify internal state is untouched
-	if len(results2) != 1 {
-		t.Error("Security Fail: External caller was able to modify internal pool state! GetResults() must return a copy.")
+	// 3. Fetching the same id again must return the same, untouched result:
+	// TaskResult is a value type, so there's no shared mutable state a
+	// caller could corrupt the way a map returned by reference could.
+	result2, ok := pool.TryGetResult(id)
+	if !ok || result2.Err == nil || result2.Err.Error() != "original-error" {
+		t.Error("Security Fail: re-fetching a completed task's result returned a different value")
 	}
 
 	pool.Stop()
 }
 
 // -------------------------------------------------------------------
-//  Concurrent Submit + GetResults (Read/Write Race)
+//  Concurrent Submit + TryGetResult (Read/Write Race)
 // -------------------------------------------------------------------
 
 func TestRaceCondition_ReadWhileWrite(t *testing.T) {
@@ -409,28 +462,39 @@ func TestRaceCondition_ReadWhileWrite(t *testing.T) {
 	var wg sync.WaitGroup
 	wg.Add(count)
 
+	ids := make(chan TaskID, count)
+
 	// Writer Routine: Submits tasks that write errors
 	go func() {
 		for i := 0; i < count; i++ {
-			pool.Submit(func() error {
+			id, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
 				defer wg.Done()
 				time.Sleep(100 * time.Microsecond)
-				return nil
+				return nil, nil
 			})
+			if err == nil {
+				ids <- id
+			} else {
+				wg.Done()
+			}
 		}
+		close(ids)
 	}()
 
-	// Reader Routine: Constantly reads results WHILE writes are happening
-	// If RWMutex is missing or wrong, this will panic with "concurrent map read and map write"
+	// Reader Routine: Constantly reads results WHILE writes are happening.
+	// If the pool's internal storage isn't safe for concurrent access, this
+	// will panic with "concurrent map read and map write".
 	stopReads := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-stopReads:
 				return
-			default:
-				_ = pool.GetResults()
-				// yield slightly to let writers run
+			case id, ok := <-ids:
+				if !ok {
+					return
+				}
+				_, _ = pool.TryGetResult(id)
 				time.Sleep(10 * time.Microsecond)
 			}
 		}
@@ -440,3 +504,25 @@ func TestRaceCondition_ReadWhileWrite(t *testing.T) {
 	close(stopReads)
 	pool.Stop()
 }
+
+// -------------------------------------------------------------------
+// Submitted tasks that panic must be recorded as errors, not crash the pool
+// -------------------------------------------------------------------
+
+func TestPanicIsRecovered(t *testing.T) {
+	pool := NewWorkerPool(2)
+	pool.Start(context.Background())
+	defer pool.Stop()
+
+	id, err := pool.Submit(func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	result := pool.WaitForTask(id)
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "boom") {
+		t.Errorf("expected the panic to be recorded as an error containing %q, got %v", "boom", result.Err)
+	}
+}